@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	opts "xtravisions.com/xmgo/options"
+)
+
+// Client、Database、Collection 及 Bulk 的方法返回具体类型，
+// 以下包装将返回值转换为接口类型，使其可作为 IClient、IDatabase、ICollection 及 IBulk 使用
+var (
+	_ IClient     = clientAdapter{}
+	_ IDatabase   = databaseAdapter{}
+	_ ICollection = collectionAdapter{}
+	_ IBulk       = bulkAdapter{}
+)
+
+// Interface 获取实现 IClient 接口的包装，如用于 xmgotest.NewDatabase
+func (c *Client) Interface() IClient {
+	return clientAdapter{c}
+}
+
+// Interface 获取实现 IDatabase 接口的包装，如用于 outbox.New
+func (d *Database) Interface() IDatabase {
+	return databaseAdapter{d}
+}
+
+// Interface 获取实现 ICollection 接口的包装，如用于 replay.Record
+func (c *Collection) Interface() ICollection {
+	return collectionAdapter{c}
+}
+
+// Interface 获取实现 IBulk 接口的包装
+func (b *Bulk) Interface() IBulk {
+	return bulkAdapter{b}
+}
+
+type clientAdapter struct {
+	*Client
+}
+
+func (a clientAdapter) Database(name string, o ...*opts.DatabaseOptions) IDatabase {
+	return a.Client.Database(name, o...).Interface()
+}
+
+type databaseAdapter struct {
+	*Database
+}
+
+func (a databaseAdapter) Clone(o ...*opts.DatabaseOptions) IDatabase {
+	return a.Database.Clone(o...).Interface()
+}
+
+func (a databaseAdapter) Collection(name string) ICollection {
+	return a.Database.Collection(name).Interface()
+}
+
+func (a databaseAdapter) ModelCollection(model IModel) ICollection {
+	return a.Database.ModelCollection(model).Interface()
+}
+
+type collectionAdapter struct {
+	*Collection
+}
+
+func (a collectionAdapter) Clone(o ...*opts.CollectionOptions) ICollection {
+	return a.Collection.Clone(o...).Interface()
+}
+
+func (a collectionAdapter) Bulk() IBulk {
+	return a.Collection.Bulk().Interface()
+}
+
+type bulkAdapter struct {
+	*Bulk
+}
+
+func (a bulkAdapter) SetOrdered(ordered bool) IBulk {
+	a.Bulk.SetOrdered(ordered)
+	return a
+}
+
+func (a bulkAdapter) InsertOne(doc interface{}) IBulk {
+	a.Bulk.InsertOne(doc)
+	return a
+}
+
+func (a bulkAdapter) Remove(filter interface{}) IBulk {
+	a.Bulk.Remove(filter)
+	return a
+}
+
+func (a bulkAdapter) RemoveId(id interface{}) IBulk {
+	a.Bulk.RemoveId(id)
+	return a
+}
+
+func (a bulkAdapter) RemoveAll(filter interface{}) IBulk {
+	a.Bulk.RemoveAll(filter)
+	return a
+}
+
+func (a bulkAdapter) Upsert(filter interface{}, replacement interface{}) IBulk {
+	a.Bulk.Upsert(filter, replacement)
+	return a
+}
+
+func (a bulkAdapter) UpsertOne(filter interface{}, update interface{}) IBulk {
+	a.Bulk.UpsertOne(filter, update)
+	return a
+}
+
+func (a bulkAdapter) UpsertId(id interface{}, replacement interface{}) IBulk {
+	a.Bulk.UpsertId(id, replacement)
+	return a
+}
+
+func (a bulkAdapter) UpdateOne(filter interface{}, update interface{}) IBulk {
+	a.Bulk.UpdateOne(filter, update)
+	return a
+}
+
+func (a bulkAdapter) UpdateId(id interface{}, update interface{}) IBulk {
+	a.Bulk.UpdateId(id, update)
+	return a
+}
+
+func (a bulkAdapter) UpdateAll(filter interface{}, update interface{}) IBulk {
+	a.Bulk.UpdateAll(filter, update)
+	return a
+}
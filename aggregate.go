@@ -8,6 +8,8 @@ import (
 	"context"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 	opts "xtravisions.com/xmgo/options"
 )
 
@@ -15,6 +17,9 @@ type IAggregate interface {
 	All(results interface{}) error
 	One(result interface{}) error
 	Iter() ICursor
+	ReadPreference(rp *readpref.ReadPref) IAggregate
+	ReadConcern(rc *readconcern.ReadConcern) IAggregate
+	Collation(collation *options.Collation) IAggregate
 }
 
 type Aggregate struct {
@@ -22,35 +27,107 @@ type Aggregate struct {
 	pipeline   interface{}
 	collection *mongo.Collection
 	options    []opts.AggregateOptions
+	exec       *executor
+	collation  *options.Collation
 }
 
-func (a *Aggregate) All(results interface{}) error {
-	aOpts := options.Aggregate()
+// ReadPreference 设置聚合的读策略
+func (a *Aggregate) ReadPreference(rp *readpref.ReadPref) IAggregate {
+	return a.clone(options.Collection().SetReadPreference(rp))
+}
+
+// ReadConcern 设置聚合的读关注
+func (a *Aggregate) ReadConcern(rc *readconcern.ReadConcern) IAggregate {
+	return a.clone(options.Collection().SetReadConcern(rc))
+}
+
+// Collation 设置聚合的排序规则
+func (a *Aggregate) Collation(collation *options.Collation) IAggregate {
+	a.collation = collation
+	return a
+}
+
+// clone 按参数克隆聚合使用的 collection，克隆失败时聚合返回克隆错误
+func (a *Aggregate) clone(o *options.CollectionOptions) IAggregate {
+	c, err := a.collection.Clone(o)
+	if err != nil {
+		a.exec = a.exec.withErr(err)
+	} else {
+		a.collection = c
+	}
+
+	return a
+}
+
+// aggregateOptions 合并聚合参数及排序规则
+func (a *Aggregate) aggregateOptions() []*options.AggregateOptions {
+	aOpts := []*options.AggregateOptions{options.Aggregate()}
 	if len(a.options) > 0 {
-		aOpts = a.options[0].AggregateOptions
+		aOpts[0] = a.options[0].AggregateOptions
+	}
+	if a.collation != nil {
+		aOpts = append(aOpts, options.Aggregate().SetCollation(a.collation))
+	}
+
+	return aOpts
+}
+
+// require 检查服务器是否支持管道中的阶段
+func (a *Aggregate) require() error {
+	if merge, _ := hasStage(a.pipeline, "$merge"); merge {
+		return a.exec.require(a.ctx, FeatureMerge)
+	}
+
+	return nil
+}
+
+func (a *Aggregate) All(results interface{}) (err error) {
+	defer a.wrapErr(&err, "aggregate.all")
+
+	if err = a.require(); err != nil {
+		return
 	}
 
-	c, err := a.collection.Aggregate(a.ctx, a.pipeline, aOpts)
+	ctx, cancel, err := a.exec.prepare(a.ctx, opAggregate)
 	if err != nil {
-		return err
+		return
 	}
+	defer cancel()
+
+	return a.exec.do(ctx, idempotentPipeline(a.pipeline), func() error {
+		c, err := a.collection.Aggregate(ctx, a.pipeline, a.aggregateOptions()...)
+		if err != nil {
+			return err
+		}
 
-	return c.All(a.ctx, results)
+		return c.All(ctx, results)
+	})
 }
 
-func (a *Aggregate) One(result interface{}) error {
-	aOpts := options.Aggregate()
-	if len(a.options) > 0 {
-		aOpts = a.options[0].AggregateOptions
+func (a *Aggregate) One(result interface{}) (err error) {
+	defer a.wrapErr(&err, "aggregate.one")
+
+	if err = a.require(); err != nil {
+		return
+	}
+
+	ctx, cancel, err := a.exec.prepare(a.ctx, opAggregate)
+	if err != nil {
+		return
 	}
+	defer cancel()
 
-	c, err := a.collection.Aggregate(a.ctx, a.pipeline, aOpts)
+	var c *mongo.Cursor
+	err = a.exec.do(ctx, idempotentPipeline(a.pipeline), func() (err error) {
+		c, err = a.collection.Aggregate(ctx, a.pipeline, a.aggregateOptions()...)
+		return
+	})
 	if err != nil {
 		return err
 	}
 
 	cr := Cursor{
-		ctx:    a.ctx,
+		ctx:    ctx,
 		cursor: c,
 		err:    err,
 	}
@@ -66,14 +143,32 @@ func (a *Aggregate) One(result interface{}) error {
 }
 
 func (a *Aggregate) Iter() ICursor {
-	aOpts := options.Aggregate()
-	if len(a.options) > 0 {
-		aOpts = a.options[0].AggregateOptions
+	ctx, cancel, err := a.exec.prepare(a.ctx, opAggregate)
+
+	var c *mongo.Cursor
+	if err == nil {
+		err = a.require()
 	}
-	c, err := a.collection.Aggregate(a.ctx, a.pipeline, aOpts)
+	if err == nil {
+		err = a.exec.do(ctx, idempotentPipeline(a.pipeline), func() (err error) {
+			c, err = a.collection.Aggregate(ctx, a.pipeline, a.aggregateOptions()...)
+			return
+		})
+	}
+	a.wrapErr(&err, "aggregate.iter")
+	if err != nil {
+		cancel()
+	}
+
 	return &Cursor{
-		ctx:    a.ctx,
+		ctx:    ctx,
 		cursor: c,
 		err:    err,
+		cancel: cancel,
 	}
 }
+
+// wrapErr 为聚合的错误附加操作信息，配合 defer 使用
+func (a *Aggregate) wrapErr(err *error, op string) {
+	*err = NewOpError(a.collection.Database().Name(), a.collection.Name(), op, nil, *err)
+}
@@ -0,0 +1,311 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CircuitState 熔断器状态
+type CircuitState int32
+
+const (
+	// CircuitClosed 关闭，请求正常执行
+	CircuitClosed CircuitState = iota
+	// CircuitOpen 打开，请求直接返回 ErrCircuitOpen
+	CircuitOpen
+	// CircuitHalfOpen 半开，仅允许少量探测请求执行
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// 熔断配置默认值
+const (
+	defaultWindowSize     = 100
+	defaultMinRequests    = 20
+	defaultFailureRatio   = 0.5
+	defaultSlowCallRatio  = 0.5
+	defaultOpenDuration   = 30 * time.Second
+	defaultHalfOpenProbes = 3
+)
+
+// CircuitBreakerConfig 熔断配置
+//
+//	统计最近 WindowSize 次请求，请求数达到 MinRequests 且失败率或慢请求比例达到阈值时熔断，
+//	熔断 OpenMS 后进入半开状态，HalfOpenProbes 个探测请求全部成功后恢复，任一探测失败则重新熔断
+//	网络错误、超时、非主节点及其他瞬时错误计为失败，文档不存在、唯一索引冲突等业务错误不计
+type CircuitBreakerConfig struct {
+	// 统计的最近请求数
+	//	默认为 100
+	WindowSize int `json:"windowSize"`
+	// 触发熔断的最少请求数
+	//	默认为 20
+	MinRequests int `json:"minRequests"`
+	// 触发熔断的失败率，取值 0 ~ 1
+	//	默认为 0.5
+	FailureRatio float64 `json:"failureRatio"`
+	// 慢请求耗时阈值
+	//	设置为 0 意味不统计慢请求
+	SlowCallMS int64 `json:"slowCallMS"`
+	// 触发熔断的慢请求比例，取值 0 ~ 1
+	//	默认为 0.5
+	SlowCallRatio float64 `json:"slowCallRatio"`
+	// 熔断持续时间，之后进入半开状态
+	//	默认为 30 秒
+	OpenMS int64 `json:"openMS"`
+	// 半开状态下的探测请求数
+	//	默认为 3
+	HalfOpenProbes int `json:"halfOpenProbes"`
+}
+
+// CircuitStats 熔断器统计信息
+type CircuitStats struct {
+	// 当前状态
+	State CircuitState
+	// 统计窗口内的请求数
+	Requests int
+	// 统计窗口内的失败请求数
+	Failures int
+	// 统计窗口内的慢请求数
+	SlowCalls int
+	// 累计被拒绝的请求数
+	Rejected uint64
+	// 累计熔断次数
+	Trips uint64
+}
+
+// CircuitBreaker 熔断器
+type CircuitBreaker struct {
+	conf     CircuitBreakerConfig
+	slow     time.Duration
+	open     time.Duration
+	onChange func(from, to CircuitState)
+
+	mu       sync.Mutex
+	state    CircuitState
+	window   []outcome
+	pos      int
+	count    int
+	failures int
+	slowAll  int
+	openedAt time.Time
+	probes   int
+	passed   int
+	rejected uint64
+	trips    uint64
+}
+
+type outcome struct {
+	failed bool
+	slow   bool
+}
+
+// NewCircuitBreaker 创建熔断器
+//
+//	@param conf 熔断配置
+//	@param onChange 状态变化回调，可为 nil
+func NewCircuitBreaker(conf CircuitBreakerConfig, onChange func(from, to CircuitState)) *CircuitBreaker {
+	if conf.WindowSize <= 0 {
+		conf.WindowSize = defaultWindowSize
+	}
+	if conf.MinRequests <= 0 {
+		conf.MinRequests = defaultMinRequests
+	}
+	if conf.MinRequests > conf.WindowSize {
+		conf.MinRequests = conf.WindowSize
+	}
+	if conf.FailureRatio <= 0 {
+		conf.FailureRatio = defaultFailureRatio
+	}
+	if conf.SlowCallRatio <= 0 {
+		conf.SlowCallRatio = defaultSlowCallRatio
+	}
+	if conf.HalfOpenProbes <= 0 {
+		conf.HalfOpenProbes = defaultHalfOpenProbes
+	}
+
+	open := time.Duration(conf.OpenMS) * time.Millisecond
+	if open <= 0 {
+		open = defaultOpenDuration
+	}
+
+	return &CircuitBreaker{
+		conf:     conf,
+		slow:     time.Duration(conf.SlowCallMS) * time.Millisecond,
+		open:     open,
+		onChange: onChange,
+		window:   make([]outcome, conf.WindowSize),
+	}
+}
+
+// State 获取当前状态
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Stats 获取统计信息
+func (b *CircuitBreaker) Stats() CircuitStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return CircuitStats{
+		State:     b.state,
+		Requests:  b.count,
+		Failures:  b.failures,
+		SlowCalls: b.slowAll,
+		Rejected:  b.rejected,
+		Trips:     b.trips,
+	}
+}
+
+// do 经熔断器执行 fn，熔断时直接返回 ErrCircuitOpen
+func (b *CircuitBreaker) do(fn func() error) error {
+	if b == nil {
+		return fn()
+	}
+
+	probe, err := b.allow()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	err = fn()
+	b.record(probe, circuitFailure(err), time.Since(start))
+
+	return err
+}
+
+// allow 判断是否允许执行请求，半开状态下的请求作为探测请求
+func (b *CircuitBreaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	from := b.state
+
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.open {
+		b.state, b.probes, b.passed = CircuitHalfOpen, 0, 0
+	}
+
+	switch {
+	case b.state == CircuitOpen:
+		err = ErrCircuitOpen
+	case b.state == CircuitHalfOpen && b.probes >= b.conf.HalfOpenProbes:
+		err = ErrCircuitOpen
+	case b.state == CircuitHalfOpen:
+		b.probes++
+		probe = true
+	}
+	if err != nil {
+		b.rejected++
+	}
+
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+	return
+}
+
+// record 记录请求结果并按阈值切换状态
+func (b *CircuitBreaker) record(probe bool, failed bool, d time.Duration) {
+	slow := b.slow > 0 && d >= b.slow
+
+	b.mu.Lock()
+	from := b.state
+
+	switch {
+	case probe && b.state == CircuitHalfOpen:
+		if failed || slow {
+			b.trip()
+		} else if b.passed++; b.passed >= b.conf.HalfOpenProbes {
+			b.reset()
+		}
+	case !probe && b.state == CircuitClosed:
+		b.push(outcome{failed: failed, slow: slow})
+		if b.count >= b.conf.MinRequests && b.exceeded() {
+			b.trip()
+		}
+	}
+
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+}
+
+func (b *CircuitBreaker) push(o outcome) {
+	if b.count == len(b.window) {
+		old := b.window[b.pos]
+		if old.failed {
+			b.failures--
+		}
+		if old.slow {
+			b.slowAll--
+		}
+	} else {
+		b.count++
+	}
+
+	b.window[b.pos] = o
+	b.pos = (b.pos + 1) % len(b.window)
+	if o.failed {
+		b.failures++
+	}
+	if o.slow {
+		b.slowAll++
+	}
+}
+
+func (b *CircuitBreaker) exceeded() bool {
+	if float64(b.failures)/float64(b.count) >= b.conf.FailureRatio {
+		return true
+	}
+
+	return b.slow > 0 && float64(b.slowAll)/float64(b.count) >= b.conf.SlowCallRatio
+}
+
+func (b *CircuitBreaker) trip() {
+	b.state, b.openedAt = CircuitOpen, time.Now()
+	b.trips++
+}
+
+func (b *CircuitBreaker) reset() {
+	b.state = CircuitClosed
+	b.pos, b.count, b.failures, b.slowAll = 0, 0, 0, 0
+}
+
+func (b *CircuitBreaker) notify(from, to CircuitState) {
+	if from != to && b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
+
+// circuitFailure 判断错误是否计入熔断失败，调用方取消上下文及业务错误不计入
+func circuitFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	return IsNetwork(err) || mongo.IsTimeout(err) || IsNotPrimary(err) || notExecuted(err) || IsRetryable(err)
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+const testOpenDuration = 20 * time.Millisecond
+
+func newTestBreaker(transitions *[]string) *CircuitBreaker {
+	return NewCircuitBreaker(CircuitBreakerConfig{
+		WindowSize:     4,
+		MinRequests:    4,
+		FailureRatio:   0.5,
+		OpenMS:         testOpenDuration.Milliseconds(),
+		HalfOpenProbes: 2,
+	}, func(from, to CircuitState) {
+		*transitions = append(*transitions, from.String()+"->"+to.String())
+	})
+}
+
+// run 经熔断器执行一次返回 err 的请求，返回请求是否被执行
+func run(b *CircuitBreaker, err error) bool {
+	called := false
+	_ = b.do(func() error {
+		called = true
+		return err
+	})
+	return called
+}
+
+func TestCircuitBreakerTrips(t *testing.T) {
+	var transitions []string
+	b := newTestBreaker(&transitions)
+
+	run(b, nil)
+	run(b, errNetwork)
+	run(b, errNetwork)
+	if b.State() != CircuitClosed {
+		t.Fatalf("state before MinRequests = %v, want closed", b.State())
+	}
+
+	run(b, nil)
+	if b.State() != CircuitOpen {
+		t.Fatalf("state with 2/4 failures = %v, want open", b.State())
+	}
+	if run(b, nil) {
+		t.Error("request executed while open")
+	}
+	if err := b.do(func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("do() while open = %v, want ErrCircuitOpen", err)
+	}
+
+	stats := b.Stats()
+	if stats.Trips != 1 || stats.Rejected != 2 || stats.Failures != 2 || stats.Requests != 4 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+	if len(transitions) != 1 || transitions[0] != "closed->open" {
+		t.Errorf("transitions = %v", transitions)
+	}
+}
+
+func TestCircuitBreakerIgnoresBusinessErrors(t *testing.T) {
+	var transitions []string
+	b := newTestBreaker(&transitions)
+
+	for _, err := range []error{ErrNoSuchDocuments, context.Canceled, &DuplicateKeyError{}, ErrNoSuchDocuments, ErrNoSuchDocuments} {
+		run(b, err)
+	}
+
+	if b.State() != CircuitClosed || b.Stats().Failures != 0 {
+		t.Errorf("state = %v, stats = %+v, want closed without failures", b.State(), b.Stats())
+	}
+}
+
+func TestCircuitBreakerWindowSlides(t *testing.T) {
+	var transitions []string
+	b := newTestBreaker(&transitions)
+
+	// 窗口内只保留最近 4 次请求，早期的失败滑出窗口
+	for _, err := range []error{errNetwork, nil, nil, nil, nil, nil} {
+		run(b, err)
+		if b.State() != CircuitClosed {
+			t.Fatalf("tripped with stats %+v", b.Stats())
+		}
+	}
+	if s := b.Stats(); s.Requests != 4 || s.Failures != 0 {
+		t.Errorf("Stats() = %+v, want 4 requests without failures", s)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	trip := func(b *CircuitBreaker) {
+		for i := 0; i < 4; i++ {
+			run(b, errNetwork)
+		}
+		time.Sleep(2 * testOpenDuration)
+	}
+
+	t.Run("probes recover", func(t *testing.T) {
+		var transitions []string
+		b := newTestBreaker(&transitions)
+		trip(b)
+
+		if !run(b, nil) || b.State() != CircuitHalfOpen {
+			t.Fatalf("state after first probe = %v, want half-open", b.State())
+		}
+		if !run(b, nil) || b.State() != CircuitClosed {
+			t.Fatalf("state after all probes = %v, want closed", b.State())
+		}
+		if s := b.Stats(); s.Requests != 0 {
+			t.Errorf("window not reset on recovery: %+v", s)
+		}
+
+		want := []string{"closed->open", "open->half-open", "half-open->closed"}
+		if len(transitions) != len(want) {
+			t.Fatalf("transitions = %v, want %v", transitions, want)
+		}
+		for i := range want {
+			if transitions[i] != want[i] {
+				t.Errorf("transitions = %v, want %v", transitions, want)
+			}
+		}
+	})
+
+	t.Run("probe failure reopens", func(t *testing.T) {
+		var transitions []string
+		b := newTestBreaker(&transitions)
+		trip(b)
+
+		run(b, errNetwork)
+		if b.State() != CircuitOpen || b.Stats().Trips != 2 {
+			t.Fatalf("state after failed probe = %v, trips = %d", b.State(), b.Stats().Trips)
+		}
+		if run(b, nil) {
+			t.Error("request executed after failed probe")
+		}
+	})
+}
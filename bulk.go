@@ -6,6 +6,7 @@ package xmgo
 
 import (
 	"context"
+	"errors"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -21,6 +22,25 @@ type BulkResult struct {
 	UpsertedIDs   map[int64]interface{}
 }
 
+// IBulk 批量写操作接口
+//
+//	Bulk 的方法返回具体类型，通过 Bulk.Interface 获取该接口的实现
+type IBulk interface {
+	SetOrdered(ordered bool) IBulk
+	InsertOne(doc interface{}) IBulk
+	Remove(filter interface{}) IBulk
+	RemoveId(id interface{}) IBulk
+	RemoveAll(filter interface{}) IBulk
+	Upsert(filter interface{}, replacement interface{}) IBulk
+	UpsertOne(filter interface{}, update interface{}) IBulk
+	UpsertId(id interface{}, replacement interface{}) IBulk
+	UpdateOne(filter interface{}, update interface{}) IBulk
+	UpdateId(id interface{}, update interface{}) IBulk
+	UpdateAll(filter interface{}, update interface{}) IBulk
+	Run() (*BulkResult, error)
+	RunWithCtx(ctx context.Context) (*BulkResult, error)
+}
+
 type Bulk struct {
 	coll *Collection
 
@@ -102,19 +122,47 @@ func (b *Bulk) Run() (*BulkResult, error) {
 	return b.RunWithCtx(context.TODO())
 }
 
-func (b *Bulk) RunWithCtx(ctx context.Context) (*BulkResult, error) {
+// RunWithCtx 执行全部写操作
+//
+//	部分写操作失败时同时返回已执行部分的结果及错误
+func (b *Bulk) RunWithCtx(ctx context.Context) (res *BulkResult, err error) {
+	defer b.coll.wrapErr(&err, "bulk", nil)
+
+	ctx, cancel, err := b.coll.exec.prepare(ctx, opWrite)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	opts := options.BulkWriteOptions{
 		Ordered: b.ordered,
 	}
-	result, err := b.coll.collection.BulkWrite(ctx, b.queue, &opts)
+	idempotent := true
+	for _, model := range b.queue {
+		idempotent = idempotent && idempotentModel(model)
+	}
+
+	var result *mongo.BulkWriteResult
+	err = b.coll.exec.do(ctx, idempotent, func() (err error) {
+		result, err = b.coll.collection.BulkWrite(ctx, b.queue, &opts)
+		return
+	})
 	if err != nil {
+		var bwe mongo.BulkWriteException
+		if result != nil && errors.As(err, &bwe) {
+			res = bulkResult(result)
+		}
 		// In original mgo, queue is not reset in case of error.
-		return nil, err
+		return res, WrapWriteError(err, nil, b.queue)
 	}
 
 	// Empty the queue for possible reuse, as per mgo's behavior.
 	b.queue = nil
 
+	return bulkResult(result), nil
+}
+
+func bulkResult(result *mongo.BulkWriteResult) *BulkResult {
 	return &BulkResult{
 		InsertedCount: result.InsertedCount,
 		MatchedCount:  result.MatchedCount,
@@ -122,5 +170,5 @@ func (b *Bulk) RunWithCtx(ctx context.Context) (*BulkResult, error) {
 		DeletedCount:  result.DeletedCount,
 		UpsertedCount: result.UpsertedCount,
 		UpsertedIDs:   result.UpsertedIDs,
-	}, nil
+	}
 }
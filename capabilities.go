@@ -0,0 +1,323 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Topology 部署拓扑类型
+type Topology string
+
+const (
+	TopologyUnknown    Topology = "unknown"
+	TopologyStandalone Topology = "standalone"
+	TopologyReplicaSet Topology = "replicaSet"
+	TopologySharded    Topology = "sharded"
+)
+
+// Feature 依赖服务器版本或拓扑的功能
+type Feature string
+
+const (
+	FeatureTransactions         Feature = "transactions"
+	FeatureChangeStreams        Feature = "change streams"
+	FeatureClusterChangeStreams Feature = "database and deployment change streams"
+	FeatureTimeSeries           Feature = "time series collections"
+	FeatureMerge                Feature = "$merge"
+	FeatureClusteredCollections Feature = "clustered collections"
+	FeatureWildcardIndexes      Feature = "wildcard indexes"
+)
+
+// Capabilities 服务器支持的功能，连接时检测并缓存
+type Capabilities struct {
+	// 服务器版本
+	Version Version
+	// 部署拓扑
+	Topology Topology
+	// 是否支持多文档事务，副本集需 4.0 及以上，分片集群需 4.2 及以上
+	Transactions bool
+	// 是否支持 change stream，需副本集或分片集群且 3.6 及以上
+	ChangeStreams bool
+	// 是否支持数据库及整个部署的 change stream，需副本集或分片集群且 4.0 及以上
+	ClusterChangeStreams bool
+	// 是否支持时间序列 collection，需 5.0 及以上
+	TimeSeries bool
+	// 是否支持 $merge 聚合阶段，需 4.2 及以上
+	Merge bool
+	// 是否支持聚簇 collection，需 5.3 及以上
+	ClusteredCollections bool
+	// 是否支持通配符索引，需 4.2 及以上
+	WildcardIndexes bool
+}
+
+// NewCapabilities 按服务器版本及拓扑计算支持的功能
+//
+//	@param version 服务器版本
+//	@param topology 部署拓扑
+func NewCapabilities(version Version, topology Topology) Capabilities {
+	clustered := topology == TopologyReplicaSet || topology == TopologySharded
+
+	return Capabilities{
+		Version:  version,
+		Topology: topology,
+		Transactions: (topology == TopologyReplicaSet && version.AtLeast(4, 0)) ||
+			(topology == TopologySharded && version.AtLeast(4, 2)),
+		ChangeStreams:        clustered && version.AtLeast(3, 6),
+		ClusterChangeStreams: clustered && version.AtLeast(4, 0),
+		TimeSeries:           version.AtLeast(5, 0),
+		Merge:                version.AtLeast(4, 2),
+		ClusteredCollections: version.AtLeast(5, 3),
+		WildcardIndexes:      version.AtLeast(4, 2),
+	}
+}
+
+// Supports 判断是否支持功能
+func (c Capabilities) Supports(f Feature) bool {
+	switch f {
+	case FeatureTransactions:
+		return c.Transactions
+	case FeatureChangeStreams:
+		return c.ChangeStreams
+	case FeatureClusterChangeStreams:
+		return c.ClusterChangeStreams
+	case FeatureTimeSeries:
+		return c.TimeSeries
+	case FeatureMerge:
+		return c.Merge
+	case FeatureClusteredCollections:
+		return c.ClusteredCollections
+	case FeatureWildcardIndexes:
+		return c.WildcardIndexes
+	}
+
+	return false
+}
+
+// Require 检查是否支持功能，不支持时返回 *FeatureError
+func (c Capabilities) Require(f Feature) error {
+	if c.Supports(f) {
+		return nil
+	}
+
+	return &FeatureError{Feature: f, Reason: c.reason(f)}
+}
+
+func (c Capabilities) reason(f Feature) string {
+	min := map[Feature]Version{
+		FeatureChangeStreams:        {Major: 3, Minor: 6},
+		FeatureClusterChangeStreams: {Major: 4},
+		FeatureTimeSeries:           {Major: 5},
+		FeatureMerge:                {Major: 4, Minor: 2},
+		FeatureClusteredCollections: {Major: 5, Minor: 3},
+		FeatureWildcardIndexes:      {Major: 4, Minor: 2},
+	}
+
+	switch f {
+	case FeatureTransactions:
+		switch c.Topology {
+		case TopologyReplicaSet:
+			min[f] = Version{Major: 4}
+		case TopologySharded:
+			min[f] = Version{Major: 4, Minor: 2}
+		default:
+			return fmt.Sprintf("requires a replica set or sharded cluster, server is %s", c.Topology)
+		}
+	case FeatureChangeStreams, FeatureClusterChangeStreams:
+		if c.Topology != TopologyReplicaSet && c.Topology != TopologySharded {
+			return fmt.Sprintf("requires a replica set or sharded cluster, server is %s", c.Topology)
+		}
+	}
+
+	return fmt.Sprintf("requires server version %d.%d or later, server is %s", min[f].Major, min[f].Minor, c.Version)
+}
+
+// FeatureError 服务器不支持功能的错误
+//
+//	事务不支持时 errors.Is(err, ErrTransactionNotSupported) 成立，其他功能 errors.Is(err, ErrFeatureNotSupported) 成立
+type FeatureError struct {
+	// 不支持的功能
+	Feature Feature
+	// 不支持的原因
+	Reason string
+}
+
+func (e *FeatureError) Error() string {
+	return fmt.Sprintf("%s not supported: %s", e.Feature, e.Reason)
+}
+
+func (e *FeatureError) Unwrap() error {
+	if e.Feature == FeatureTransactions {
+		return ErrTransactionNotSupported
+	}
+
+	return ErrFeatureNotSupported
+}
+
+// detectInterval 检测失败后再次检测的最短间隔
+const detectInterval = 30 * time.Second
+
+// capabilityCache 缓存的服务器信息，检测失败时间隔 detectInterval 后使用时再检测
+//
+//	检测期间不持有锁，同一时刻只有一个检测，其他调用方等待该检测的结果
+type capabilityCache struct {
+	client *mongo.Client
+
+	mu       sync.Mutex
+	version  string
+	caps     *Capabilities
+	detected time.Time
+	err      error
+	// 检测进行中时非 nil，检测结束后关闭
+	detecting chan struct{}
+}
+
+// get 获取缓存的服务器功能，未检测成功时尝试检测
+func (c *capabilityCache) get(ctx context.Context) (Capabilities, error) {
+	c.mu.Lock()
+	if c.caps != nil {
+		caps := *c.caps
+		c.mu.Unlock()
+		return caps, nil
+	}
+	if c.err != nil && time.Since(c.detected) < detectInterval {
+		err := c.err
+		c.mu.Unlock()
+		return Capabilities{}, err
+	}
+	c.mu.Unlock()
+
+	return c.detect(ctx)
+}
+
+// serverVersion 获取缓存的服务器版本，未检测成功时尝试检测
+func (c *capabilityCache) serverVersion(ctx context.Context) (string, error) {
+	if _, err := c.get(ctx); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.version, nil
+}
+
+// refresh 重新检测服务器功能
+func (c *capabilityCache) refresh(ctx context.Context) (Capabilities, error) {
+	return c.detect(ctx)
+}
+
+// detect 检测服务器功能，已有检测进行中时等待其结果
+func (c *capabilityCache) detect(ctx context.Context) (Capabilities, error) {
+	c.mu.Lock()
+	if wait := c.detecting; wait != nil {
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Capabilities{}, ctx.Err()
+		case <-wait:
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.err != nil || c.caps == nil {
+			return Capabilities{}, c.err
+		}
+		return *c.caps, nil
+	}
+
+	done := make(chan struct{})
+	c.detecting = done
+	c.mu.Unlock()
+
+	version, caps, err := c.fetch(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.detected, c.err, c.detecting = time.Now(), err, nil
+	if err == nil {
+		c.version, c.caps = version, &caps
+	}
+	close(done)
+
+	return caps, err
+}
+
+// fetch 通过 buildInfo 及 hello 获取服务器版本及部署方式
+func (c *capabilityCache) fetch(ctx context.Context) (string, Capabilities, error) {
+	var buildInfo struct {
+		Version string `bson:"version"`
+	}
+	err := c.client.Database("admin").RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&buildInfo)
+	if err != nil {
+		return "", Capabilities{}, err
+	}
+
+	version, err := ParseVersion(buildInfo.Version)
+	if err != nil {
+		return "", Capabilities{}, err
+	}
+
+	res, err := hello(ctx, c.client)
+	if err != nil {
+		return "", Capabilities{}, err
+	}
+
+	topology := TopologyStandalone
+	switch {
+	case res.Msg == "isdbgrid":
+		topology = TopologySharded
+	case res.SetName != "":
+		topology = TopologyReplicaSet
+	}
+
+	return buildInfo.Version, NewCapabilities(version, topology), nil
+}
+
+type helloResult struct {
+	IsWritablePrimary bool   `bson:"isWritablePrimary"`
+	IsMaster          bool   `bson:"ismaster"`
+	SetName           string `bson:"setName"`
+	Primary           string `bson:"primary"`
+	Me                string `bson:"me"`
+	Msg               string `bson:"msg"`
+}
+
+// hello 在任意可达节点执行 hello，旧版本服务器使用 isMaster
+func hello(ctx context.Context, client *mongo.Client) (res helloResult, err error) {
+	admin := client.Database("admin")
+	runOpts := options.RunCmd().SetReadPreference(readpref.Nearest())
+
+	err = admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}, runOpts).Decode(&res)
+	if hasErrorCode(err, codeCommandNotFound) {
+		err = admin.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}, runOpts).Decode(&res)
+	}
+
+	return
+}
+
+// require 检查服务器是否支持功能，服务器信息未知时不检查，由服务器返回错误
+func (e *executor) require(ctx context.Context, f Feature) error {
+	if e == nil || e.caps == nil {
+		return nil
+	}
+
+	caps, err := e.caps.get(ctx)
+	if err != nil {
+		return nil
+	}
+
+	return caps.Require(f)
+}
@@ -0,0 +1,315 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	opts "xtravisions.com/xmgo/options"
+)
+
+// change stream 事件类型
+const (
+	OperationInsert       = "insert"
+	OperationUpdate       = "update"
+	OperationReplace      = "replace"
+	OperationDelete       = "delete"
+	OperationDrop         = "drop"
+	OperationRename       = "rename"
+	OperationDropDatabase = "dropDatabase"
+	OperationInvalidate   = "invalidate"
+)
+
+// Watcher 可监听 change stream 的对象，如 ICollection、IDatabase 及 IClient
+type Watcher interface {
+	WatchWithCtx(ctx context.Context, pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error)
+}
+
+// MatchNamespaces 生成按数据库及 collection 过滤事件的 $match 阶段
+//
+//	Collection 为空时匹配该数据库的全部 collection，namespaces 为空时不过滤
+//	@param namespaces 需要监听的命名空间
+func MatchNamespaces(namespaces ...Namespace) D {
+	if len(namespaces) == 0 {
+		return D{{Key: "$match", Value: M{}}}
+	}
+
+	or := make(A, 0, len(namespaces))
+	for _, ns := range namespaces {
+		if ns.Collection == "" {
+			or = append(or, M{"ns.db": ns.Database})
+		} else {
+			or = append(or, M{"ns.db": ns.Database, "ns.coll": ns.Collection})
+		}
+	}
+
+	return D{{Key: "$match", Value: M{"$or": or}}}
+}
+
+// MatchOperationTypes 生成按事件类型过滤事件的 $match 阶段
+//
+//	@param types 需要监听的事件类型，参见 OperationInsert 等，为空时不过滤
+func MatchOperationTypes(types ...string) D {
+	if len(types) == 0 {
+		return D{{Key: "$match", Value: M{}}}
+	}
+
+	return D{{Key: "$match", Value: M{"operationType": M{"$in": types}}}}
+}
+
+// Namespace 事件所属的数据库及 collection
+type Namespace struct {
+	Database   string `bson:"db"`
+	Collection string `bson:"coll,omitempty"`
+}
+
+// UpdateDescription update 事件的修改内容
+type UpdateDescription struct {
+	// 修改的字段及修改后的值
+	UpdatedFields bson.Raw `bson:"updatedFields"`
+	// 删除的字段
+	RemovedFields []string `bson:"removedFields"`
+	// 被截断的数组，需 5.0 及以上
+	TruncatedArrays []bson.Raw `bson:"truncatedArrays,omitempty"`
+}
+
+// ChangeEvent change stream 事件，T 为 fullDocument 的类型
+type ChangeEvent[T any] struct {
+	// resume token
+	ID bson.Raw `bson:"_id"`
+	// 事件类型，参见 OperationInsert 等
+	OperationType string    `bson:"operationType"`
+	Namespace     Namespace `bson:"ns"`
+	// 文档的 _id 及分片键
+	DocumentKey bson.Raw `bson:"documentKey,omitempty"`
+	// 完整文档，insert、replace 事件或设置 FullDocument 参数的 update 事件时存在
+	FullDocument *T `bson:"fullDocument,omitempty"`
+	// update 事件的修改内容
+	UpdateDescription *UpdateDescription  `bson:"updateDescription,omitempty"`
+	ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+}
+
+// WatchOptions 类型化 change stream 配置
+type WatchOptions struct {
+	// 源生 change stream 参数，如 SetFullDocument
+	ChangeStream *options.ChangeStreamOptions
+	// resume token 存储，设置后启动时从保存的位置继续监听
+	Store ResumeTokenStore
+	// resume token 存储的键，同一存储中标识不同的消费者
+	Key string
+	// 自动提交，调用 Next 时保存上一个事件的 resume token，关闭时保存当前事件的 resume token
+	//	默认为 false，需调用 Commit 保存
+	AutoCommit bool
+	// 连接中断等瞬时错误时重新打开 change stream 的重试策略，MaxAttempts 为连续失败的最大次数
+	//	默认为 DefaultRetryPolicy
+	Retry *RetryPolicy
+}
+
+// ChangeStream 类型化 change stream，瞬时错误时从最近的 resume token 自动恢复
+type ChangeStream[T any] struct {
+	source     Watcher
+	pipeline   interface{}
+	csOpts     *options.ChangeStreamOptions
+	store      ResumeTokenStore
+	key        string
+	autoCommit bool
+	retry      *RetryPolicy
+
+	stream    *mongo.ChangeStream
+	event     ChangeEvent[T]
+	token     bson.Raw
+	committed bson.Raw
+	// token 来自 invalidate 事件，无法通过 ResumeAfter 恢复，需使用 StartAfter
+	invalidated bool
+	err         error
+}
+
+// invalidatedToken 保存 invalidate 事件的 resume token 时的包装，重新打开时使用 StartAfter
+type invalidatedToken struct {
+	StartAfter bson.Raw `bson:"startAfter"`
+}
+
+// NewChangeStream 打开类型化 change stream
+//
+//	@param ctx 上下文
+//	@param source 监听对象，如 ICollection、IDatabase 及 IClient
+//	@param pipeline 过滤事件的聚合管道，为 nil 时监听全部事件
+//	@param o 配置
+func NewChangeStream[T any](ctx context.Context, source Watcher, pipeline interface{}, o ...WatchOptions) (*ChangeStream[T], error) {
+	s := &ChangeStream[T]{
+		source:   source,
+		pipeline: pipeline,
+		csOpts:   options.ChangeStream(),
+		retry:    DefaultRetryPolicy(),
+	}
+	if s.pipeline == nil {
+		s.pipeline = A{}
+	}
+
+	if len(o) > 0 {
+		if o[0].ChangeStream != nil {
+			s.csOpts = o[0].ChangeStream
+		}
+		if o[0].Retry != nil {
+			s.retry = o[0].Retry
+		}
+		s.store, s.key, s.autoCommit = o[0].Store, o[0].Key, o[0].AutoCommit
+	}
+
+	if s.store != nil {
+		token, err := s.store.Load(ctx, s.key)
+		if err != nil {
+			return nil, err
+		}
+		if v, lErr := token.LookupErr("startAfter"); lErr == nil {
+			if doc, ok := v.DocumentOK(); ok {
+				token, s.invalidated = bson.Raw(doc), true
+			}
+		}
+		s.token, s.committed = token, token
+	}
+
+	if err := s.open(ctx); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// open 打开 change stream，存在 resume token 时从该位置继续
+//
+//	invalidate 事件的 resume token 不能用于 ResumeAfter，改用 StartAfter（需 4.2 及以上）
+func (s *ChangeStream[T]) open(ctx context.Context) error {
+	csOpts := *s.csOpts
+	if s.token != nil {
+		if s.invalidated {
+			csOpts.SetStartAfter(s.token)
+			csOpts.ResumeAfter = nil
+		} else {
+			csOpts.SetResumeAfter(s.token)
+			csOpts.StartAfter = nil
+		}
+		csOpts.StartAtOperationTime = nil
+	}
+
+	stream, err := s.source.WatchWithCtx(ctx, s.pipeline, &opts.ChangeStreamOptions{ChangeStreamOptions: &csOpts})
+	if err != nil {
+		return err
+	}
+
+	s.stream = stream
+	return nil
+}
+
+// Next 等待下一个事件，返回 false 时通过 Err 获取原因
+//
+//	连接中断等瞬时错误时按重试策略重新打开 change stream，从最近的 resume token 继续
+func (s *ChangeStream[T]) Next(ctx context.Context) bool {
+	if s.autoCommit && s.token != nil {
+		if s.err = s.Commit(ctx); s.err != nil {
+			return false
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		if s.stream != nil {
+			if s.stream.Next(ctx) {
+				s.event = ChangeEvent[T]{}
+				if s.err = s.stream.Decode(&s.event); s.err != nil {
+					return false
+				}
+				s.token = s.stream.ResumeToken()
+				s.invalidated = s.event.OperationType == OperationInvalidate
+				return true
+			}
+
+			if token := s.stream.ResumeToken(); token != nil && !bytes.Equal(token, s.token) {
+				s.token, s.invalidated = token, false
+			}
+			s.err = s.stream.Err()
+			_ = s.stream.Close(context.Background())
+			s.stream = nil
+		}
+
+		if s.err == nil || ctx.Err() != nil || attempt >= s.retry.MaxAttempts || !s.retry.Retryable(s.err, true) {
+			if ctx.Err() != nil {
+				s.err = ctx.Err()
+			}
+			return false
+		}
+
+		select {
+		case <-ctx.Done():
+			s.err = ctx.Err()
+			return false
+		case <-time.After(s.retry.Backoff(attempt)):
+		}
+
+		s.err = s.open(ctx)
+	}
+}
+
+// Event 获取 Next 返回的当前事件
+func (s *ChangeStream[T]) Event() ChangeEvent[T] {
+	return s.event
+}
+
+// Err 获取 Next 返回 false 的原因
+func (s *ChangeStream[T]) Err() error {
+	return s.err
+}
+
+// ResumeToken 获取当前位置的 resume token
+func (s *ChangeStream[T]) ResumeToken() bson.Raw {
+	return s.token
+}
+
+// Commit 保存当前位置的 resume token，未设置存储或无新事件时无效
+//
+//	invalidate 事件的 resume token 保存为 {startAfter: token}，重新打开时使用 StartAfter
+func (s *ChangeStream[T]) Commit(ctx context.Context) error {
+	if s.store == nil || s.token == nil || bytes.Equal(s.token, s.committed) {
+		return nil
+	}
+
+	token := s.token
+	if s.invalidated {
+		var err error
+		if token, err = bson.Marshal(invalidatedToken{StartAfter: s.token}); err != nil {
+			return err
+		}
+	}
+
+	if err := s.store.Save(ctx, s.key, token); err != nil {
+		return err
+	}
+	s.committed = s.token
+
+	return nil
+}
+
+// Close 关闭 change stream，AutoCommit 时保存当前位置
+func (s *ChangeStream[T]) Close(ctx context.Context) error {
+	var err error
+	if s.autoCommit {
+		err = s.Commit(ctx)
+	}
+
+	if s.stream != nil {
+		if cErr := s.stream.Close(ctx); cErr != nil && err == nil {
+			err = cErr
+		}
+		s.stream = nil
+	}
+
+	return err
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	opts "xtravisions.com/xmgo/options"
+)
+
+var errWatch = errors.New("watch")
+
+// recordingWatcher 记录打开 change stream 时的参数
+type recordingWatcher struct {
+	opts *opts.ChangeStreamOptions
+}
+
+func (w *recordingWatcher) WatchWithCtx(_ context.Context, _ interface{}, o ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	w.opts = o[0]
+	return nil, errWatch
+}
+
+func TestChangeStreamResumeFromStore(t *testing.T) {
+	ctx := context.Background()
+	token, _ := bson.Marshal(bson.M{"_data": "8263A1"})
+
+	store := NewMemoryTokenStore()
+	_ = store.Save(ctx, "plain", token)
+	wrapped, _ := bson.Marshal(invalidatedToken{StartAfter: token})
+	_ = store.Save(ctx, "invalidated", wrapped)
+
+	w := &recordingWatcher{}
+	if _, err := NewChangeStream[M](ctx, w, nil, WatchOptions{Store: store, Key: "plain"}); !errors.Is(err, errWatch) {
+		t.Fatalf("NewChangeStream() error = %v", err)
+	}
+	if o := w.opts.ChangeStreamOptions; o.StartAfter != nil || !bytes.Equal(o.ResumeAfter.(bson.Raw), token) {
+		t.Errorf("ordinary token: ResumeAfter = %v, StartAfter = %v, want ResumeAfter", o.ResumeAfter, o.StartAfter)
+	}
+
+	if _, err := NewChangeStream[M](ctx, w, nil, WatchOptions{Store: store, Key: "invalidated"}); !errors.Is(err, errWatch) {
+		t.Fatalf("NewChangeStream() error = %v", err)
+	}
+	if o := w.opts.ChangeStreamOptions; o.ResumeAfter != nil || !bytes.Equal(o.StartAfter.(bson.Raw), token) {
+		t.Errorf("invalidate token: ResumeAfter = %v, StartAfter = %v, want StartAfter", o.ResumeAfter, o.StartAfter)
+	}
+}
+
+func TestChangeStreamCommitInvalidated(t *testing.T) {
+	ctx := context.Background()
+	token, _ := bson.Marshal(bson.M{"_data": "8263A1"})
+	store := NewMemoryTokenStore()
+
+	s := &ChangeStream[M]{store: store, key: "k", token: token, invalidated: true}
+	if err := s.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, _ := store.Load(ctx, "k")
+	if v, err := saved.LookupErr("startAfter"); err != nil || !bytes.Equal(v.Document(), token) {
+		t.Errorf("saved = %s, want {startAfter: %s}", saved, bson.Raw(token))
+	}
+}
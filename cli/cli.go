@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+// Package cli xmgo 命令行工具
+//
+//	cmd/xmgo 提供通用的命令行入口，需要执行版本迁移的服务可以在自己的 main 包中
+//	引入迁移所在的包后调用 Main，从而使用同一套子命令
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"xtravisions.com/xmgo"
+)
+
+// Version 命令行工具版本
+const Version = "1.0.0"
+
+// Env 子命令执行环境
+type Env struct {
+	Config   *xmgo.Config
+	Database string
+	Timeout  time.Duration
+	Stdout   io.Writer
+	Stderr   io.Writer
+
+	client *xmgo.Client
+}
+
+// Client 获取 mongodb 连接，首次调用时创建
+func (e *Env) Client() (*xmgo.Client, error) {
+	if e.client != nil {
+		return e.client, nil
+	}
+
+	if e.Config.Uri == "" {
+		return nil, fmt.Errorf("mongodb uri is required, use -uri, -config or %s", envUri)
+	}
+
+	e.client = xmgo.NewClient(e.Config)
+	if e.client == nil {
+		return nil, fmt.Errorf("connect to mongodb failed")
+	}
+
+	return e.client, nil
+}
+
+// DB 获取 -db 指定的数据库
+func (e *Env) DB() (*xmgo.Database, error) {
+	if e.Database == "" {
+		return nil, fmt.Errorf("database is required, use -db or %s", envDatabase)
+	}
+
+	cli, err := e.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	return cli.Database(e.Database), nil
+}
+
+// Context 创建带超时的上下文
+func (e *Env) Context() (context.Context, context.CancelFunc) {
+	if e.Timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), e.Timeout)
+}
+
+func (e *Env) close() {
+	if e.client != nil {
+		_ = e.client.Close()
+	}
+}
+
+// Command 子命令
+type Command struct {
+	Name  string
+	Usage string
+	Run   func(env *Env, args []string) error
+}
+
+var commands = make(map[string]Command, 0)
+
+// Register 注册子命令
+func Register(cmd Command) {
+	commands[cmd.Name] = cmd
+}
+
+// Main 解析参数并执行子命令，返回进程退出码
+func Main(args []string) int {
+	env := &Env{Stdout: os.Stdout, Stderr: os.Stderr}
+
+	fs := flag.NewFlagSet("xmgo", flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	configFile := fs.String("config", os.Getenv(envConfig), "config file (json)")
+	uri := fs.String("uri", "", "mongodb connection string")
+	fs.StringVar(&env.Database, "db", "", "database name")
+	fs.DurationVar(&env.Timeout, "timeout", 0, "operation timeout, 0 means no timeout")
+	fs.Usage = func() { usage(env.Stderr, fs) }
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	conf, err := LoadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintln(env.Stderr, "xmgo:", err)
+		return 1
+	}
+	if *uri != "" {
+		conf.Uri = *uri
+	}
+	if env.Database == "" {
+		env.Database = os.Getenv(envDatabase)
+	}
+	env.Config = conf
+
+	rest := fs.Args()
+	if len(rest) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	cmd, ok := commands[rest[0]]
+	if !ok {
+		fmt.Fprintf(env.Stderr, "xmgo: unknown command %q\n", rest[0])
+		fs.Usage()
+		return 2
+	}
+
+	defer env.close()
+	if err = cmd.Run(env, rest[1:]); err != nil {
+		fmt.Fprintf(env.Stderr, "xmgo %s: %v\n", cmd.Name, err)
+		return 1
+	}
+
+	return 0
+}
+
+func usage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: xmgo [flags] <command> [args]")
+	fmt.Fprintln(w, "\nCommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-12s %s\n", name, commands[name].Usage)
+	}
+
+	fmt.Fprintln(w, "\nFlags:")
+	fs.PrintDefaults()
+}
+
+// subcommand 解析二级子命令
+func subcommand(args []string, names ...string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("expect one of: %s", strings.Join(names, ", "))
+	}
+	for _, n := range names {
+		if args[0] == n {
+			return n, args[1:], nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("unknown subcommand %q, expect one of: %s", args[0], strings.Join(names, ", "))
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"text/tabwriter"
+
+	"xtravisions.com/xmgo"
+)
+
+func init() {
+	Register(Command{Name: "collections", Usage: "list|stats [name...], inspect collections of the database", Run: runCollections})
+}
+
+type collStats struct {
+	Count          int64 `bson:"count"`
+	Size           int64 `bson:"size"`
+	StorageSize    int64 `bson:"storageSize"`
+	NIndexes       int64 `bson:"nindexes"`
+	TotalIndexSize int64 `bson:"totalIndexSize"`
+}
+
+func runCollections(env *Env, args []string) error {
+	sub, args, err := subcommand(args, "list", "stats")
+	if err != nil {
+		return err
+	}
+
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := env.Context()
+	defer cancel()
+
+	names := args
+	if len(names) == 0 {
+		if names, err = db.CollectionNamesWithCtx(ctx); err != nil {
+			return err
+		}
+	}
+	sort.Strings(names)
+
+	if sub == "list" {
+		for _, name := range names {
+			fmt.Fprintln(env.Stdout, name)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(env.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "COLLECTION\tCOUNT\tSIZE\tSTORAGE\tINDEXES\tINDEX SIZE\t")
+	for _, name := range names {
+		var s collStats
+		if err = db.RunCommandWithCtx(ctx, xmgo.D{{Key: "collStats", Value: name}}).Decode(&s); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t\n", name, s.Count, s.Size, s.StorageSize, s.NIndexes, s.TotalIndexSize)
+	}
+
+	return w.Flush()
+}
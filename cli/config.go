@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"os"
+
+	"xtravisions.com/xmgo"
+)
+
+const (
+	envConfig   = "XMGO_CONFIG"
+	envUri      = "XMGO_URI"
+	envDatabase = "XMGO_DATABASE"
+	envUsername = "XMGO_USERNAME"
+	envPassword = "XMGO_PASSWORD"
+)
+
+// LoadConfig 从 json 配置文件及环境变量加载连接配置
+//
+//	环境变量优先于配置文件：XMGO_URI、XMGO_USERNAME、XMGO_PASSWORD
+//	@param file 配置文件路径，为空时仅使用环境变量
+func LoadConfig(file string) (*xmgo.Config, error) {
+	conf := &xmgo.Config{}
+
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, conf); err != nil {
+			return nil, err
+		}
+	}
+
+	if v := os.Getenv(envUri); v != "" {
+		conf.Uri = v
+	}
+
+	username, password := os.Getenv(envUsername), os.Getenv(envPassword)
+	if username != "" || password != "" {
+		if conf.Auth == nil {
+			conf.Auth = &xmgo.Credential{}
+		}
+		if username != "" {
+			conf.Auth.Username = username
+		}
+		if password != "" {
+			conf.Auth.Password = password
+		}
+	}
+
+	return conf, nil
+}
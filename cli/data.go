@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	opts "xtravisions.com/xmgo/options"
+)
+
+func init() {
+	Register(Command{Name: "export", Usage: "-c collection [-out file] [-query json] [-array] [-canonical], export documents as extended json", Run: runExport})
+	Register(Command{Name: "import", Usage: "-c collection [-in file] [-upsert keys] [-batch n], import extended json documents", Run: runImport})
+}
+
+func runExport(env *Env, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	collection := fs.String("c", "", "collection name")
+	out := fs.String("out", "", "output file, default stdout")
+	query := fs.String("query", "", "query filter (extended json)")
+	sort := fs.String("sort", "", "sort fields, comma separated, prefix - for descending")
+	limit := fs.Int64("limit", 0, "maximum number of documents")
+	array := fs.Bool("array", false, "write a json array instead of ndjson")
+	canonical := fs.Bool("canonical", false, "use canonical extended json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *collection == "" {
+		return fmt.Errorf("-c is required")
+	}
+
+	filter := bson.D{}
+	if *query != "" {
+		if err := bson.UnmarshalExtJSON([]byte(*query), false, &filter); err != nil {
+			return fmt.Errorf("invalid query: %w", err)
+		}
+	}
+
+	eo := opts.ExportOptions{Canonical: *canonical, Limit: *limit}
+	if *array {
+		eo.Format = opts.FormatJSONArray
+	}
+	if *sort != "" {
+		var s bson.D
+		for _, f := range strings.Split(*sort, ",") {
+			if strings.HasPrefix(f, "-") {
+				s = append(s, bson.E{Key: f[1:], Value: -1})
+			} else {
+				s = append(s, bson.E{Key: strings.TrimPrefix(f, "+"), Value: 1})
+			}
+		}
+		eo.Sort = s
+	}
+
+	var w io.Writer = env.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+		eo.Progress = func(n int64) {
+			fmt.Fprintf(env.Stderr, "\rexported %d", n)
+		}
+	}
+
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := env.Context()
+	defer cancel()
+
+	n, err := db.Collection(*collection).Export(ctx, w, filter, eo)
+	if *out != "" {
+		fmt.Fprintf(env.Stderr, "\rexported %d documents\n", n)
+	}
+
+	return err
+}
+
+func runImport(env *Env, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	collection := fs.String("c", "", "collection name")
+	in := fs.String("in", "", "input file, default stdin")
+	upsert := fs.String("upsert", "", "upsert by keys, comma separated")
+	batch := fs.Int("batch", 1000, "documents per batch")
+	ordered := fs.Bool("ordered", false, "stop at the first write error")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *collection == "" {
+		return fmt.Errorf("-c is required")
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	im := opts.ImportOptions{
+		BatchSize: *batch,
+		Ordered:   *ordered,
+		Progress: func(n int64) {
+			fmt.Fprintf(env.Stderr, "\rimported %d", n)
+		},
+	}
+	if *upsert != "" {
+		im.UpsertKeys = strings.Split(*upsert, ",")
+	}
+
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := env.Context()
+	defer cancel()
+
+	res, err := db.Collection(*collection).Import(ctx, r, im)
+	if res != nil {
+		fmt.Fprintf(env.Stderr, "\rread %d, inserted %d, upserted %d, modified %d\n",
+			res.ReadCount, res.InsertedCount, res.UpsertedCount, res.ModifiedCount)
+	}
+
+	return err
+}
@@ -0,0 +1,355 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"xtravisions.com/xmgo"
+	opts "xtravisions.com/xmgo/options"
+)
+
+// codeNamespaceNotFound collection 不存在
+const codeNamespaceNotFound = 26
+
+// defaultLanguage 全文索引未指定语言时服务器使用的默认语言
+const defaultLanguage = "english"
+
+func init() {
+	Register(Command{Name: "indexes", Usage: "sync|diff -file spec.json [-prune], sync indexes with a spec file", Run: runIndexes})
+}
+
+// indexSpec 索引定义文件中的索引
+//
+//	文件格式为 collection 名称到索引列表的映射，例如
+//	{"users": [{"key": ["+email"], "unique": true}, {"key": ["$text:bio"]}]}
+type indexSpec struct {
+	Key                []string               `json:"key"`
+	Name               string                 `json:"name"`
+	Unique             bool                   `json:"unique"`
+	Sparse             bool                   `json:"sparse"`
+	ExpireAfterSeconds *int32                 `json:"expireAfterSeconds"`
+	Partial            map[string]interface{} `json:"partialFilterExpression"`
+	Weights            map[string]int32       `json:"weights"`
+	DefaultLanguage    string                 `json:"defaultLanguage"`
+}
+
+func (s indexSpec) options() opts.IndexOptions {
+	o := options.Index()
+	if s.Name != "" {
+		o.SetName(s.Name)
+	}
+	if s.Unique {
+		o.SetUnique(true)
+	}
+	if s.Sparse {
+		o.SetSparse(true)
+	}
+	if s.ExpireAfterSeconds != nil {
+		o.SetExpireAfterSeconds(*s.ExpireAfterSeconds)
+	}
+	if s.Partial != nil {
+		o.SetPartialFilterExpression(s.Partial)
+	}
+	if s.Weights != nil {
+		o.SetWeights(s.Weights)
+	}
+	if s.DefaultLanguage != "" {
+		o.SetDefaultLanguage(s.DefaultLanguage)
+	}
+
+	return opts.IndexOptions{Key: s.Key, IndexOptions: o}
+}
+
+// existingIndex 服务器上已存在的索引
+type existingIndex struct {
+	Name               string   `bson:"name"`
+	Key                bson.D   `bson:"key"`
+	Unique             bool     `bson:"unique"`
+	Sparse             bool     `bson:"sparse"`
+	ExpireAfterSeconds *int32   `bson:"expireAfterSeconds"`
+	Partial            bson.Raw `bson:"partialFilterExpression"`
+	Weights            bson.Raw `bson:"weights"`
+	DefaultLanguage    string   `bson:"default_language"`
+}
+
+// listIndexes 获取 collection 的全部索引
+//
+//	IndexSpecification 不包含部分索引过滤条件，因此直接执行 listIndexes 命令；
+//	单个 collection 最多 64 个索引，首批结果即包含全部索引；collection 不存在时返回空列表
+func listIndexes(ctx context.Context, db *xmgo.Database, name string) ([]existingIndex, error) {
+	var res struct {
+		Cursor struct {
+			FirstBatch []existingIndex `bson:"firstBatch"`
+		} `bson:"cursor"`
+	}
+	err := db.RunCommandWithCtx(ctx, bson.D{{Key: "listIndexes", Value: name}}).Decode(&res)
+	var se mongo.ServerError
+	if errors.As(err, &se) && se.HasErrorCode(codeNamespaceNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Cursor.FirstBatch, nil
+}
+
+type indexDiff struct {
+	missing []opts.IndexOptions
+	changed []opts.IndexOptions
+	extra   []string
+}
+
+func runIndexes(env *Env, args []string) error {
+	sub, args, err := subcommand(args, "sync", "diff")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("indexes "+sub, flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	file := fs.String("file", "", "index spec file (json)")
+	prune := fs.Bool("prune", false, "drop indexes not present in the spec file")
+	if err = fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	var specs map[string][]indexSpec
+	if err = json.Unmarshal(data, &specs); err != nil {
+		return err
+	}
+
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := env.Context()
+	defer cancel()
+
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		coll := db.Collection(name)
+
+		existing, err := listIndexes(ctx, db, name)
+		if err != nil {
+			return err
+		}
+
+		d := diffIndexes(specs[name], existing)
+		for _, idx := range d.missing {
+			fmt.Fprintf(env.Stdout, "+ %s.%s %v\n", name, xmgo.IndexName(idx), idx.Key)
+		}
+		for _, idx := range d.changed {
+			fmt.Fprintf(env.Stdout, "~ %s.%s %v\n", name, xmgo.IndexName(idx), idx.Key)
+		}
+		for _, idx := range d.extra {
+			fmt.Fprintf(env.Stdout, "- %s.%s\n", name, idx)
+		}
+
+		if sub != "sync" {
+			continue
+		}
+		// 同名索引的定义不同时无法直接创建，需先删除
+		for _, idx := range d.changed {
+			if err = coll.DropIndexByNameWithCtx(ctx, xmgo.IndexName(idx)); err != nil {
+				return err
+			}
+		}
+		if err = coll.CreateIndexesWithCtx(ctx, append(d.missing, d.changed...)); err != nil {
+			return err
+		}
+		if *prune {
+			for _, idx := range d.extra {
+				if err = coll.DropIndexByNameWithCtx(ctx, idx); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// diffIndexes 比较索引定义与已存在的索引
+//
+//	按名称匹配，名称相同但索引键、unique、sparse、TTL、部分索引过滤条件或全文索引的权重、默认语言不同时视为已修改
+func diffIndexes(specs []indexSpec, existing []existingIndex) indexDiff {
+	var d indexDiff
+
+	have := make(map[string]existingIndex, len(existing))
+	for _, idx := range existing {
+		have[idx.Name] = idx
+	}
+
+	want := make(map[string]bool, len(specs))
+	for _, s := range specs {
+		o := s.options()
+		name := xmgo.IndexName(o)
+		want[name] = true
+
+		idx, ok := have[name]
+		if !ok {
+			d.missing = append(d.missing, o)
+		} else if !sameIndex(s, idx) {
+			d.changed = append(d.changed, o)
+		}
+	}
+
+	for _, idx := range existing {
+		if idx.Name != "_id_" && !want[idx.Name] {
+			d.extra = append(d.extra, idx.Name)
+		}
+	}
+
+	return d
+}
+
+func sameIndex(s indexSpec, idx existingIndex) bool {
+	if s.Unique != idx.Unique || s.Sparse != idx.Sparse {
+		return false
+	}
+	if (s.ExpireAfterSeconds == nil) != (idx.ExpireAfterSeconds == nil) ||
+		s.ExpireAfterSeconds != nil && *s.ExpireAfterSeconds != *idx.ExpireAfterSeconds {
+		return false
+	}
+	if !samePartial(s.Partial, idx.Partial) || !sameText(s, idx) {
+		return false
+	}
+
+	return sameKeys(xmgo.IndexKeys(s.Key), idx.Key)
+}
+
+// sameKeys 比较索引键，数值类型不同但值相同时视为相同
+//
+//	全文索引在服务器上保存为 _fts、_ftsx 字段，仅比较非全文索引字段
+func sameKeys(want, have bson.D) bool {
+	want, have = withoutText(want), withoutText(have)
+	if len(want) != len(have) {
+		return false
+	}
+
+	for i := range want {
+		if want[i].Key != have[i].Key || !reflect.DeepEqual(normalize(want[i].Value), normalize(have[i].Value)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func withoutText(keys bson.D) bson.D {
+	res := make(bson.D, 0, len(keys))
+	for _, e := range keys {
+		if e.Value == xmgo.IndexText || e.Key == "_fts" || e.Key == "_ftsx" {
+			continue
+		}
+		res = append(res, e)
+	}
+
+	return res
+}
+
+// sameText 比较全文索引的权重及默认语言
+//
+//	服务器保存全部全文索引字段的权重，未指定权重的字段为 1，未指定默认语言时为 english
+func sameText(s indexSpec, idx existingIndex) bool {
+	want := make(map[string]interface{})
+	for _, e := range xmgo.IndexKeys(s.Key) {
+		if e.Value == xmgo.IndexText {
+			want[e.Key] = 1
+		}
+	}
+	if len(want) == 0 || len(idx.Weights) == 0 {
+		return len(want) == 0 && len(idx.Weights) == 0
+	}
+	for k, w := range s.Weights {
+		want[k] = w
+	}
+
+	lang := s.DefaultLanguage
+	if lang == "" {
+		lang = defaultLanguage
+	}
+	if idx.DefaultLanguage != lang {
+		return false
+	}
+
+	var have map[string]interface{}
+	if err := bson.Unmarshal(idx.Weights, &have); err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(normalize(want), normalize(have))
+}
+
+func samePartial(want map[string]interface{}, have bson.Raw) bool {
+	if len(have) == 0 {
+		return len(want) == 0
+	}
+
+	var doc map[string]interface{}
+	if err := bson.Unmarshal(have, &doc); err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(normalize(want), normalize(doc))
+}
+
+// normalize 将数值统一为 float64，文档统一为 map，以便比较 json 定义与服务器返回的值
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case bson.D:
+		return normalize(v.Map())
+	case bson.M:
+		return normalize(map[string]interface{}(v))
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			res[k] = normalize(e)
+		}
+		return res
+	case bson.A:
+		return normalize([]interface{}(v))
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, e := range v {
+			res[i] = normalize(e)
+		}
+		return res
+	}
+
+	return v
+}
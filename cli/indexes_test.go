@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package cli
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func textIndex(t *testing.T, weights bson.M, language string) existingIndex {
+	t.Helper()
+
+	raw, err := bson.Marshal(weights)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return existingIndex{
+		Name:            "bio_text",
+		Key:             bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+		Weights:         raw,
+		DefaultLanguage: language,
+	}
+}
+
+func TestSameIndexText(t *testing.T) {
+	spec := indexSpec{Key: []string{"$text:bio", "$text:title"}, Weights: map[string]int32{"title": 10}}
+
+	if !sameIndex(spec, textIndex(t, bson.M{"bio": int32(1), "title": int32(10)}, "english")) {
+		t.Error("sameIndex() = false for identical text index")
+	}
+	if sameIndex(spec, textIndex(t, bson.M{"bio": int32(1), "title": int32(1)}, "english")) {
+		t.Error("sameIndex() = true with different weights")
+	}
+	if sameIndex(spec, textIndex(t, bson.M{"bio": int32(1), "title": int32(10)}, "german")) {
+		t.Error("sameIndex() = true with different default_language")
+	}
+
+	spec.DefaultLanguage = "german"
+	if !sameIndex(spec, textIndex(t, bson.M{"bio": int32(1), "title": int32(10)}, "german")) {
+		t.Error("sameIndex() = false for identical text index with default_language")
+	}
+}
+
+func TestSameIndexTextAgainstPlainIndex(t *testing.T) {
+	plain := existingIndex{Name: "bio_1", Key: bson.D{{Key: "bio", Value: int32(1)}}}
+	if sameIndex(indexSpec{Key: []string{"$text:bio"}}, plain) {
+		t.Error("sameIndex() = true for text spec against plain index")
+	}
+	if !sameIndex(indexSpec{Key: []string{"bio"}}, plain) {
+		t.Error("sameIndex() = false for identical plain index")
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"xtravisions.com/xmgo/migrate"
+)
+
+func init() {
+	Register(Command{Name: "migrate", Usage: "up|down|status [-to id] [-all] [-collection name], run registered migrations", Run: runMigrate})
+}
+
+func runMigrate(env *Env, args []string) error {
+	sub, args, err := subcommand(args, "up", "down", "status")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("migrate "+sub, flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	collection := fs.String("collection", migrate.DefaultCollection, "collection storing migration state")
+	to := fs.String("to", "", "target migration id (up/down)")
+	all := fs.Bool("all", false, "roll back all applied migrations (down)")
+	if err = fs.Parse(args); err != nil {
+		return err
+	}
+
+	cli, err := env.Client()
+	if err != nil {
+		return err
+	}
+	if env.Database == "" {
+		return fmt.Errorf("database is required, use -db or %s", envDatabase)
+	}
+
+	m := migrate.New(cli, env.Database, migrate.Options{Collection: *collection})
+
+	ctx, cancel := env.Context()
+	defer cancel()
+
+	switch sub {
+	case "up":
+		if *to != "" {
+			err = m.To(ctx, *to)
+		} else {
+			err = m.Up(ctx)
+		}
+	case "down":
+		if *all && *to != "" {
+			return fmt.Errorf("-all and -to are mutually exclusive")
+		}
+		if *all || *to != "" {
+			err = m.To(ctx, *to)
+		} else {
+			err = m.Down(ctx)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if len(status) == 0 {
+		fmt.Fprintln(env.Stdout, "no migrations registered")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(env.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tAPPLIED\tAPPLIED AT\tDESCRIPTION")
+	for _, s := range status {
+		appliedAt := "-"
+		if s.Applied {
+			appliedAt = s.AppliedAt.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%t\t%s\t%s\n", s.ID, s.Applied, appliedAt, s.Description)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"time"
+)
+
+func init() {
+	Register(Command{Name: "ping", Usage: "check the connection to mongodb", Run: ping})
+	Register(Command{Name: "version", Usage: "print tool and server version", Run: version})
+}
+
+func ping(env *Env, _ []string) error {
+	cli, err := env.Client()
+	if err != nil {
+		return err
+	}
+
+	timeout := env.Timeout
+	if timeout < time.Second {
+		timeout = 10 * time.Second
+	}
+
+	start := time.Now()
+	if err = cli.Ping(int64(timeout / time.Second)); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(env.Stdout, "ok (%s)\n", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func version(env *Env, _ []string) error {
+	fmt.Fprintf(env.Stdout, "xmgo %s\n", Version)
+
+	if env.Config.Uri == "" {
+		return nil
+	}
+
+	cli, err := env.Client()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(env.Stdout, "server %s\n", cli.ServerVersion())
+	return nil
+}
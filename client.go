@@ -11,11 +11,11 @@ import (
 	"strings"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/tag"
 
 	opts "xtravisions.com/xmgo/options"
 )
@@ -38,6 +38,9 @@ type ReadPref struct {
 	// 读取操作偏好设置
 	// 	默认为 PrimaryMode
 	Mode readpref.Mode `json:"mode"`
+	// 节点标签集合，按顺序选择第一个匹配的标签集合
+	//	如 [{"dc": "east", "usage": "analytics"}, {}]
+	TagSets []map[string]string `json:"tagSets"`
 }
 
 // Config mongodb 连接配置
@@ -63,6 +66,35 @@ type Config struct {
 	SocketTimeoutMS *int64 `json:"socketTimeoutMS"`
 	// 只读操作服务器选择策略
 	ReadPreference *ReadPref `bson:"readPreference"`
+	// 瞬时错误重试策略
+	//	默认不重试，参见 RetryPolicy
+	Retry *RetryPolicy `json:"retry"`
+	// 熔断配置
+	//	默认不熔断，参见 CircuitBreakerConfig
+	CircuitBreaker *CircuitBreakerConfig `json:"circuitBreaker"`
+	// 各类操作的默认超时
+	//	默认不设置，操作受 SocketTimeoutMS 限制，参见 Timeouts
+	Timeouts *Timeouts `json:"timeouts"`
+	// 单节点服务器不支持事务时，不开启事务直接执行事务回调
+	//	仅用于本地开发，回调返回错误时已执行的写操作不会回滚
+	//	默认为 false，即返回 ErrTransactionNotSupported
+	TransactionBestEffort bool `json:"transactionBestEffort"`
+}
+
+// IClient mongodb 连接接口
+//
+//	Client 的 Database 返回具体类型，通过 Client.Interface 获取该接口的实现
+type IClient interface {
+	Close() error
+	Database(name string, o ...*opts.DatabaseOptions) IDatabase
+	Ping(timeout int64) error
+	PingWithCtx(ctx context.Context, rp ...*readpref.ReadPref) error
+	Session(opt ...*opts.SessionOptions) (*Session, error)
+	DoTransaction(callback func(sessCtx context.Context) (interface{}, error), opts ...*opts.TransactionOptions) (interface{}, error)
+	DoTransactionWithCtx(ctx context.Context, callback func(sessCtx context.Context) (interface{}, error), opts ...*opts.TransactionOptions) (interface{}, error)
+	ServerVersion() string
+	Watch(pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error)
+	WatchWithCtx(ctx context.Context, pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error)
 }
 
 // Client mongodb 连接
@@ -70,6 +102,7 @@ type Client struct {
 	client   *mongo.Client
 	registry *bsoncodec.Registry
 	conf     Config
+	exec     *executor
 }
 
 // NewClient 创建 mongodb 连接
@@ -93,6 +126,23 @@ func NewClient(conf *Config, o ...opts.ClientOptions) (cli *Client) {
 		client:   client,
 		conf:     *conf,
 		registry: opt.Registry,
+		exec: &executor{
+			retry:    conf.Retry,
+			timeouts: conf.Timeouts,
+			caps:     &capabilityCache{client: client},
+		},
+	}
+
+	if _, err := cli.exec.caps.refresh(context.Background()); err != nil {
+		fmt.Println("获取 MongoDB 服务器信息失败", err)
+	}
+
+	if conf.CircuitBreaker != nil {
+		cli.exec.breaker = NewCircuitBreaker(*conf.CircuitBreaker, func(from, to CircuitState) {
+			for _, cb := range onCircuitChanged[conf.Uri] {
+				cb.Fn(cli, from, to)
+			}
+		})
 	}
 
 	if actions, ok := onConnected[conf.Uri]; ok {
@@ -124,7 +174,7 @@ func (c *Client) Database(name string, o ...*opts.DatabaseOptions) *Database {
 		}
 	}
 
-	database := &Database{database: c.client.Database(name, opt), registry: c.registry}
+	database := &Database{database: c.client.Database(name, opt), registry: c.registry, exec: c.exec}
 
 	if cli, ok := onOpened[c.conf.Uri]; ok {
 		if actions, ok := cli[name]; ok {
@@ -139,6 +189,11 @@ func (c *Client) Database(name string, o ...*opts.DatabaseOptions) *Database {
 	return database
 }
 
+// CircuitBreaker 获取熔断器，未配置熔断时返回 nil
+func (c *Client) CircuitBreaker() *CircuitBreaker {
+	return c.exec.breaker
+}
+
 // Ping 确认连接是否可用
 //
 //	@param timeout 超时时间
@@ -146,9 +201,20 @@ func (c *Client) Ping(timeout int64) (err error) {
 	ctx, cancel := context.WithTimeout(context.TODO(), time.Duration(timeout)*time.Second)
 	defer cancel()
 
-	err = c.client.Ping(ctx, readpref.Primary())
+	return c.PingWithCtx(ctx)
+}
 
-	return
+// PingWithCtx 确认按读策略选择的节点是否可用
+//
+//	@param ctx 上下文
+//	@param rp 读策略，默认为 readpref.Primary()
+func (c *Client) PingWithCtx(ctx context.Context, rp ...*readpref.ReadPref) error {
+	pref := readpref.Primary()
+	if len(rp) > 0 && rp[0] != nil {
+		pref = rp[0]
+	}
+
+	return c.client.Ping(ctx, pref)
 }
 
 func (c *Client) Session(opt ...*opts.SessionOptions) (*Session, error) {
@@ -157,16 +223,37 @@ func (c *Client) Session(opt ...*opts.SessionOptions) (*Session, error) {
 		sessionOpts = opt[0].SessionOptions
 	}
 	s, err := c.client.StartSession(sessionOpts)
-	return &Session{session: s}, err
+	return &Session{session: s, client: c}, err
 }
 
 func (c *Client) DoTransaction(callback func(sessCtx context.Context) (interface{}, error), opts ...*opts.TransactionOptions) (interface{}, error) {
 	return c.DoTransactionWithCtx(context.TODO(), callback, opts...)
 }
 
+// DoTransactionWithCtx 在事务中执行回调
+//
+//	服务器不支持事务时返回 *FeatureError，errors.Is(err, ErrTransactionNotSupported) 成立，原因如单节点服务器或版本过低
+//	配置 TransactionBestEffort 时，单节点服务器上不开启事务直接执行回调
+//	在事务回调中调用时按 opts.TransactionOptions.Propagation 加入外层事务或开启新事务
 func (c *Client) DoTransactionWithCtx(ctx context.Context, callback func(sessCtx context.Context) (interface{}, error), opts ...*opts.TransactionOptions) (interface{}, error) {
-	if !c.transactionAllowed() {
-		return nil, ErrTransactionNotSupported
+	if handled, result, err := PropagateTransaction(ctx, callback, opts...); handled {
+		return result, err
+	}
+
+	supported := c.exec.require(ctx, FeatureTransactions)
+	if supported != nil && !c.bestEffort() {
+		return nil, supported
+	}
+
+	ctx, cancel := c.exec.timeout(ctx, opTransaction)
+	defer cancel()
+
+	if supported != nil {
+		ctx, callbacks := withBestEffortCallbacks(ctx)
+		result, err := callback(ctx)
+		err = callbacks.Check(err)
+		callbacks.Finish(err)
+		return result, err
 	}
 
 	s, err := c.Session()
@@ -178,25 +265,60 @@ func (c *Client) DoTransactionWithCtx(ctx context.Context, callback func(sessCtx
 	return s.StartTransaction(ctx, callback, opts...)
 }
 
-func (c *Client) ServerVersion() string {
-	var buildInfo bson.Raw
-	err := c.client.Database("admin").RunCommand(
-		context.Background(),
-		bson.D{{"buildInfo", 1}},
-	).Decode(&buildInfo)
+// Watch 使用默认上下文监听整个部署除 admin、local、config 外全部数据库的变更
+func (c *Client) Watch(pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return c.WatchWithCtx(context.TODO(), pipeline, opts...)
+}
 
-	if err != nil {
-		fmt.Println("尝试执行获取 mongodb 版本信息时出错", err)
-		return ""
+// WatchWithCtx 监听整个部署除 admin、local、config 外全部数据库的变更
+//
+//	可通过 MatchNamespaces、MatchOperationTypes 过滤事件
+//	@param ctx 上下文
+//	@param pipeline 过滤事件的聚合管道
+//	@param opts change stream 参数
+func (c *Client) WatchWithCtx(ctx context.Context, pipeline interface{}, opts ...*opts.ChangeStreamOptions) (cs *mongo.ChangeStream, err error) {
+	defer c.wrapErr(&err, "watch")
+
+	if err = c.exec.require(ctx, FeatureClusterChangeStreams); err != nil {
+		return nil, err
+	}
+	if ctx, err = c.exec.bind(ctx); err != nil {
+		return nil, err
 	}
 
-	v, err := buildInfo.LookupErr("version")
+	changeStreamOption := options.ChangeStream()
+	if len(opts) > 0 && opts[0].ChangeStreamOptions != nil {
+		changeStreamOption = opts[0].ChangeStreamOptions
+	}
+
+	return c.client.Watch(ctx, pipeline, changeStreamOption)
+}
+
+// bestEffort 判断是否在单节点服务器上不开启事务执行事务回调
+func (c *Client) bestEffort() bool {
+	return c.conf.TransactionBestEffort && c.Capabilities().Topology == TopologyStandalone
+}
+
+// ServerVersion 获取连接时缓存的服务器版本
+func (c *Client) ServerVersion() string {
+	version, err := c.exec.caps.serverVersion(context.Background())
 	if err != nil {
 		fmt.Println("获取 mongodb 版本信息出错", err)
 		return ""
 	}
 
-	return v.StringValue()
+	return version
+}
+
+// Capabilities 获取连接时缓存的服务器功能，检测失败时返回零值
+func (c *Client) Capabilities() Capabilities {
+	caps, _ := c.exec.caps.get(context.Background())
+	return caps
+}
+
+// RefreshCapabilities 重新检测服务器功能，如服务器升级后
+func (c *Client) RefreshCapabilities(ctx context.Context) (Capabilities, error) {
+	return c.exec.caps.refresh(ctx)
 }
 
 func client(ctx context.Context, opt *options.ClientOptions) (client *mongo.Client, err error) {
@@ -303,6 +425,9 @@ func newReadPref(pref ReadPref) (*readpref.ReadPref, error) {
 	if pref.MaxStalenessMS != 0 {
 		readPrefOpts = append(readPrefOpts, readpref.WithMaxStaleness(time.Duration(pref.MaxStalenessMS)*time.Millisecond))
 	}
+	if len(pref.TagSets) > 0 {
+		readPrefOpts = append(readPrefOpts, readpref.WithTagSets(tag.NewTagSetsFromMaps(pref.TagSets)...))
+	}
 	mode := readpref.PrimaryMode
 	if pref.Mode != 0 {
 		mode = pref.Mode
@@ -310,16 +435,3 @@ func newReadPref(pref ReadPref) (*readpref.ReadPref, error) {
 	readPreference, err := readpref.New(mode, readPrefOpts...)
 	return readPreference, err
 }
-
-func (c *Client) transactionAllowed() bool {
-	vr, err := compareVersions("4.0", c.ServerVersion())
-	if err != nil {
-		return false
-	}
-	if vr > 0 {
-		fmt.Println("transaction is not supported because mongo server version is below 4.0")
-		return false
-	}
-
-	return true
-}
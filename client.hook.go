@@ -7,6 +7,9 @@ package xmgo
 var (
 	onConnected = make(map[string][]onConnectedCallback, 0)
 	onOpened    = make(map[string]map[string][]onOpenedCallback, 0)
+
+	onCircuitChanged = make(map[string][]onCircuitChangedCallback, 0)
+	onHealthChanged  = make(map[string][]onHealthChangedCallback, 0)
 )
 
 type onConnectedCallback struct {
@@ -19,6 +22,16 @@ type onOpenedCallback struct {
 	Fn   func(database *Database) error
 }
 
+type onCircuitChangedCallback struct {
+	Name string
+	Fn   func(cli *Client, from, to CircuitState)
+}
+
+type onHealthChangedCallback struct {
+	Name string
+	Fn   func(cli *Client, from, to HealthStatus)
+}
+
 func OnConnected(uri string, name string, fn func(*Client) error) {
 	var hooks []onConnectedCallback
 	var ok bool
@@ -48,3 +61,21 @@ func OnOpened(uri string, db string, name string, fn func(database *Database) er
 	cli[db] = hook
 	onOpened[uri] = cli
 }
+
+// OnCircuitChanged 注册熔断器状态变化回调
+//
+//	@param uri mongodb 连接地址
+//	@param name 回调名称
+//	@param fn 回调函数，from 为变化前状态，to 为变化后状态
+func OnCircuitChanged(uri string, name string, fn func(cli *Client, from, to CircuitState)) {
+	onCircuitChanged[uri] = append(onCircuitChanged[uri], onCircuitChangedCallback{Name: name, Fn: fn})
+}
+
+// OnHealthChanged 注册健康状态变化回调，HealthChecker 检查结果的状态或主节点变化时触发
+//
+//	@param uri mongodb 连接地址
+//	@param name 回调名称
+//	@param fn 回调函数，from 为变化前的检查结果，to 为变化后的检查结果
+func OnHealthChanged(uri string, name string, fn func(cli *Client, from, to HealthStatus)) {
+	onHealthChanged[uri] = append(onHealthChanged[uri], onHealthChangedCallback{Name: name, Fn: fn})
+}
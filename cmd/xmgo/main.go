@@ -0,0 +1,19 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+// xmgo mongodb 运维命令行工具
+//
+//	migrate 子命令只能执行编译进当前二进制的迁移，服务可以参照本文件编写自己的
+//	main 包，通过空白导入注册迁移后调用 cli.Main
+package main
+
+import (
+	"os"
+
+	"xtravisions.com/xmgo/cli"
+)
+
+func main() {
+	os.Exit(cli.Main(os.Args[1:]))
+}
@@ -0,0 +1,289 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	opts "xtravisions.com/xmgo/options"
+)
+
+// Export 以 Extended JSON 格式导出文档
+//
+//	@param w 输出
+//	@param filter 查询条件
+//	@param o 导出配置
+func (c *Collection) Export(ctx context.Context, w io.Writer, filter interface{}, o ...opts.ExportOptions) (n int64, err error) {
+	defer c.wrapErr(&err, "export", filter)
+
+	var eo opts.ExportOptions
+	if len(o) > 0 {
+		eo = o[0]
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	findOpts := options.Find()
+	if eo.Sort != nil {
+		findOpts.SetSort(eo.Sort)
+	}
+	if eo.Projection != nil {
+		findOpts.SetProjection(eo.Projection)
+	}
+	if eo.Limit > 0 {
+		findOpts.SetLimit(eo.Limit)
+	}
+
+	ctx, cancel, err := c.exec.prepare(ctx, opRead)
+	if err != nil {
+		return
+	}
+
+	var cur *mongo.Cursor
+	err = c.exec.do(ctx, true, func() (err error) {
+		cur, err = c.collection.Find(ctx, filter, findOpts)
+		return
+	})
+	if err != nil {
+		cancel()
+		return
+	}
+
+	return ExportCursor(w, &Cursor{ctx: ctx, cursor: cur, cancel: cancel}, eo)
+}
+
+// ExportCursor 以 Extended JSON 格式导出游标中的全部文档
+//
+//	游标可来自 IQuery.Cursor 或 IAggregate.Iter
+//	@param w 输出
+//	@param cur 游标
+//	@param o 导出配置
+func ExportCursor(w io.Writer, cur ICursor, o ...opts.ExportOptions) (n int64, err error) {
+	var eo opts.ExportOptions
+	if len(o) > 0 {
+		eo = o[0]
+	}
+	if eo.BatchSize <= 0 {
+		eo.BatchSize = 1000
+	}
+
+	defer func() {
+		_ = cur.Close()
+	}()
+
+	array := eo.Format == opts.FormatJSONArray
+	bw := bufio.NewWriter(w)
+
+	if array {
+		if _, err = bw.WriteString("["); err != nil {
+			return
+		}
+	}
+
+	for {
+		var doc bson.Raw
+		if !cur.Next(&doc) {
+			break
+		}
+
+		var data []byte
+		if data, err = bson.MarshalExtJSON(doc, eo.Canonical, false); err != nil {
+			return
+		}
+
+		if array && n > 0 {
+			if _, err = bw.WriteString(","); err != nil {
+				return
+			}
+		}
+		if array {
+			_, err = bw.WriteString("\n  ")
+		}
+		if err == nil {
+			_, err = bw.Write(data)
+		}
+		if err == nil && !array {
+			err = bw.WriteByte('\n')
+		}
+		if err != nil {
+			return
+		}
+
+		n++
+		if eo.Progress != nil && n%eo.BatchSize == 0 {
+			eo.Progress(n)
+		}
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+
+	if array {
+		if _, err = bw.WriteString("\n]\n"); err != nil {
+			return
+		}
+	}
+	if err = bw.Flush(); err != nil {
+		return
+	}
+
+	if eo.Progress != nil && n%eo.BatchSize != 0 {
+		eo.Progress(n)
+	}
+
+	return
+}
+
+// Import 导入 Extended JSON 格式的文档
+//
+//	支持 canonical 及 relaxed 模式，文档经由 Bulk 分批写入
+//	@param r 输入
+//	@param o 导入配置
+func (c *Collection) Import(ctx context.Context, r io.Reader, o ...opts.ImportOptions) (result *ImportResult, err error) {
+	defer c.wrapErr(&err, "import", nil)
+
+	return ImportInto(ctx, c.Interface(), r, o...)
+}
+
+// ImportInto 导入 Extended JSON 格式的文档到指定 collection
+//
+//	出错时同时返回已导入部分的结果
+//	@param coll 目标 collection
+//	@param r 输入
+//	@param o 导入配置
+func ImportInto(ctx context.Context, coll ICollection, r io.Reader, o ...opts.ImportOptions) (*ImportResult, error) {
+	var im opts.ImportOptions
+	if len(o) > 0 {
+		im = o[0]
+	}
+	if im.BatchSize <= 0 {
+		im.BatchSize = 1000
+	}
+
+	br := bufio.NewReader(r)
+	array := im.Format == opts.FormatJSONArray
+	if im.Format == "" {
+		first, err := peekNonSpace(br)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		array = first == '['
+	}
+
+	dec := json.NewDecoder(br)
+	if array {
+		if _, err := dec.Token(); err != nil {
+			if err == io.EOF {
+				return &ImportResult{}, nil
+			}
+			return nil, err
+		}
+	}
+
+	result := &ImportResult{}
+	bulk := coll.Bulk().SetOrdered(im.Ordered)
+	pending := 0
+
+	flush := func() error {
+		if pending == 0 {
+			return nil
+		}
+		// 部分写入失败时仍累计已写入的数量
+		res, err := bulk.RunWithCtx(ctx)
+		if res != nil {
+			result.InsertedCount += res.InsertedCount
+			result.MatchedCount += res.MatchedCount
+			result.ModifiedCount += res.ModifiedCount
+			result.UpsertedCount += res.UpsertedCount
+		}
+		if err != nil {
+			return err
+		}
+		pending = 0
+
+		if im.Progress != nil {
+			im.Progress(result.ReadCount)
+		}
+		return nil
+	}
+
+	for {
+		if array && !dec.More() {
+			break
+		}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if err == io.EOF && !array {
+				break
+			}
+			return result, err
+		}
+
+		var doc bson.Raw
+		if err := bson.UnmarshalExtJSON(raw, false, &doc); err != nil {
+			return result, fmt.Errorf("document %d: %w", result.ReadCount+1, err)
+		}
+		result.ReadCount++
+
+		if len(im.UpsertKeys) > 0 {
+			filter, err := upsertFilter(doc, im.UpsertKeys)
+			if err != nil {
+				return result, fmt.Errorf("document %d: %w", result.ReadCount, err)
+			}
+			bulk.Upsert(filter, doc)
+		} else {
+			bulk.InsertOne(doc)
+		}
+
+		pending++
+		if pending >= im.BatchSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, flush()
+}
+
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.ContainsAny(b, " \t\r\n") {
+			return b[0], nil
+		}
+		if _, err = br.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func upsertFilter(doc bson.Raw, keys []string) (bson.D, error) {
+	filter := make(bson.D, 0, len(keys))
+	for _, key := range keys {
+		v, err := doc.LookupErr(strings.Split(key, ".")...)
+		if err != nil {
+			return nil, fmt.Errorf("upsert key %s not found", key)
+		}
+		filter = append(filter, bson.E{Key: key, Value: v})
+	}
+
+	return filter, nil
+}
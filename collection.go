@@ -14,10 +14,65 @@ import (
 	opts "xtravisions.com/xmgo/options"
 )
 
+// ICollection mongodb collection 操作接口
+//
+//	Collection 的 Bulk 等方法返回具体类型，通过 Collection.Interface 获取该接口的实现
+type ICollection interface {
+	Name() string
+	Clone(o ...*opts.CollectionOptions) ICollection
+	Drop() error
+
+	Watch(pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error)
+	WatchWithCtx(ctx context.Context, pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error)
+	Aggregate(pipeline interface{}, opts ...opts.AggregateOptions) IAggregate
+	AggregateWithCtx(ctx context.Context, pipeline interface{}, opts ...opts.AggregateOptions) IAggregate
+	Find(filter interface{}, opts ...opts.FindOptions) IQuery
+	FindWithCtx(ctx context.Context, filter interface{}, opts ...opts.FindOptions) IQuery
+
+	InsertOne(doc interface{}, opts ...opts.InsertOneOptions) (*InsertOneResult, error)
+	InsertOneWithCtx(ctx context.Context, doc interface{}, opts ...opts.InsertOneOptions) (*InsertOneResult, error)
+	InsertMany(docs interface{}, opts ...opts.InsertManyOptions) (*InsertManyResult, error)
+	InsertManyWithCtx(ctx context.Context, docs interface{}, opts ...opts.InsertManyOptions) (*InsertManyResult, error)
+
+	UpdateById(id interface{}, update interface{}, opts ...opts.UpdateOptions) error
+	UpdateByIdWithCtx(ctx context.Context, id interface{}, update interface{}, opts ...opts.UpdateOptions) error
+	UpdateOne(filter interface{}, update interface{}, opts ...opts.UpdateOptions) error
+	UpdateOneWithCtx(ctx context.Context, filter interface{}, update interface{}, opts ...opts.UpdateOptions) error
+	UpdateAll(filter interface{}, update interface{}, opts ...opts.UpdateOptions) (*UpdateResult, error)
+	UpdateAllWithCtx(ctx context.Context, filter interface{}, update interface{}, opts ...opts.UpdateOptions) (*UpdateResult, error)
+	Upsert(filter interface{}, replacement interface{}, opts ...opts.UpsertOptions) (*UpdateResult, error)
+	UpsertWithCtx(ctx context.Context, filter interface{}, replacement interface{}, opts ...opts.UpsertOptions) (*UpdateResult, error)
+	UpsertById(id interface{}, replacement interface{}, opts ...opts.UpsertOptions) (*UpdateResult, error)
+	UpsertByIdWithCtx(ctx context.Context, id interface{}, replacement interface{}, opts ...opts.UpsertOptions) (*UpdateResult, error)
+	ReplaceOne(filter interface{}, doc interface{}, opts ...opts.ReplaceOptions) error
+	ReplaceOneWithCtx(ctx context.Context, filter interface{}, doc interface{}, opts ...opts.ReplaceOptions) error
+
+	Remove(filter interface{}, opts ...opts.RemoveOptions) error
+	RemoveWithCtx(ctx context.Context, filter interface{}, opts ...opts.RemoveOptions) error
+	RemoveById(id interface{}, opts ...opts.RemoveOptions) error
+	RemoveByIdWithCtx(ctx context.Context, id interface{}, opts ...opts.RemoveOptions) error
+
+	Bulk() IBulk
+
+	DropIndex(indexes []string) error
+	DropIndexWithCtx(ctx context.Context, indexes []string) error
+	DropIndexByName(name string) error
+	DropIndexByNameWithCtx(ctx context.Context, name string) error
+	DropAllIndex() error
+	DropAllIndexWithCtx(ctx context.Context) error
+	ListIndexes() ([]*IndexSpecification, error)
+	ListIndexesWithCtx(ctx context.Context) ([]*IndexSpecification, error)
+	CreateIndexes(indexes []opts.IndexOptions) error
+	CreateIndexesWithCtx(ctx context.Context, indexes []opts.IndexOptions) error
+	EnsureIndexes(uniques []string, indexes []string) error
+	EnsureIndexesWithCtx(ctx context.Context, uniques []string, indexes []string) error
+}
+
 // Collection mongodb collection 操作封装
 type Collection struct {
 	collection *mongo.Collection
 	registry   *bsoncodec.Registry
+	exec       *executor
 }
 
 // Name 获取 collection 名称
@@ -25,16 +80,62 @@ func (c *Collection) Name() string {
 	return c.collection.Name()
 }
 
+// Clone 克隆 collection，使用新的读策略、读关注或写关注，未设置的参数沿用当前 collection
+//
+//	如将分析查询发送到从节点：coll.Clone(&opts.CollectionOptions{CollectionOptions: options.Collection().SetReadPreference(readpref.SecondaryPreferred())})；
+//	克隆失败时返回的 collection 的所有操作均返回克隆错误
+//	@param o collection 参数
+func (c *Collection) Clone(o ...*opts.CollectionOptions) *Collection {
+	collOpts := make([]*options.CollectionOptions, 0, len(o))
+	for _, opt := range o {
+		if opt != nil && opt.CollectionOptions != nil {
+			collOpts = append(collOpts, opt.CollectionOptions)
+		}
+	}
+
+	cp, err := c.collection.Clone(collOpts...)
+	if err != nil {
+		return &Collection{
+			collection: c.collection,
+			registry:   c.registry,
+			exec:       c.exec.withErr(err),
+		}
+	}
+
+	return &Collection{
+		collection: cp,
+		registry:   c.registry,
+		exec:       c.exec,
+	}
+}
+
 // Drop 删除 collection
-func (c *Collection) Drop() error {
-	return c.collection.Drop(context.TODO())
+func (c *Collection) Drop() (err error) {
+	defer c.wrapErr(&err, "drop", nil)
+
+	ctx, cancel, err := c.exec.prepare(context.TODO(), opWrite)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	return c.collection.Drop(ctx)
 }
 
 func (c *Collection) Watch(pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error) {
 	return c.WatchWithCtx(context.TODO(), pipeline, opts...)
 }
 
-func (c *Collection) WatchWithCtx(ctx context.Context, pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+func (c *Collection) WatchWithCtx(ctx context.Context, pipeline interface{}, opts ...*opts.ChangeStreamOptions) (cs *mongo.ChangeStream, err error) {
+	defer c.wrapErr(&err, "watch", nil)
+
+	if err = c.exec.require(ctx, FeatureChangeStreams); err != nil {
+		return nil, err
+	}
+	if ctx, err = c.exec.bind(ctx); err != nil {
+		return nil, err
+	}
+
 	changeStreamOption := options.ChangeStream()
 	if len(opts) > 0 && opts[0].ChangeStreamOptions != nil {
 		changeStreamOption = opts[0].ChangeStreamOptions
@@ -53,6 +154,7 @@ func (c *Collection) AggregateWithCtx(ctx context.Context, pipeline interface{},
 		collection: c.collection,
 		pipeline:   pipeline,
 		options:    opts,
+		exec:       c.exec,
 	}
 }
 
@@ -67,5 +169,6 @@ func (c *Collection) FindWithCtx(ctx context.Context, filter interface{}, opts .
 		filter:     filter,
 		opts:       opts,
 		registry:   c.registry,
+		exec:       c.exec,
 	}
 }
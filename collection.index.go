@@ -11,7 +11,6 @@ import (
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/x/bsonx"
 
 	opts "xtravisions.com/xmgo/options"
 )
@@ -27,18 +26,38 @@ func (c *Collection) DropIndex(indexes []string) error {
 //
 //	@param indexes 待删除索引名
 func (c *Collection) DropIndexWithCtx(ctx context.Context, indexes []string) (err error) {
-	var res string
-	for _, e := range indexes {
-		key, sort := splitSortField(e)
-		n := key + "_" + fmt.Sprint(sort)
-		if len(res) == 0 {
-			res = n
-		} else {
-			res += "_" + n
-		}
+	defer c.wrapErr(&err, "dropIndex", nil)
+
+	ctx, cancel, err := c.exec.prepare(ctx, opIndex)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	_, err = c.collection.Indexes().DropOne(ctx, indexName(indexes))
+	return
+}
+
+// DropIndexByName 使用默认上下文按名称删除索引
+//
+//	@param name 索引名
+func (c *Collection) DropIndexByName(name string) error {
+	return c.DropIndexByNameWithCtx(context.TODO(), name)
+}
+
+// DropIndexByNameWithCtx 按名称删除索引
+//
+//	@param name 索引名
+func (c *Collection) DropIndexByNameWithCtx(ctx context.Context, name string) (err error) {
+	defer c.wrapErr(&err, "dropIndexByName", nil)
+
+	ctx, cancel, err := c.exec.prepare(ctx, opIndex)
+	if err != nil {
+		return
 	}
+	defer cancel()
 
-	_, err = c.collection.Indexes().DropOne(ctx, res)
+	_, err = c.collection.Indexes().DropOne(ctx, name)
 	return
 }
 
@@ -49,10 +68,60 @@ func (c *Collection) DropAllIndex() error {
 
 // DropAllIndexWithCtx 删除全部索引
 func (c *Collection) DropAllIndexWithCtx(ctx context.Context) (err error) {
+	defer c.wrapErr(&err, "dropAllIndex", nil)
+
+	ctx, cancel, err := c.exec.prepare(ctx, opIndex)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	_, err = c.collection.Indexes().DropAll(ctx)
 	return
 }
 
+// ListIndexes 使用默认上下文获取全部索引
+func (c *Collection) ListIndexes() ([]*IndexSpecification, error) {
+	return c.ListIndexesWithCtx(context.TODO())
+}
+
+// ListIndexesWithCtx 获取全部索引
+func (c *Collection) ListIndexesWithCtx(ctx context.Context) (specs []*IndexSpecification, err error) {
+	defer c.wrapErr(&err, "listIndexes", nil)
+
+	ctx, cancel, err := c.exec.prepare(ctx, opIndex)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	return c.collection.Indexes().ListSpecifications(ctx)
+}
+
+// IndexName 获取索引名称
+//
+//	未指定名称时按 mongodb 默认规则由索引字段生成
+func IndexName(index opts.IndexOptions) string {
+	if index.IndexOptions != nil && index.Name != nil {
+		return *index.Name
+	}
+
+	return indexName(index.Key)
+}
+
+// IndexKeys 获取索引字段对应的索引键文档
+//
+//	@param fields 索引字段，语法参见 opts.IndexOptions.Key
+func IndexKeys(fields []string) D {
+	keys := make(D, 0, len(fields))
+	for _, field := range fields {
+		key, value := splitIndexField(field)
+		keys = append(keys, E{Key: key, Value: value})
+	}
+
+	return keys
+}
+
 // CreateIndexes 使用默认上下文创建索引
 func (c *Collection) CreateIndexes(indexes []opts.IndexOptions) error {
 	return c.CreateIndexesWithCtx(context.TODO(), indexes)
@@ -60,8 +129,18 @@ func (c *Collection) CreateIndexes(indexes []opts.IndexOptions) error {
 
 // CreateIndexesWithCtx 创建索引
 //
+//	索引字段语法参见 opts.IndexOptions.Key，权重、默认语言、部分索引过滤条件及排序规则
+//	通过 IndexOptions 的 SetWeights、SetDefaultLanguage、SetPartialFilterExpression、SetCollation 设置
 //	注意：不支持在 `local` 模式读策略下的操作
-func (c *Collection) CreateIndexesWithCtx(ctx context.Context, indexes []opts.IndexOptions) error {
+func (c *Collection) CreateIndexesWithCtx(ctx context.Context, indexes []opts.IndexOptions) (err error) {
+	defer c.wrapErr(&err, "createIndexes", nil)
+
+	ctx, cancel, err := c.exec.prepare(ctx, opIndex)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	return c.ensureIndex(ctx, indexes)
 }
 
@@ -80,6 +159,14 @@ func (c *Collection) EnsureIndexes(uniques []string, indexes []string) error {
 //	@param uniques 唯一索引
 //	@param indexes 普通索引
 func (c *Collection) EnsureIndexesWithCtx(ctx context.Context, uniques []string, indexes []string) (err error) {
+	defer c.wrapErr(&err, "ensureIndexes", nil)
+
+	ctx, cancel, err := c.exec.prepare(ctx, opIndex)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	var uniqueModel, indexesModel []opts.IndexOptions
 
 	for _, v := range uniques {
@@ -106,20 +193,28 @@ func (c *Collection) EnsureIndexesWithCtx(ctx context.Context, uniques []string,
 	return
 }
 
+// wildcardIndex 判断是否为通配符索引
+func wildcardIndex(fields []string) bool {
+	for _, field := range fields {
+		if key, _ := splitIndexField(field); strings.HasSuffix(key, "$**") {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (c *Collection) ensureIndex(ctx context.Context, indexes []opts.IndexOptions) error {
 	var indexModels []mongo.IndexModel
 	for _, idx := range indexes {
-		var model mongo.IndexModel
-		var keysDoc bsonx.Doc
-
-		for _, field := range idx.Key {
-			key, n := splitSortField(field)
-
-			keysDoc = keysDoc.Append(key, bsonx.Int32(n))
+		if wildcardIndex(idx.Key) {
+			if err := c.exec.require(ctx, FeatureWildcardIndexes); err != nil {
+				return err
+			}
 		}
 
-		model = mongo.IndexModel{
-			Keys:    keysDoc,
+		model := mongo.IndexModel{
+			Keys:    IndexKeys(idx.Key),
 			Options: idx.IndexOptions,
 		}
 
@@ -20,6 +20,14 @@ func (c *Collection) InsertOne(doc interface{}, opts ...opts.InsertOneOptions) (
 }
 
 func (c *Collection) InsertOneWithCtx(ctx context.Context, doc interface{}, opts ...opts.InsertOneOptions) (result *InsertOneResult, err error) {
+	defer c.wrapErr(&err, "insertOne", nil)
+
+	ctx, cancel, err := c.exec.prepare(ctx, opWrite)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	h := doc
 	insertOneOpts := options.InsertOne()
 	if len(opts) > 0 {
@@ -37,7 +45,12 @@ func (c *Collection) InsertOneWithCtx(ctx context.Context, doc interface{}, opts
 
 	var res *mongo.InsertOneResult
 
-	if res, err = c.collection.InsertOne(ctx, doc, insertOneOpts); err != nil {
+	err = c.exec.do(ctx, false, func() (err error) {
+		res, err = c.collection.InsertOne(ctx, doc, insertOneOpts)
+		return
+	})
+	if err != nil {
+		err = WrapWriteError(err, nil, nil)
 		return
 	}
 
@@ -55,6 +68,14 @@ func (c *Collection) InsertMany(docs interface{}, opts ...opts.InsertManyOptions
 }
 
 func (c *Collection) InsertManyWithCtx(ctx context.Context, docs interface{}, opts ...opts.InsertManyOptions) (result *InsertManyResult, err error) {
+	defer c.wrapErr(&err, "insertMany", nil)
+
+	ctx, cancel, err := c.exec.prepare(ctx, opWrite)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	h := docs
 	insertManyOpts := options.InsertMany()
 	if len(opts) > 0 {
@@ -76,7 +97,12 @@ func (c *Collection) InsertManyWithCtx(ctx context.Context, docs interface{}, op
 	}
 
 	var res *mongo.InsertManyResult
-	if res, err = c.collection.InsertMany(ctx, sDocs, insertManyOpts); err != nil {
+	err = c.exec.do(ctx, false, func() (err error) {
+		res, err = c.collection.InsertMany(ctx, sDocs, insertManyOpts)
+		return
+	})
+	if err != nil {
+		err = WrapWriteError(err, sDocs, nil)
 		return
 	}
 
@@ -20,6 +20,14 @@ func (c *Collection) Remove(filter interface{}, opts ...opts.RemoveOptions) erro
 }
 
 func (c *Collection) RemoveWithCtx(ctx context.Context, filter interface{}, opts ...opts.RemoveOptions) (err error) {
+	defer c.wrapErr(&err, "remove", filter)
+
+	ctx, cancel, err := c.exec.prepare(ctx, opWrite)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	deleteOptions := options.Delete()
 	if len(opts) > 0 {
 		if opts[0].DeleteOptions != nil {
@@ -34,7 +42,11 @@ func (c *Collection) RemoveWithCtx(ctx context.Context, filter interface{}, opts
 
 	var res *mongo.DeleteResult
 
-	res, err = c.collection.DeleteOne(ctx, filter, deleteOptions)
+	err = c.exec.do(ctx, idFilter(filter), func() (err error) {
+		res, err = c.collection.DeleteOne(ctx, filter, deleteOptions)
+		return
+	})
+	err = WrapWriteError(err, nil, nil)
 	if res != nil && res.DeletedCount == 0 {
 		err = ErrNoSuchDocuments
 	}
@@ -57,6 +69,14 @@ func (c *Collection) RemoveById(id interface{}, opts ...opts.RemoveOptions) erro
 }
 
 func (c *Collection) RemoveByIdWithCtx(ctx context.Context, id interface{}, opts ...opts.RemoveOptions) (err error) {
+	defer c.wrapErr(&err, "removeById", bson.M{"_id": id})
+
+	ctx, cancel, err := c.exec.prepare(ctx, opWrite)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	deleteOptions := options.Delete()
 	if len(opts) > 0 {
 		if opts[0].DeleteOptions != nil {
@@ -71,7 +91,11 @@ func (c *Collection) RemoveByIdWithCtx(ctx context.Context, id interface{}, opts
 
 	var res *mongo.DeleteResult
 
-	res, err = c.collection.DeleteOne(ctx, bson.M{"_id": id}, deleteOptions)
+	err = c.exec.do(ctx, true, func() (err error) {
+		res, err = c.collection.DeleteOne(ctx, bson.M{"_id": id}, deleteOptions)
+		return
+	})
+	err = WrapWriteError(err, nil, nil)
 	if res != nil && res.DeletedCount == 0 {
 		err = ErrNoSuchDocuments
 	}
@@ -20,6 +20,14 @@ func (c *Collection) UpdateById(id interface{}, update interface{}, opts ...opts
 }
 
 func (c *Collection) UpdateByIdWithCtx(ctx context.Context, id interface{}, update interface{}, opts ...opts.UpdateOptions) (err error) {
+	defer c.wrapErr(&err, "updateById", bson.M{"_id": id})
+
+	ctx, cancel, err := c.exec.prepare(ctx, opWrite)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	updateOpts := options.Update()
 
 	if len(opts) > 0 {
@@ -35,12 +43,16 @@ func (c *Collection) UpdateByIdWithCtx(ctx context.Context, id interface{}, upda
 
 	var res *mongo.UpdateResult
 
-	res, err = c.collection.UpdateOne(ctx, bson.M{"_id": id}, update, updateOpts)
+	err = c.exec.do(ctx, idempotentUpdate(update), func() (err error) {
+		res, err = c.collection.UpdateOne(ctx, bson.M{"_id": id}, update, updateOpts)
+		return
+	})
 	if res != nil && res.MatchedCount == 0 {
 		err = ErrNoSuchDocuments
 	}
 
 	if err != nil {
+		err = WrapWriteError(err, nil, nil)
 		return
 	}
 
@@ -58,6 +70,14 @@ func (c *Collection) UpdateOne(filter interface{}, update interface{}, opts ...o
 }
 
 func (c *Collection) UpdateOneWithCtx(ctx context.Context, filter interface{}, update interface{}, opts ...opts.UpdateOptions) (err error) {
+	defer c.wrapErr(&err, "updateOne", filter)
+
+	ctx, cancel, err := c.exec.prepare(ctx, opWrite)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	updateOpts := options.Update()
 
 	if len(opts) > 0 {
@@ -73,7 +93,10 @@ func (c *Collection) UpdateOneWithCtx(ctx context.Context, filter interface{}, u
 
 	var res *mongo.UpdateResult
 
-	res, err = c.collection.UpdateOne(ctx, filter, update, updateOpts)
+	err = c.exec.do(ctx, idFilter(filter) && idempotentUpdate(update), func() (err error) {
+		res, err = c.collection.UpdateOne(ctx, filter, update, updateOpts)
+		return
+	})
 	if res != nil && res.MatchedCount == 0 {
 		if updateOpts.Upsert == nil || !*updateOpts.Upsert {
 			err = ErrNoSuchDocuments
@@ -81,6 +104,7 @@ func (c *Collection) UpdateOneWithCtx(ctx context.Context, filter interface{}, u
 	}
 
 	if err != nil {
+		err = WrapWriteError(err, nil, nil)
 		return err
 	}
 
@@ -98,6 +122,14 @@ func (c *Collection) UpdateAll(filter interface{}, update interface{}, opts ...o
 }
 
 func (c *Collection) UpdateAllWithCtx(ctx context.Context, filter interface{}, update interface{}, opts ...opts.UpdateOptions) (result *UpdateResult, err error) {
+	defer c.wrapErr(&err, "updateAll", filter)
+
+	ctx, cancel, err := c.exec.prepare(ctx, opWrite)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	updateOpts := options.Update()
 	if len(opts) > 0 {
 		if opts[0].UpdateOptions != nil {
@@ -112,12 +144,17 @@ func (c *Collection) UpdateAllWithCtx(ctx context.Context, filter interface{}, u
 
 	var res *mongo.UpdateResult
 
-	res, err = c.collection.UpdateMany(ctx, filter, update, updateOpts)
+	// 重试时匹配的文档集合可能已变化，不视为幂等
+	err = c.exec.do(ctx, false, func() (err error) {
+		res, err = c.collection.UpdateMany(ctx, filter, update, updateOpts)
+		return
+	})
 	if res != nil {
 		result = translateUpdateResult(res)
 	}
 
 	if err != nil {
+		err = WrapWriteError(err, nil, nil)
 		return
 	}
 
@@ -135,6 +172,14 @@ func (c *Collection) Upsert(filter interface{}, replacement interface{}, opts ..
 }
 
 func (c *Collection) UpsertWithCtx(ctx context.Context, filter interface{}, replacement interface{}, opts ...opts.UpsertOptions) (result *UpdateResult, err error) {
+	defer c.wrapErr(&err, "upsert", filter)
+
+	ctx, cancel, err := c.exec.prepare(ctx, opWrite)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	h := replacement
 	officialOpts := options.Replace().SetUpsert(true)
 
@@ -154,12 +199,16 @@ func (c *Collection) UpsertWithCtx(ctx context.Context, filter interface{}, repl
 
 	var res *mongo.UpdateResult
 
-	res, err = c.collection.ReplaceOne(ctx, filter, replacement, officialOpts)
+	err = c.exec.do(ctx, idFilter(filter), func() (err error) {
+		res, err = c.collection.ReplaceOne(ctx, filter, replacement, officialOpts)
+		return
+	})
 	if res != nil {
 		result = translateUpdateResult(res)
 	}
 
 	if err != nil {
+		err = WrapWriteError(err, nil, nil)
 		return
 	}
 
@@ -175,6 +224,14 @@ func (c *Collection) UpsertById(id interface{}, replacement interface{}, opts ..
 }
 
 func (c *Collection) UpsertByIdWithCtx(ctx context.Context, id interface{}, replacement interface{}, opts ...opts.UpsertOptions) (result *UpdateResult, err error) {
+	defer c.wrapErr(&err, "upsertById", bson.M{"_id": id})
+
+	ctx, cancel, err := c.exec.prepare(ctx, opWrite)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	h := replacement
 	officialOpts := options.Replace().SetUpsert(true)
 
@@ -194,12 +251,16 @@ func (c *Collection) UpsertByIdWithCtx(ctx context.Context, id interface{}, repl
 
 	var res *mongo.UpdateResult
 
-	res, err = c.collection.ReplaceOne(ctx, bson.M{"_id": id}, replacement, officialOpts)
+	err = c.exec.do(ctx, true, func() (err error) {
+		res, err = c.collection.ReplaceOne(ctx, bson.M{"_id": id}, replacement, officialOpts)
+		return
+	})
 	if res != nil {
 		result = translateUpdateResult(res)
 	}
 
 	if err != nil {
+		err = WrapWriteError(err, nil, nil)
 		return
 	}
 
@@ -216,6 +277,14 @@ func (c *Collection) ReplaceOne(filter interface{}, doc interface{}, opts ...opt
 }
 
 func (c *Collection) ReplaceOneWithCtx(ctx context.Context, filter interface{}, doc interface{}, opts ...opts.ReplaceOptions) (err error) {
+	defer c.wrapErr(&err, "replaceOne", filter)
+
+	ctx, cancel, err := c.exec.prepare(ctx, opWrite)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	h := doc
 	replaceOpts := options.Replace()
 
@@ -234,12 +303,16 @@ func (c *Collection) ReplaceOneWithCtx(ctx context.Context, filter interface{},
 
 	var res *mongo.UpdateResult
 
-	res, err = c.collection.ReplaceOne(ctx, filter, doc, replaceOpts)
+	err = c.exec.do(ctx, idFilter(filter), func() (err error) {
+		res, err = c.collection.ReplaceOne(ctx, filter, doc, replaceOpts)
+		return
+	})
 	if res != nil && res.MatchedCount == 0 {
 		err = ErrNoSuchDocuments
 	}
 
 	if err != nil {
+		err = WrapWriteError(err, nil, nil)
 		return
 	}
 
@@ -0,0 +1,421 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	opts "xtravisions.com/xmgo/options"
+)
+
+// CSVColumn 文档字段到 CSV 列的映射
+type CSVColumn struct {
+	Path       string                       // 文档字段，支持 a.b 形式
+	Header     string                       // CSV 列名，默认与 Path 相同
+	TimeLayout string                       // 日期格式，默认为 time.RFC3339
+	Separator  string                       // 数组元素分隔符，默认为 `;`
+	Format     func(v bson.RawValue) string // 自定义格式化
+}
+
+// CSVWriter 以 CSV 格式流式输出查询结果
+type CSVWriter struct {
+	w       *csv.Writer
+	columns []CSVColumn
+	header  bool
+}
+
+// NewCSVWriter 创建 CSVWriter
+//
+//	@param w 输出
+//	@param columns 列映射
+func NewCSVWriter(w io.Writer, columns ...CSVColumn) *CSVWriter {
+	for i := range columns {
+		if columns[i].Header == "" {
+			columns[i].Header = columns[i].Path
+		}
+		if columns[i].TimeLayout == "" {
+			columns[i].TimeLayout = time.RFC3339
+		}
+		if columns[i].Separator == "" {
+			columns[i].Separator = ";"
+		}
+	}
+
+	return &CSVWriter{w: csv.NewWriter(w), columns: columns}
+}
+
+// WriteCursor 输出游标中的全部文档，游标来自 IQuery.Cursor 或 IAggregate.Iter
+func (cw *CSVWriter) WriteCursor(cur ICursor) (n int64, err error) {
+	defer func() {
+		_ = cur.Close()
+	}()
+
+	if err = cw.writeHeader(); err != nil {
+		return
+	}
+
+	for {
+		var doc bson.Raw
+		if !cur.Next(&doc) {
+			break
+		}
+		if err = cw.writeRow(doc); err != nil {
+			return
+		}
+		n++
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+
+	cw.w.Flush()
+	err = cw.w.Error()
+
+	return
+}
+
+// Write 输出单个文档
+func (cw *CSVWriter) Write(doc interface{}) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err = cw.writeHeader(); err != nil {
+		return err
+	}
+
+	return cw.writeRow(raw)
+}
+
+// Flush 将缓冲的数据写入输出
+func (cw *CSVWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *CSVWriter) writeHeader() error {
+	if cw.header {
+		return nil
+	}
+	cw.header = true
+
+	headers := make([]string, len(cw.columns))
+	for i, col := range cw.columns {
+		headers[i] = col.Header
+	}
+
+	return cw.w.Write(headers)
+}
+
+func (cw *CSVWriter) writeRow(doc bson.Raw) error {
+	row := make([]string, len(cw.columns))
+	for i, col := range cw.columns {
+		v, err := doc.LookupErr(strings.Split(col.Path, ".")...)
+		if err != nil {
+			continue
+		}
+		if col.Format != nil {
+			row[i] = col.Format(v)
+		} else {
+			row[i] = formatCSVValue(v, col)
+		}
+	}
+
+	return cw.w.Write(row)
+}
+
+func formatCSVValue(v bson.RawValue, col CSVColumn) string {
+	switch v.Type {
+	case bsontype.Null, bsontype.Undefined:
+		return ""
+	case bsontype.String:
+		return v.StringValue()
+	case bsontype.ObjectID:
+		return v.ObjectID().Hex()
+	case bsontype.DateTime:
+		return v.Time().Format(col.TimeLayout)
+	case bsontype.Boolean:
+		return strconv.FormatBool(v.Boolean())
+	case bsontype.Int32:
+		return strconv.FormatInt(int64(v.Int32()), 10)
+	case bsontype.Int64:
+		return strconv.FormatInt(v.Int64(), 10)
+	case bsontype.Double:
+		return strconv.FormatFloat(v.Double(), 'f', -1, 64)
+	case bsontype.Decimal128:
+		return v.Decimal128().String()
+	case bsontype.Array:
+		values, err := v.Array().Values()
+		if err != nil {
+			return ""
+		}
+		items := make([]string, len(values))
+		for i, item := range values {
+			items[i] = formatCSVValue(item, col)
+		}
+		return strings.Join(items, col.Separator)
+	default:
+		return v.String()
+	}
+}
+
+// CSVRowError CSV 导入时单行的错误
+type CSVRowError struct {
+	Row    int64  // 数据行号，从 1 开始，不含表头
+	Column string // 出错的列，写入错误时为空
+	Err    error
+}
+
+func (e *CSVRowError) Error() string {
+	if e.Column != "" {
+		return fmt.Sprintf("row %d column %s: %v", e.Row, e.Column, e.Err)
+	}
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+func (e *CSVRowError) Unwrap() error {
+	return e.Err
+}
+
+// ImportCSV 导入 CSV 数据
+//
+//	第一行为表头，按列映射转换类型后经由 Bulk 无序写入
+//	转换或写入失败的行记录在结果的 Errors 中，不会中断导入
+//	@param r 输入
+//	@param o 导入配置
+func (c *Collection) ImportCSV(ctx context.Context, r io.Reader, o ...opts.CSVImportOptions) (result *CSVImportResult, err error) {
+	defer c.wrapErr(&err, "importCSV", nil)
+
+	return ImportCSVInto(ctx, c.Interface(), r, o...)
+}
+
+// ImportCSVInto 导入 CSV 数据到指定 collection
+//
+//	@param coll 目标 collection
+//	@param r 输入
+//	@param o 导入配置
+func ImportCSVInto(ctx context.Context, coll ICollection, r io.Reader, o ...opts.CSVImportOptions) (*CSVImportResult, error) {
+	var co opts.CSVImportOptions
+	if len(o) > 0 {
+		co = o[0]
+	}
+	if co.BatchSize <= 0 {
+		co.BatchSize = 1000
+	}
+
+	cr := csv.NewReader(r)
+	if co.Comma != 0 {
+		cr.Comma = co.Comma
+	}
+	cr.ReuseRecord = true
+
+	headers, err := cr.Read()
+	if err == io.EOF {
+		return &CSVImportResult{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := csvFields(headers, co.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CSVImportResult{}
+	bulk := coll.Bulk().SetOrdered(false)
+	var rows []int64
+
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+
+		res, err := bulk.RunWithCtx(ctx)
+		if res != nil {
+			result.InsertedCount += res.InsertedCount
+		}
+
+		var bwe mongo.BulkWriteException
+		if errors.As(err, &bwe) && bwe.WriteConcernError == nil {
+			// 部分失败时 res 已包含本批写入数量，仅在 IBulk 实现未返回 res 时按失败行数推算
+			if res == nil {
+				result.InsertedCount += int64(len(rows) - len(bwe.WriteErrors))
+			}
+			for _, we := range bwe.WriteErrors {
+				result.Errors = append(result.Errors, &CSVRowError{Row: rows[we.Index], Err: errors.New(we.Message)})
+			}
+			bulk = coll.Bulk().SetOrdered(false)
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rows = rows[:0]
+		if co.Progress != nil {
+			co.Progress(result.ReadCount)
+		}
+		return nil
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+
+		result.ReadCount++
+		if err != nil {
+			var pe *csv.ParseError
+			if errors.As(err, &pe) {
+				result.Errors = append(result.Errors, &CSVRowError{Row: result.ReadCount, Err: err})
+				continue
+			}
+			return result, err
+		}
+
+		doc, rowErr := csvDocument(record, fields, co.SkipEmpty)
+		if rowErr != nil {
+			rowErr.Row = result.ReadCount
+			result.Errors = append(result.Errors, rowErr)
+			continue
+		}
+
+		bulk.InsertOne(doc)
+		rows = append(rows, result.ReadCount)
+
+		if len(rows) >= co.BatchSize {
+			if err = flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, flush()
+}
+
+type csvField struct {
+	opts.CSVField
+	index int
+	path  []string
+}
+
+func csvFields(headers []string, mapping []opts.CSVField) ([]csvField, error) {
+	columns := make(map[string]int, len(headers))
+	for i, h := range headers {
+		columns[strings.TrimSpace(h)] = i
+	}
+
+	if len(mapping) == 0 {
+		for _, h := range headers {
+			mapping = append(mapping, opts.CSVField{Header: strings.TrimSpace(h)})
+		}
+	}
+
+	fields := make([]csvField, 0, len(mapping))
+	for _, m := range mapping {
+		i, ok := columns[m.Header]
+		if !ok {
+			return nil, fmt.Errorf("csv column %s not found", m.Header)
+		}
+		if m.Path == "" {
+			m.Path = m.Header
+		}
+		if m.TimeLayout == "" {
+			m.TimeLayout = time.RFC3339
+		}
+		if m.Separator == "" {
+			m.Separator = ";"
+		}
+		fields = append(fields, csvField{CSVField: m, index: i, path: strings.Split(m.Path, ".")})
+	}
+
+	return fields, nil
+}
+
+func csvDocument(record []string, fields []csvField, skipEmpty bool) (bson.D, *CSVRowError) {
+	doc := bson.D{}
+	for _, f := range fields {
+		var cell string
+		if f.index < len(record) {
+			cell = record[f.index]
+		}
+		if cell == "" && skipEmpty {
+			continue
+		}
+
+		v, err := parseCSVValue(cell, f.CSVField)
+		if err != nil {
+			return nil, &CSVRowError{Column: f.Header, Err: err}
+		}
+		doc = setPath(doc, f.path, v)
+	}
+
+	return doc, nil
+}
+
+func parseCSVValue(cell string, f opts.CSVField) (interface{}, error) {
+	switch f.Type {
+	case "", opts.CSVString:
+		return cell, nil
+	case opts.CSVInt:
+		return strconv.ParseInt(strings.TrimSpace(cell), 10, 64)
+	case opts.CSVFloat:
+		return strconv.ParseFloat(strings.TrimSpace(cell), 64)
+	case opts.CSVBool:
+		return strconv.ParseBool(strings.TrimSpace(cell))
+	case opts.CSVDate:
+		return time.Parse(f.TimeLayout, strings.TrimSpace(cell))
+	case opts.CSVObjectId:
+		return primitive.ObjectIDFromHex(strings.TrimSpace(cell))
+	case opts.CSVArray:
+		if cell == "" {
+			return bson.A{}, nil
+		}
+		items := strings.Split(cell, f.Separator)
+		res := make(bson.A, len(items))
+		for i, item := range items {
+			res[i] = item
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("unknown csv field type %s", f.Type)
+	}
+}
+
+// setPath 按路径设置嵌套字段
+func setPath(doc bson.D, path []string, v interface{}) bson.D {
+	for i := range doc {
+		if doc[i].Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			doc[i].Value = v
+			return doc
+		}
+		sub, _ := doc[i].Value.(bson.D)
+		doc[i].Value = setPath(sub, path[1:], v)
+		return doc
+	}
+
+	if len(path) == 1 {
+		return append(doc, bson.E{Key: path[0], Value: v})
+	}
+
+	return append(doc, bson.E{Key: path[0], Value: setPath(bson.D{}, path[1:], v)})
+}
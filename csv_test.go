@@ -0,0 +1,37 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"xtravisions.com/xmgo"
+	"xtravisions.com/xmgo/memory"
+)
+
+func TestImportCSVIntoDuplicateRow(t *testing.T) {
+	ctx := context.Background()
+	coll := memory.NewClient().Database("test").Collection("users")
+	if _, err := coll.InsertOneWithCtx(ctx, xmgo.M{"_id": "2", "name": "old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := xmgo.ImportCSVInto(ctx, coll, strings.NewReader("_id,name\n1,a\n2,b\n3,c\n"))
+	if err != nil {
+		t.Fatalf("ImportCSVInto() error = %v", err)
+	}
+
+	if res.ReadCount != 3 || res.InsertedCount != 2 {
+		t.Errorf("ReadCount = %d, InsertedCount = %d, want 3, 2", res.ReadCount, res.InsertedCount)
+	}
+	if len(res.Errors) != 1 || res.Errors[0].Row != 2 {
+		t.Errorf("Errors = %v, want a single error on row 2", res.Errors)
+	}
+	if n, err := coll.FindWithCtx(ctx, xmgo.M{}).Count(); err != nil || n != 3 {
+		t.Errorf("Count() = %d, %v, want 3", n, err)
+	}
+}
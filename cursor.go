@@ -21,6 +21,8 @@ type Cursor struct {
 	ctx    context.Context
 	cursor *mongo.Cursor
 	err    error
+	// 取消操作超时，关闭游标时调用
+	cancel context.CancelFunc
 }
 
 func (c *Cursor) Next(result interface{}) bool {
@@ -40,6 +42,8 @@ func (c *Cursor) Next(result interface{}) bool {
 }
 
 func (c *Cursor) All(results interface{}) error {
+	defer c.release()
+
 	if c.err != nil {
 		return c.err
 	}
@@ -48,6 +52,8 @@ func (c *Cursor) All(results interface{}) error {
 }
 
 func (c *Cursor) Close() error {
+	defer c.release()
+
 	if c.err != nil {
 		return c.err
 	}
@@ -55,6 +61,13 @@ func (c *Cursor) Close() error {
 	return c.cursor.Close(c.ctx)
 }
 
+// release 释放游标关联的操作超时
+func (c *Cursor) release() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
 func (c *Cursor) Err() error {
 	if c.err != nil {
 		return c.err
@@ -0,0 +1,399 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	opts "xtravisions.com/xmgo/options"
+)
+
+const (
+	backupDataExt     = ".bson"
+	backupMetadataExt = ".metadata.json"
+)
+
+// backupMetadata collection 元数据，格式与 mongodump 的 metadata.json 一致
+type backupMetadata struct {
+	CollectionName string     `bson:"collectionName"`
+	Type           string     `bson:"type"`
+	Options        bson.Raw   `bson:"options"`
+	Indexes        []bson.Raw `bson:"indexes"`
+}
+
+// Backup 将数据库逻辑备份到目录
+//
+//	每个 collection 的文档写入 <name>.bson，选项及索引写入 <name>.metadata.json
+//	@param dir 备份目录，不存在时自动创建
+//	@param o 备份配置
+func (d *Database) Backup(ctx context.Context, dir string, o ...opts.BackupOptions) (err error) {
+	defer d.wrapErr(&err, "backup", nil)
+
+	var bo opts.BackupOptions
+	if len(o) > 0 {
+		bo = o[0]
+	}
+	filter := bo.Filter
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return
+	}
+
+	var specs []*mongo.CollectionSpecification
+	err = d.run(ctx, opRead, true, func(ctx context.Context) (err error) {
+		specs, err = d.database.ListCollectionSpecifications(ctx, bson.M{})
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	for _, spec := range specs {
+		if strings.HasPrefix(spec.Name, "system.") || !backupSelected(spec.Name, bo.Include, bo.Exclude) {
+			continue
+		}
+
+		if err = d.backupCollection(ctx, dir, spec, filter, bo.Progress); err != nil {
+			return NewOpError(d.database.Name(), spec.Name, "backup", filter, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Database) backupCollection(ctx context.Context, dir string, spec *mongo.CollectionSpecification, filter interface{}, progress func(string, int64)) (err error) {
+	meta := backupMetadata{CollectionName: spec.Name, Type: spec.Type, Options: spec.Options}
+	if meta.Options == nil {
+		meta.Options = bson.Raw(bsonEmptyDocument)
+	}
+
+	if spec.Type != "view" {
+		if meta.Indexes, err = d.backupIndexes(ctx, spec.Name); err != nil {
+			return
+		}
+		if err = d.backupData(ctx, dir, spec.Name, filter, progress); err != nil {
+			return
+		}
+	}
+
+	data, err := bson.MarshalExtJSON(meta, true, false)
+	if err != nil {
+		return
+	}
+
+	return os.WriteFile(filepath.Join(dir, spec.Name+backupMetadataExt), data, 0o644)
+}
+
+// Restore 从 Backup 生成的目录还原数据库
+//
+//	按元数据重建 collection 及视图，写入文档后重建索引
+//	@param dir 备份目录
+//	@param o 还原配置
+func (d *Database) Restore(ctx context.Context, dir string, o ...opts.RestoreOptions) (err error) {
+	defer d.wrapErr(&err, "restore", nil)
+
+	var ro opts.RestoreOptions
+	if len(o) > 0 {
+		ro = o[0]
+	}
+	if ro.BatchSize <= 0 {
+		ro.BatchSize = 1000
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+backupMetadataExt))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	var metas []backupMetadata
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		var meta backupMetadata
+		if err = bson.UnmarshalExtJSON(data, true, &meta); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if meta.CollectionName == "" {
+			meta.CollectionName = strings.TrimSuffix(filepath.Base(file), backupMetadataExt)
+		}
+		if backupSelected(meta.CollectionName, ro.Include, ro.Exclude) {
+			metas = append(metas, meta)
+		}
+	}
+
+	// 视图可能依赖其他 collection，最后创建
+	sort.SliceStable(metas, func(i, j int) bool {
+		return metas[i].Type != "view" && metas[j].Type == "view"
+	})
+
+	for _, meta := range metas {
+		if err = d.restoreCollection(ctx, dir, meta, ro); err != nil {
+			return NewOpError(d.database.Name(), meta.CollectionName, "restore", nil, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Database) restoreCollection(ctx context.Context, dir string, meta backupMetadata, ro opts.RestoreOptions) error {
+	if ro.Drop {
+		err := d.run(ctx, opWrite, true, func(ctx context.Context) error {
+			return d.database.Collection(meta.CollectionName).Drop(ctx)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := d.createCollection(ctx, meta); err != nil {
+		return err
+	}
+	if meta.Type == "view" {
+		return nil
+	}
+
+	if err := d.restoreData(ctx, dir, meta.CollectionName, ro); err != nil {
+		return err
+	}
+	if ro.NoIndexes {
+		return nil
+	}
+
+	return d.restoreIndexes(ctx, meta)
+}
+
+var bsonEmptyDocument = []byte{5, 0, 0, 0, 0}
+
+func backupSelected(name string, include, exclude []string) bool {
+	for _, e := range exclude {
+		if e == name {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, i := range include {
+		if i == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Database) backupIndexes(ctx context.Context, name string) (indexes []bson.Raw, err error) {
+	err = d.run(ctx, opIndex, true, func(ctx context.Context) error {
+		cur, err := d.database.Collection(name).Indexes().List(ctx)
+		if err != nil {
+			return err
+		}
+
+		indexes = nil
+		return cur.All(ctx, &indexes)
+	})
+
+	return
+}
+
+func (d *Database) backupData(ctx context.Context, dir string, name string, filter interface{}, progress func(string, int64)) (err error) {
+	f, err := os.Create(filepath.Join(dir, name+backupDataExt))
+	if err != nil {
+		return
+	}
+	defer func() {
+		if cErr := f.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}()
+
+	// 导出整个 collection 耗时较长，仅绑定会话，不设置操作超时
+	if ctx, err = d.exec.bind(ctx); err != nil {
+		return
+	}
+
+	var cur *mongo.Cursor
+	err = d.exec.do(ctx, true, func() (err error) {
+		cur, err = d.database.Collection(name).Find(ctx, filter)
+		return
+	})
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = cur.Close(ctx)
+	}()
+
+	w := bufio.NewWriter(f)
+	var n int64
+	for cur.Next(ctx) {
+		if _, err = w.Write(cur.Current); err != nil {
+			return
+		}
+		n++
+		if progress != nil && n%1000 == 0 {
+			progress(name, n)
+		}
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+	if progress != nil {
+		progress(name, n)
+	}
+
+	return w.Flush()
+}
+
+func (d *Database) createCollection(ctx context.Context, meta backupMetadata) error {
+	cmd := bson.D{{Key: "create", Value: meta.CollectionName}}
+	if meta.Options != nil {
+		elements, err := meta.Options.Elements()
+		if err != nil {
+			return err
+		}
+		for _, e := range elements {
+			cmd = append(cmd, bson.E{Key: e.Key(), Value: e.Value()})
+		}
+	}
+
+	err := d.run(ctx, opWrite, true, func(ctx context.Context) error {
+		return d.database.RunCommand(ctx, cmd).Err()
+	})
+	var ce mongo.CommandError
+	if errors.As(err, &ce) && ce.Name == "NamespaceExists" {
+		return nil
+	}
+
+	return err
+}
+
+func (d *Database) restoreData(ctx context.Context, dir string, name string, ro opts.RestoreOptions) error {
+	f, err := os.Open(filepath.Join(dir, name+backupDataExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	coll := d.database.Collection(name)
+	r := bufio.NewReader(f)
+	batch := make([]interface{}, 0, ro.BatchSize)
+	var n int64
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := d.run(ctx, opWrite, false, func(ctx context.Context) error {
+			_, err := coll.InsertMany(ctx, batch)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		n += int64(len(batch))
+		batch = batch[:0]
+		if ro.Progress != nil {
+			ro.Progress(name, n)
+		}
+		return nil
+	}
+
+	for {
+		doc, err := readBSONDocument(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s%s: %w", name, backupDataExt, err)
+		}
+
+		batch = append(batch, doc)
+		if len(batch) >= ro.BatchSize {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return flush()
+}
+
+func (d *Database) restoreIndexes(ctx context.Context, meta backupMetadata) error {
+	var indexes bson.A
+	for _, idx := range meta.Indexes {
+		elements, err := idx.Elements()
+		if err != nil {
+			return err
+		}
+
+		var spec bson.D
+		for _, e := range elements {
+			if e.Key() == "ns" || e.Key() == "v" {
+				continue
+			}
+			spec = append(spec, bson.E{Key: e.Key(), Value: e.Value()})
+		}
+		if idx.Lookup("name").StringValue() == "_id_" {
+			continue
+		}
+		indexes = append(indexes, spec)
+	}
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	return d.run(ctx, opIndex, true, func(ctx context.Context) error {
+		return d.database.RunCommand(ctx, bson.D{
+			{Key: "createIndexes", Value: meta.CollectionName},
+			{Key: "indexes", Value: indexes},
+		}).Err()
+	})
+}
+
+func readBSONDocument(r io.Reader) (bson.Raw, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.LittleEndian.Uint32(size[:])
+	if n < 5 {
+		return nil, fmt.Errorf("invalid bson document size %d", n)
+	}
+
+	doc := make([]byte, n)
+	copy(doc, size[:])
+	if _, err := io.ReadFull(r, doc[4:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return doc, nil
+}
@@ -7,6 +7,7 @@ package xmgo
 import (
 	"context"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -14,10 +15,29 @@ import (
 	opts "xtravisions.com/xmgo/options"
 )
 
+// IDatabase mongodb 数据库操作接口
+//
+//	Database 的 Collection 等方法返回具体类型，通过 Database.Interface 获取该接口的实现
+type IDatabase interface {
+	Name() string
+	Clone(o ...*opts.DatabaseOptions) IDatabase
+	Collection(name string) ICollection
+	ModelCollection(model IModel) ICollection
+	CollectionNames() ([]string, error)
+	CollectionNamesWithCtx(ctx context.Context) ([]string, error)
+	Drop() error
+	DropWithCtx(ctx context.Context) error
+	RunCommand(runCommand interface{}, opts ...opts.RunCommandOptions) *mongo.SingleResult
+	RunCommandWithCtx(ctx context.Context, runCommand interface{}, opts ...opts.RunCommandOptions) *mongo.SingleResult
+	Watch(pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error)
+	WatchWithCtx(ctx context.Context, pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error)
+}
+
 // Database mongodb 数据库
 type Database struct {
 	database *mongo.Database
 	registry *bsoncodec.Registry
+	exec     *executor
 }
 
 // Name 获取当前数据库名
@@ -25,6 +45,29 @@ func (d *Database) Name() string {
 	return d.database.Name()
 }
 
+// Clone 克隆数据库，使用新的读策略、读关注或写关注，未设置的参数沿用当前数据库
+//
+//	@param o 数据库参数
+func (d *Database) Clone(o ...*opts.DatabaseOptions) *Database {
+	dbOpts := []*options.DatabaseOptions{
+		options.Database().
+			SetReadPreference(d.database.ReadPreference()).
+			SetReadConcern(d.database.ReadConcern()).
+			SetWriteConcern(d.database.WriteConcern()),
+	}
+	for _, opt := range o {
+		if opt != nil && opt.DatabaseOptions != nil {
+			dbOpts = append(dbOpts, opt.DatabaseOptions)
+		}
+	}
+
+	return &Database{
+		database: d.database.Client().Database(d.database.Name(), dbOpts...),
+		registry: d.registry,
+		exec:     d.exec,
+	}
+}
+
 // Collection 获取指定名称的 mongodb collection
 //	@param name mongodb collection 名称
 func (d *Database) Collection(name string) *Collection {
@@ -34,6 +77,7 @@ func (d *Database) Collection(name string) *Collection {
 	return &Collection{
 		collection: cp,
 		registry:   d.registry,
+		exec:       d.exec,
 	}
 }
 
@@ -43,6 +87,21 @@ func (d *Database) ModelCollection(model IModel) *Collection {
 	return d.Collection(model.CollectionName())
 }
 
+// CollectionNames 使用默认上下文获取当前数据库全部 collection 名称
+func (d *Database) CollectionNames() ([]string, error) {
+	return d.CollectionNamesWithCtx(context.TODO())
+}
+
+// CollectionNamesWithCtx 获取当前数据库全部 collection 名称
+func (d *Database) CollectionNamesWithCtx(ctx context.Context) ([]string, error) {
+	ctx, err := d.exec.bind(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.database.ListCollectionNames(ctx, bson.M{})
+}
+
 // Drop 使用默认上下文删除当前数据库
 func (d *Database) Drop() error {
 	return d.DropWithCtx(context.TODO())
@@ -50,18 +109,65 @@ func (d *Database) Drop() error {
 
 // DropWithCtx 删除当前数据库
 func (d *Database) DropWithCtx(ctx context.Context) error {
+	ctx, err := d.exec.bind(ctx)
+	if err != nil {
+		return err
+	}
+
 	return d.database.Drop(ctx)
 }
 
+// Watch 使用默认上下文监听当前数据库全部 collection 的变更
+func (d *Database) Watch(pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return d.WatchWithCtx(context.TODO(), pipeline, opts...)
+}
+
+// WatchWithCtx 监听当前数据库全部 collection 的变更
+//
+//	可通过 MatchNamespaces、MatchOperationTypes 过滤事件
+//	@param ctx 上下文
+//	@param pipeline 过滤事件的聚合管道
+//	@param opts change stream 参数
+func (d *Database) WatchWithCtx(ctx context.Context, pipeline interface{}, opts ...*opts.ChangeStreamOptions) (cs *mongo.ChangeStream, err error) {
+	defer d.wrapErr(&err, "watch", nil)
+
+	if err = d.exec.require(ctx, FeatureClusterChangeStreams); err != nil {
+		return nil, err
+	}
+	if ctx, err = d.exec.bind(ctx); err != nil {
+		return nil, err
+	}
+
+	changeStreamOption := options.ChangeStream()
+	if len(opts) > 0 && opts[0].ChangeStreamOptions != nil {
+		changeStreamOption = opts[0].ChangeStreamOptions
+	}
+
+	return d.database.Watch(ctx, pipeline, changeStreamOption)
+}
+
+// run 经由 executor 执行数据库操作，统一处理会话、超时、重试及熔断
+//
+//	@param ctx 上下文
+//	@param class 操作类别
+//	@param idempotent 操作是否幂等
+//	@param fn 待执行的操作
+func (d *Database) run(ctx context.Context, class opClass, idempotent bool, fn func(ctx context.Context) error) error {
+	ctx, cancel, err := d.exec.prepare(ctx, class)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	return d.exec.do(ctx, idempotent, func() error {
+		return fn(ctx)
+	})
+}
+
 // RunCommand 使用默认上下文在当前数据库直接执行
 //	参见 https://pkg.go.dev/go.mongodb.org/mongo-driver/mongo#Database.RunCommand
 func (d *Database) RunCommand(runCommand interface{}, opts ...opts.RunCommandOptions) *mongo.SingleResult {
-	option := options.RunCmd()
-	if len(opts) > 0 && opts[0].RunCmdOptions != nil {
-		option = opts[0].RunCmdOptions
-	}
-
-	return d.database.RunCommand(context.TODO(), runCommand, option)
+	return d.RunCommandWithCtx(context.TODO(), runCommand, opts...)
 }
 
 // RunCommandWithCtx 在当前数据库直接执行
@@ -72,5 +178,10 @@ func (d *Database) RunCommandWithCtx(ctx context.Context, runCommand interface{}
 		option = opts[0].RunCmdOptions
 	}
 
+	ctx, err := d.exec.bind(ctx)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+
 	return d.database.RunCommand(ctx, runCommand, option)
 }
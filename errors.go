@@ -24,8 +24,20 @@ var (
 	ErrNoSuchDocuments = mongo.ErrNoDocuments
 	// ErrTransactionRetry return if transaction need to retry
 	ErrTransactionRetry = errors.New("retry transaction")
+	// ErrNotInTransaction return if context is not inside a transaction callback
+	ErrNotInTransaction = errors.New("not in transaction")
+	// ErrTransactionAborted passed to rollback callbacks if transaction is aborted explicitly
+	ErrTransactionAborted = errors.New("transaction aborted")
+	// ErrTransactionExists return if transaction exists while propagation is never
+	ErrTransactionExists = errors.New("transaction already exists")
+	// ErrTransactionRollbackOnly return if inner transaction scope failed but outer callback succeeded
+	ErrTransactionRollbackOnly = errors.New("transaction marked rollback-only")
+	// ErrSessionMismatch return if context belongs to another session than the bound handle
+	ErrSessionMismatch = errors.New("context belongs to another session")
 	// ErrTransactionNotSupported return if transaction not supported
 	ErrTransactionNotSupported = errors.New("transaction not supported")
+	// ErrFeatureNotSupported return if feature is not supported by server version or topology
+	ErrFeatureNotSupported = errors.New("feature not supported")
 	// ErrNotSupportedUsername return if username is invalid
 	ErrNotSupportedUsername = errors.New("username not supported")
 	// ErrNotSupportedPassword return if password is invalid
@@ -34,18 +46,24 @@ var (
 	ErrNotValidSliceToInsert = errors.New("must be valid slice to insert")
 	// ErrReplacementContainUpdateOperators return if replacement document contain update operators
 	ErrReplacementContainUpdateOperators = errors.New("replacement document cannot contain keys beginning with '$'")
+	// ErrCircuitOpen return if circuit breaker is open
+	ErrCircuitOpen = errors.New("circuit breaker is open")
 )
 
 // IsErrNoDocuments check if err is no documents, both mongo-go-driver error and qmgo custom error
-// Deprecated, simply call if err == ErrNoSuchDocuments or if err == mongo.ErrNoDocuments
+// Deprecated, simply call errors.Is(err, ErrNoSuchDocuments), errors are wrapped in *OpError
 func IsErrNoDocuments(err error) bool {
-	if err == ErrNoSuchDocuments {
-		return true
-	}
-	return false
+	return errors.Is(err, ErrNoSuchDocuments)
 }
 
 // IsDup check if err is mongo E11000 (duplicate err)。
+//
+//	包括 *DuplicateKeyError 及含有唯一索引冲突的 *WriteErrors
 func IsDup(err error) bool {
+	var dup *DuplicateKeyError
+	if errors.As(err, &dup) || mongo.IsDuplicateKeyError(err) {
+		return true
+	}
+
 	return err != nil && strings.Contains(err.Error(), "E11000")
 }
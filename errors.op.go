@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"errors"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// redacted 脱敏后的查询条件值
+const redacted = "?"
+
+// OpError 操作错误，包含数据库、collection、操作名称及脱敏后的查询条件
+//
+//	通过 errors.Is / errors.As 判断原始错误，如 errors.Is(err, ErrNoSuchDocuments)、errors.As(err, &dup) 获取 *DuplicateKeyError
+type OpError struct {
+	// 数据库名称，集群操作（如 Client.Watch）时为空
+	Database string
+	// collection 名称，数据库及集群操作时为空
+	Collection string
+	// 操作名称，如 updateById、find.one、bulk
+	Op string
+	// 脱敏后的查询条件，保留字段名、操作符及 _id 的值，其余值替换为 ?
+	Filter string
+	// 原始错误
+	Err error
+}
+
+func (e *OpError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("xmgo: ")
+	sb.WriteString(e.Op)
+	if e.Database != "" {
+		sb.WriteString(" ")
+		sb.WriteString(e.Database)
+	}
+	if e.Collection != "" {
+		sb.WriteString(".")
+		sb.WriteString(e.Collection)
+	}
+	if e.Filter != "" {
+		sb.WriteString(" filter=")
+		sb.WriteString(e.Filter)
+	}
+	sb.WriteString(": ")
+	sb.WriteString(e.Err.Error())
+
+	return sb.String()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// NewOpError 为错误附加操作信息，err 为 nil 或已是 *OpError 时原样返回
+//
+//	@param database 数据库名称
+//	@param collection collection 名称
+//	@param op 操作名称
+//	@param filter 查询条件，脱敏后保存
+//	@param err 原始错误
+func NewOpError(database, collection, op string, filter interface{}, err error) error {
+	var oe *OpError
+	if err == nil || errors.As(err, &oe) {
+		return err
+	}
+
+	return &OpError{
+		Database:   database,
+		Collection: collection,
+		Op:         op,
+		Filter:     RedactFilter(filter),
+		Err:        err,
+	}
+}
+
+// RedactFilter 脱敏查询条件，保留字段名、操作符及 _id 的值，其余值替换为 ?
+//
+//	返回 relaxed 模式的 Extended JSON，filter 为 nil 或无法序列化时返回空字符串
+//	@param filter 查询条件
+func RedactFilter(filter interface{}) string {
+	if filter == nil {
+		return ""
+	}
+
+	data, err := bson.Marshal(filter)
+	if err != nil {
+		return ""
+	}
+	var doc bson.D
+	if err = bson.Unmarshal(data, &doc); err != nil {
+		return ""
+	}
+
+	res, err := bson.MarshalExtJSON(redactDoc(doc, false), false, false)
+	if err != nil {
+		return ""
+	}
+
+	return string(res)
+}
+
+func redactDoc(doc bson.D, keep bool) bson.D {
+	res := make(bson.D, len(doc))
+	for i, e := range doc {
+		res[i] = bson.E{Key: e.Key, Value: redactValue(e.Value, keep || e.Key == "_id")}
+	}
+
+	return res
+}
+
+func redactValue(v interface{}, keep bool) interface{} {
+	switch vv := v.(type) {
+	case bson.D:
+		return redactDoc(vv, keep)
+	case bson.A:
+		res := make(bson.A, len(vv))
+		for i, e := range vv {
+			res[i] = redactValue(e, keep)
+		}
+		return res
+	}
+
+	if keep {
+		return v
+	}
+
+	return redacted
+}
+
+// wrapErr 为 collection 操作的错误附加操作信息，配合 defer 使用
+func (c *Collection) wrapErr(err *error, op string, filter interface{}) {
+	*err = NewOpError(c.collection.Database().Name(), c.collection.Name(), op, filter, *err)
+}
+
+// wrapErr 为数据库操作的错误附加操作信息，配合 defer 使用
+func (d *Database) wrapErr(err *error, op string, filter interface{}) {
+	*err = NewOpError(d.database.Name(), "", op, filter, *err)
+}
+
+// wrapErr 为集群操作的错误附加操作信息，配合 defer 使用
+func (c *Client) wrapErr(err *error, op string) {
+	*err = NewOpError("", "", op, nil, *err)
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewOpErrorNoDocuments(t *testing.T) {
+	err := NewOpError("shop", "users", "updateById", D{{Key: "_id", Value: 42}, {Key: "name", Value: "alice"}}, ErrNoSuchDocuments)
+
+	var oe *OpError
+	if !errors.As(err, &oe) {
+		t.Fatalf("NewOpError() = %T, want *OpError", err)
+	}
+	if !errors.Is(err, ErrNoSuchDocuments) || !IsErrNoDocuments(err) {
+		t.Errorf("errors.Is(%v, ErrNoSuchDocuments) = false", err)
+	}
+
+	want := `xmgo: updateById shop.users filter={"_id":42,"name":"?"}: mongo: no documents in result`
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestNewOpErrorPassThrough(t *testing.T) {
+	if err := NewOpError("shop", "users", "find", nil, nil); err != nil {
+		t.Errorf("NewOpError(nil) = %v, want nil", err)
+	}
+
+	inner := NewOpError("shop", "users", "find.one", nil, ErrNoSuchDocuments)
+	if err := NewOpError("shop", "orders", "bulk", nil, inner); err != inner {
+		t.Errorf("NewOpError(*OpError) = %v, want the original error", err)
+	}
+}
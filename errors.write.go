@@ -0,0 +1,331 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// 服务器错误码
+const (
+	codeDuplicateKey               = 11000
+	codeDocumentValidationFailure  = 121
+	codeNotWritablePrimary         = 10107
+	codeNotPrimaryNoSecondaryOk    = 13435
+	codeNotPrimaryOrSecondary      = 13436
+	codePrimarySteppedDown         = 189
+	codeInterruptedAtShutdown      = 11600
+	codeInterruptedDueToReplChange = 11602
+	codeShutdownInProgress         = 91
+)
+
+// retryableCodes 可重试的服务器错误码
+//
+//	参见 https://github.com/mongodb/specifications/blob/master/source/retryable-writes/retryable-writes.rst
+var retryableCodes = []int{6, 7, 89, 91, 134, 189, 262, 9001, 10107, 11600, 11602, 13435, 13436}
+
+// notPrimaryCodes 节点非主节点或正在切换的服务器错误码
+var notPrimaryCodes = []int{
+	codeNotWritablePrimary, codeNotPrimaryNoSecondaryOk, codeNotPrimaryOrSecondary, codePrimarySteppedDown,
+	codeInterruptedAtShutdown, codeInterruptedDueToReplChange, codeShutdownInProgress,
+}
+
+var dupKeyPattern = regexp.MustCompile(`index: (\S+)(?: dup key: (\{.*\}))?`)
+
+// DuplicateKeyError 唯一索引冲突错误
+type DuplicateKeyError struct {
+	// 冲突的索引名称
+	IndexName string
+	// 冲突的键值，服务器未返回时为空
+	Keys bson.D
+	// 服务器返回的错误信息
+	Message string
+
+	cause error
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return e.Message
+}
+
+func (e *DuplicateKeyError) Unwrap() error {
+	return e.cause
+}
+
+// WriteError 批量写操作中单个写操作的错误
+type WriteError struct {
+	// 写操作在 InsertMany 输入文档或 Bulk 队列中的位置
+	Index int
+	// 服务器错误码
+	Code int
+	// 服务器错误信息
+	Message string
+	// InsertMany 时对应的输入文档
+	Document interface{}
+	// Bulk 时对应队列中的写操作
+	Model mongo.WriteModel
+	// 唯一索引冲突时的详细信息，其他错误时为 nil
+	Duplicate *DuplicateKeyError
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("write %d: (%d) %s", e.Index, e.Code, e.Message)
+}
+
+// WriteErrors InsertMany 及 Bulk 的写操作错误
+type WriteErrors struct {
+	// 失败的写操作，按位置排列
+	Errors []*WriteError
+	// 写关注错误
+	WriteConcernError *mongo.WriteConcernError
+
+	cause error
+}
+
+func (e *WriteErrors) Error() string {
+	msgs := make([]string, 0, len(e.Errors)+1)
+	for _, we := range e.Errors {
+		msgs = append(msgs, we.Error())
+	}
+	if e.WriteConcernError != nil {
+		msgs = append(msgs, "write concern: "+e.WriteConcernError.Error())
+	}
+
+	return fmt.Sprintf("%d write errors: [%s]", len(e.Errors), strings.Join(msgs, ", "))
+}
+
+func (e *WriteErrors) Unwrap() error {
+	return e.cause
+}
+
+// As 支持 errors.As 获取第一个唯一索引冲突错误
+func (e *WriteErrors) As(target interface{}) bool {
+	if dup, ok := target.(**DuplicateKeyError); ok {
+		for _, we := range e.Errors {
+			if we.Duplicate != nil {
+				*dup = we.Duplicate
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// WrapWriteError 将驱动返回的写错误转换为类型化错误
+//
+//	单个写操作的唯一索引冲突转换为 *DuplicateKeyError，批量写操作的错误转换为 *WriteErrors，其他错误原样返回
+//	@param err 驱动返回的错误
+//	@param docs InsertMany 的输入文档，用于关联失败的写操作
+//	@param models Bulk 队列中的写操作，用于关联失败的写操作
+func WrapWriteError(err error, docs []interface{}, models []mongo.WriteModel) error {
+	var (
+		we  mongo.WriteException
+		bwe mongo.BulkWriteException
+		ce  mongo.CommandError
+	)
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &bwe):
+		res := &WriteErrors{WriteConcernError: bwe.WriteConcernError, cause: err}
+		for _, e := range bwe.WriteErrors {
+			item := &WriteError{Index: e.Index, Code: e.Code, Message: e.Message}
+			if e.Index >= 0 && e.Index < len(docs) {
+				item.Document = docs[e.Index]
+			}
+			if e.Index >= 0 && e.Index < len(models) {
+				item.Model = models[e.Index]
+			}
+			if isDupCode(e.Code) {
+				item.Duplicate = newDuplicateKeyError(e.Message, err)
+			}
+			res.Errors = append(res.Errors, item)
+		}
+		return res
+	case errors.As(err, &we):
+		for _, e := range we.WriteErrors {
+			if isDupCode(e.Code) {
+				return newDuplicateKeyError(e.Message, err)
+			}
+		}
+	case errors.As(err, &ce):
+		if isDupCode(int(ce.Code)) {
+			return newDuplicateKeyError(ce.Message, err)
+		}
+	}
+
+	return err
+}
+
+func isDupCode(code int) bool {
+	return code == codeDuplicateKey || code == 11001 || code == 12582
+}
+
+// newDuplicateKeyError 从服务器错误信息中解析索引名称及键值
+//
+//	如 E11000 duplicate key error collection: db.users index: name_1 dup key: { name: "alice" }
+func newDuplicateKeyError(msg string, cause error) *DuplicateKeyError {
+	res := &DuplicateKeyError{Message: msg, cause: cause}
+	if m := dupKeyPattern.FindStringSubmatch(msg); m != nil {
+		res.IndexName = m[1]
+		if m[2] != "" {
+			res.Keys = parseDupKeys(m[2])
+		}
+	}
+
+	return res
+}
+
+// parseDupKeys 解析 { name: "alice", age: 18 } 形式的键值
+func parseDupKeys(s string) bson.D {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}"))
+	if s == "" {
+		return nil
+	}
+
+	var res bson.D
+	for _, pair := range splitTopLevel(s) {
+		key, value := "", strings.TrimSpace(pair)
+		if i := strings.Index(pair, ": "); i >= 0 && !strings.ContainsAny(pair[:i], `"'({[`) {
+			key, value = strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+2:])
+		} else if strings.HasPrefix(value, ":") {
+			value = strings.TrimSpace(value[1:])
+		}
+		res = append(res, bson.E{Key: key, Value: parseDupValue(value)})
+	}
+
+	return res
+}
+
+// splitTopLevel 按不在引号及括号内的逗号分割
+func splitTopLevel(s string) []string {
+	var (
+		res   []string
+		depth int
+		quote rune
+		start int
+	)
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote && (i == 0 || s[i-1] != '\\') {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '{' || r == '[' || r == '(':
+			depth++
+		case r == '}' || r == ']' || r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			res = append(res, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(res, s[start:])
+}
+
+var objectIdValuePattern = regexp.MustCompile(`^ObjectId\(['"]([0-9a-fA-F]{24})['"]\)$`)
+
+func parseDupValue(s string) interface{} {
+	if m := objectIdValuePattern.FindStringSubmatch(s); m != nil {
+		if id, err := primitive.ObjectIDFromHex(m[1]); err == nil {
+			return id
+		}
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+		return s[1 : len(s)-1]
+	}
+	switch s {
+	case "null":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if int64(int32(i)) == i {
+			return int32(i)
+		}
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+
+	return s
+}
+
+// IsRetryable 判断错误是否可重试，包括网络错误、主节点切换及带有可重试标签的错误
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if IsNetwork(err) {
+		return true
+	}
+
+	var se mongo.ServerError
+	if errors.As(err, &se) {
+		if se.HasErrorLabel("RetryableWriteError") || se.HasErrorLabel("TransientTransactionError") {
+			return true
+		}
+		for _, code := range retryableCodes {
+			if se.HasErrorCode(code) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// IsNetwork 判断是否为网络错误
+func IsNetwork(err error) bool {
+	return mongo.IsNetworkError(err)
+}
+
+// IsTimeout 判断是否为超时错误，包括上下文超时
+func IsTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err)
+}
+
+// IsNotPrimary 判断是否为非主节点或主节点切换中的错误
+func IsNotPrimary(err error) bool {
+	var se mongo.ServerError
+	if !errors.As(err, &se) {
+		return false
+	}
+
+	for _, code := range notPrimaryCodes {
+		if se.HasErrorCode(code) {
+			return true
+		}
+	}
+
+	return se.HasErrorMessage("not master") || se.HasErrorMessage("node is recovering")
+}
+
+// IsValidation 判断是否为文档校验失败错误
+func IsValidation(err error) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) && se.HasErrorCode(codeDocumentValidationFailure)
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestNewDuplicateKeyError(t *testing.T) {
+	id, _ := primitive.ObjectIDFromHex("5f1b2c3d4e5f6a7b8c9d0e1f")
+
+	check := func(msg, index string, keys bson.D) {
+		t.Helper()
+
+		err := newDuplicateKeyError(msg, nil)
+		if err.IndexName != index || !reflect.DeepEqual(err.Keys, keys) {
+			t.Errorf("newDuplicateKeyError(%q) = %q %#v, want %q %#v", msg, err.IndexName, err.Keys, index, keys)
+		}
+		if err.Error() != msg {
+			t.Errorf("Error() = %q, want the server message", err.Error())
+		}
+	}
+
+	check(`E11000 duplicate key error collection: db.users index: name_1 dup key: { name: "alice" }`,
+		"name_1", bson.D{{Key: "name", Value: "alice"}})
+	check(`E11000 duplicate key error collection: db.users index: org_1_age_1 dup key: { org: "a, b", age: 18 }`,
+		"org_1_age_1", bson.D{{Key: "org", Value: "a, b"}, {Key: "age", Value: int32(18)}})
+	check(`E11000 duplicate key error collection: db.users index: _id_ dup key: { _id: ObjectId('5f1b2c3d4e5f6a7b8c9d0e1f') }`,
+		"_id_", bson.D{{Key: "_id", Value: id}})
+	check(`E11000 duplicate key error collection: db.t index: a_1_b_1_c_1_d_1 dup key: { a: null, b: true, c: 4294967296, d: 1.5 }`,
+		"a_1_b_1_c_1_d_1", bson.D{{Key: "a", Value: nil}, {Key: "b", Value: true}, {Key: "c", Value: int64(4294967296)}, {Key: "d", Value: 1.5}})
+	// 4.2 之前的格式不包含字段名
+	check(`E11000 duplicate key error index: db.users.$name_1 dup key: { : "alice" }`,
+		"db.users.$name_1", bson.D{{Key: "", Value: "alice"}})
+	check(`E11000 duplicate key error collection: db.users index: name_1`, "name_1", nil)
+	check(`duplicate key`, "", nil)
+}
+
+func TestWrapWriteError(t *testing.T) {
+	msg := `E11000 duplicate key error collection: db.users index: name_1 dup key: { name: "alice" }`
+
+	single := WrapWriteError(mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: codeDuplicateKey, Message: msg}}}, nil, nil)
+	var dup *DuplicateKeyError
+	if !errors.As(single, &dup) || dup.IndexName != "name_1" || !IsDup(single) {
+		t.Errorf("WrapWriteError(WriteException) = %#v, want *DuplicateKeyError", single)
+	}
+
+	docs := []interface{}{M{"name": "bob"}, M{"name": "alice"}}
+	bulk := WrapWriteError(mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 1, Code: codeDuplicateKey, Message: msg}},
+	}}, docs, nil)
+
+	var wes *WriteErrors
+	if !errors.As(bulk, &wes) || len(wes.Errors) != 1 {
+		t.Fatalf("WrapWriteError(BulkWriteException) = %#v, want *WriteErrors", bulk)
+	}
+	if we := wes.Errors[0]; we.Index != 1 || !reflect.DeepEqual(we.Document, docs[1]) || we.Duplicate == nil {
+		t.Errorf("WriteErrors[0] = %+v, want the duplicate of docs[1]", we)
+	}
+	if dup = nil; !errors.As(bulk, &dup) || !IsDup(bulk) {
+		t.Error("errors.As(*WriteErrors, *DuplicateKeyError) = false")
+	}
+
+	validation := WrapWriteError(mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: codeDocumentValidationFailure}}}, nil, nil)
+	if IsDup(validation) || !IsValidation(validation) {
+		t.Errorf("validation error classified as IsDup = %v, IsValidation = %v", IsDup(validation), IsValidation(validation))
+	}
+}
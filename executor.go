@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"bytes"
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// executor 执行 collection 操作，统一处理会话、超时、重试及熔断
+type executor struct {
+	retry    *RetryPolicy
+	breaker  *CircuitBreaker
+	timeouts *Timeouts
+	caps     *capabilityCache
+	session  mongo.Session
+	// 构造操作对象时的错误，如克隆 collection 失败，设置后所有操作返回该错误
+	err error
+}
+
+// withSession 复制并绑定会话，绑定后所有操作均使用该会话
+func (e *executor) withSession(s mongo.Session) *executor {
+	res := &executor{session: s}
+	if e != nil {
+		*res = *e
+		res.session = s
+	}
+
+	return res
+}
+
+// withErr 复制并设置错误，之后使用该 executor 的操作均返回 err
+func (e *executor) withErr(err error) *executor {
+	res := &executor{err: err}
+	if e != nil {
+		*res = *e
+		res.err = err
+	}
+
+	return res
+}
+
+// prepare 绑定会话并设置超时，上下文已属于其他会话时返回 ErrSessionMismatch
+//
+//	@param ctx 上下文
+//	@param class 操作类别
+func (e *executor) prepare(ctx context.Context, class opClass) (context.Context, context.CancelFunc, error) {
+	ctx, err := e.bind(ctx)
+	if err != nil {
+		return ctx, func() {}, err
+	}
+
+	ctx, cancel := e.timeout(ctx, class)
+	return ctx, cancel, nil
+}
+
+// bind 将会话绑定到上下文，未绑定会话时原样返回；已设置错误时返回该错误
+func (e *executor) bind(ctx context.Context) (context.Context, error) {
+	if e != nil && e.err != nil {
+		return ctx, e.err
+	}
+	if e == nil || e.session == nil {
+		return ctx, nil
+	}
+
+	if s := mongo.SessionFromContext(ctx); s != nil {
+		if s != e.session && !bytes.Equal(s.ID(), e.session.ID()) {
+			return ctx, ErrSessionMismatch
+		}
+		return ctx, nil
+	}
+
+	return mongo.NewSessionContext(ctx, e.session), nil
+}
+
+// do 执行操作，每次尝试均经过熔断器，熔断时返回 ErrCircuitOpen 且不再重试
+//
+//	上下文的会话处于事务中时不重试单个操作，由 WithTransaction 重试整个事务
+//	@param ctx 上下文
+//	@param idempotent 操作是否幂等
+//	@param fn 待执行的操作
+func (e *executor) do(ctx context.Context, idempotent bool, fn func() error) error {
+	if e == nil {
+		return fn()
+	}
+
+	attempt := func() error {
+		return e.breaker.do(fn)
+	}
+	if InTransaction(ctx) {
+		return attempt()
+	}
+
+	return e.retry.do(ctx, idempotent, attempt)
+}
@@ -0,0 +1,32 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestExecutorWithErr(t *testing.T) {
+	errClone := errors.New("clone failed")
+	base := &executor{timeouts: &Timeouts{}}
+	failed := base.withErr(errClone)
+
+	if _, _, err := failed.prepare(context.Background(), opRead); !errors.Is(err, errClone) {
+		t.Errorf("prepare() error = %v, want %v", err, errClone)
+	}
+	if _, err := failed.bind(context.Background()); !errors.Is(err, errClone) {
+		t.Errorf("bind() error = %v, want %v", err, errClone)
+	}
+	if failed.timeouts != base.timeouts {
+		t.Error("withErr() did not keep the shared settings")
+	}
+
+	// 原 executor 不受影响
+	if _, _, err := base.prepare(context.Background(), opRead); err != nil {
+		t.Errorf("prepare() on original executor error = %v", err)
+	}
+}
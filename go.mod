@@ -5,6 +5,7 @@ go 1.18
 require (
 	github.com/jinzhu/copier v0.3.5
 	go.mongodb.org/mongo-driver v1.9.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,386 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// HealthState 健康状态
+type HealthState int
+
+const (
+	// HealthUnknown 尚未检查
+	HealthUnknown HealthState = iota
+	// HealthUp 主节点可用，副本集从节点可达且复制延迟正常
+	HealthUp
+	// HealthDegraded 节点可达，但无主节点、无可达从节点或复制延迟超过阈值
+	HealthDegraded
+	// HealthDown 无可达节点
+	HealthDown
+)
+
+func (s HealthState) String() string {
+	switch s {
+	case HealthUp:
+		return "up"
+	case HealthDegraded:
+		return "degraded"
+	case HealthDown:
+		return "down"
+	}
+
+	return "unknown"
+}
+
+func (s HealthState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// 健康检查默认值
+const (
+	defaultHealthInterval = 10 * time.Second
+	defaultHealthTimeout  = 5 * time.Second
+)
+
+// 服务器错误码
+const (
+	codeUnauthorized         = 13
+	codeCommandNotFound      = 59
+	codeNoReplicationEnabled = 76
+	codeNotYetInitialized    = 94
+)
+
+// HealthOptions 健康检查配置
+type HealthOptions struct {
+	// 检查间隔
+	//	默认为 10 秒
+	IntervalMS int64 `json:"intervalMS"`
+	// 单项探测（hello、ping、replSetGetStatus）的超时，各项探测分别计时
+	//	默认为 5 秒
+	TimeoutMS int64 `json:"timeoutMS"`
+	// 复制延迟阈值，超过时状态为 HealthDegraded
+	//	设置为 0 意味不检查复制延迟
+	MaxLagMS int64 `json:"maxLagMS"`
+}
+
+// MemberStatus 副本集成员状态，来自 replSetGetStatus
+type MemberStatus struct {
+	// 成员地址
+	Name string `json:"name"`
+	// 成员状态，如 PRIMARY、SECONDARY
+	State string `json:"state"`
+	// 成员是否可达
+	Healthy bool `json:"healthy"`
+	// 相对主节点的复制延迟
+	LagMS int64 `json:"lagMS"`
+}
+
+// HealthStatus 健康检查结果快照
+type HealthStatus struct {
+	// 健康状态
+	State HealthState `json:"state"`
+	// 是否存活，即存在可达节点
+	Live bool `json:"live"`
+	// 是否就绪，即主节点可用
+	Ready bool `json:"ready"`
+	// 检查时间
+	CheckedAt time.Time `json:"checkedAt"`
+	// ping 主节点耗时
+	LatencyMS int64 `json:"latencyMS"`
+	// 副本集名称，非副本集时为空
+	SetName string `json:"setName,omitempty"`
+	// 主节点地址
+	Primary string `json:"primary,omitempty"`
+	// 是否存在可达的从节点
+	SecondaryReachable bool `json:"secondaryReachable"`
+	// 最大复制延迟，无权限执行 replSetGetStatus 时为 0
+	MaxLagMS int64 `json:"maxLagMS"`
+	// 副本集成员状态，无权限执行 replSetGetStatus 时为空
+	Members []MemberStatus `json:"members,omitempty"`
+	// 检查失败原因
+	Error string `json:"error,omitempty"`
+}
+
+// HealthChecker 后台定期检查连接健康状态
+//
+//	通过 ping、hello（旧版本服务器使用 isMaster）及 replSetGetStatus 获取拓扑信息，
+//	状态或主节点变化时触发 OnHealthChanged 注册的回调
+type HealthChecker struct {
+	client   *Client
+	interval time.Duration
+	timeout  time.Duration
+	maxLag   time.Duration
+
+	mu     sync.RWMutex
+	status HealthStatus
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewHealthChecker 创建健康检查，需调用 Start 开始后台检查
+//
+//	@param client mongodb 连接
+//	@param o 健康检查配置
+func NewHealthChecker(client *Client, o ...HealthOptions) *HealthChecker {
+	h := &HealthChecker{
+		client:   client,
+		interval: defaultHealthInterval,
+		timeout:  defaultHealthTimeout,
+	}
+
+	if len(o) > 0 {
+		if o[0].IntervalMS > 0 {
+			h.interval = time.Duration(o[0].IntervalMS) * time.Millisecond
+		}
+		if o[0].TimeoutMS > 0 {
+			h.timeout = time.Duration(o[0].TimeoutMS) * time.Millisecond
+		}
+		h.maxLag = time.Duration(o[0].MaxLagMS) * time.Millisecond
+	}
+
+	return h
+}
+
+// Start 立即执行一次检查并开始后台定期检查，重复调用无效
+func (h *HealthChecker) Start() {
+	h.mu.Lock()
+	if h.stop != nil {
+		h.mu.Unlock()
+		return
+	}
+	h.stop, h.done = make(chan struct{}), make(chan struct{})
+	stop, done := h.stop, h.done
+	h.mu.Unlock()
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+
+		for {
+			h.Check(context.Background())
+
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop 停止后台检查并等待正在进行的检查结束
+func (h *HealthChecker) Stop() {
+	h.mu.Lock()
+	stop, done := h.stop, h.done
+	h.stop, h.done = nil, nil
+	h.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// Status 获取最近一次检查结果
+func (h *HealthChecker) Status() HealthStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.status
+}
+
+// Check 立即执行一次检查并更新检查结果
+//
+//	@param ctx 上下文，每项探测另受 HealthOptions.TimeoutMS 限制
+func (h *HealthChecker) Check(ctx context.Context) HealthStatus {
+	status := h.check(ctx)
+
+	h.mu.Lock()
+	prev := h.status
+	h.status = status
+	h.mu.Unlock()
+
+	if prev.State != status.State || prev.Primary != status.Primary {
+		for _, cb := range onHealthChanged[h.client.conf.Uri] {
+			cb.Fn(h.client, prev, status)
+		}
+	}
+
+	return status
+}
+
+// probe 创建单项探测的上下文，避免前一项探测耗尽后续探测的时间
+func (h *HealthChecker) probe(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, h.timeout)
+}
+
+func (h *HealthChecker) check(ctx context.Context) (status HealthStatus) {
+	status.CheckedAt = time.Now()
+
+	probeCtx, cancel := h.probe(ctx)
+	hello, err := hello(probeCtx, h.client.client)
+	cancel()
+	if err != nil {
+		status.State, status.Error = HealthDown, err.Error()
+		return
+	}
+	status.Live = true
+	status.SetName = hello.SetName
+	status.Primary = hello.Primary
+	if hello.SetName == "" && (hello.IsWritablePrimary || hello.IsMaster) {
+		status.Primary = hello.Me
+	}
+
+	start := time.Now()
+	probeCtx, cancel = h.probe(ctx)
+	err = h.client.PingWithCtx(probeCtx, readpref.Primary())
+	cancel()
+	if err != nil {
+		status.State, status.Error = HealthDegraded, err.Error()
+		return
+	}
+	status.LatencyMS = time.Since(start).Milliseconds()
+	status.Ready = true
+	status.State = HealthUp
+
+	if hello.SetName == "" {
+		return
+	}
+
+	// 无可用从节点时服务器选择等待至超时，与 replSetGetStatus 并行执行以免影响成员状态的获取
+	secondary := make(chan bool, 1)
+	go func() {
+		probeCtx, cancel := h.probe(ctx)
+		defer cancel()
+		secondary <- h.client.PingWithCtx(probeCtx, readpref.Secondary()) == nil
+	}()
+
+	probeCtx, cancel = h.probe(ctx)
+	status.Members, err = h.members(probeCtx)
+	cancel()
+	status.SecondaryReachable = <-secondary
+	if !status.SecondaryReachable {
+		status.State = HealthDegraded
+	}
+	if err != nil {
+		status.State, status.Error = HealthDegraded, err.Error()
+		return
+	}
+	for _, m := range status.Members {
+		if m.LagMS > status.MaxLagMS {
+			status.MaxLagMS = m.LagMS
+		}
+	}
+	if h.maxLag > 0 && time.Duration(status.MaxLagMS)*time.Millisecond > h.maxLag {
+		status.State = HealthDegraded
+	}
+
+	return
+}
+
+// members 通过 replSetGetStatus 获取成员状态，无权限或未启用副本集时返回 nil
+func (h *HealthChecker) members(ctx context.Context) ([]MemberStatus, error) {
+	var res struct {
+		Members []struct {
+			Name       string    `bson:"name"`
+			StateStr   string    `bson:"stateStr"`
+			Health     float64   `bson:"health"`
+			OptimeDate time.Time `bson:"optimeDate"`
+		} `bson:"members"`
+	}
+
+	err := h.client.client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetGetStatus", Value: 1}}).Decode(&res)
+	if hasErrorCode(err, codeUnauthorized, codeNoReplicationEnabled, codeNotYetInitialized) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var primary time.Time
+	for _, m := range res.Members {
+		if m.StateStr == "PRIMARY" {
+			primary = m.OptimeDate
+		}
+	}
+
+	members := make([]MemberStatus, 0, len(res.Members))
+	for _, m := range res.Members {
+		member := MemberStatus{Name: m.Name, State: m.StateStr, Healthy: m.Health == 1}
+		if m.StateStr == "SECONDARY" && !primary.IsZero() && primary.After(m.OptimeDate) {
+			member.LagMS = primary.Sub(m.OptimeDate).Milliseconds()
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+func hasErrorCode(err error, codes ...int) bool {
+	var se mongo.ServerError
+	if !errors.As(err, &se) {
+		return false
+	}
+
+	for _, code := range codes {
+		if se.HasErrorCode(code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LivenessHandler 存活探针，存在可达节点时返回 200，否则返回 503，响应体为检查结果
+func (h *HealthChecker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		status := h.Status()
+		h.write(w, status, status.Live)
+	})
+}
+
+// ReadinessHandler 就绪探针，主节点可用时返回 200，否则返回 503，响应体为检查结果
+func (h *HealthChecker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		status := h.Status()
+		h.write(w, status, status.Ready)
+	})
+}
+
+// ServeHTTP 路径以 /live 或 /livez 结尾时按存活探针处理，否则按就绪探针处理
+func (h *HealthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	if strings.HasSuffix(path, "/live") || strings.HasSuffix(path, "/livez") {
+		h.LivenessHandler().ServeHTTP(w, r)
+		return
+	}
+
+	h.ReadinessHandler().ServeHTTP(w, r)
+}
+
+func (h *HealthChecker) write(w http.ResponseWriter, status HealthStatus, ok bool) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	_ = json.NewEncoder(w).Encode(status)
+}
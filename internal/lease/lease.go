@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+// Package lease 基于 collection 文档的分布式租约，同一时刻只有一个持有者
+package lease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"xtravisions.com/xmgo"
+)
+
+// ErrHeld return if lease is held by another owner
+var ErrHeld = errors.New("lease is held by another owner")
+
+type document struct {
+	Id        string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// Lease 分布式租约，租约文档与业务数据存储在同一 collection
+type Lease struct {
+	coll  xmgo.ICollection
+	id    string
+	owner string
+	ttl   time.Duration
+}
+
+// New 创建租约，持有者标识由主机名、进程号及随机 id 组成
+//
+//	@param coll 租约文档所在的 collection
+//	@param id 租约文档 id
+//	@param ttl 租约有效期
+func New(coll xmgo.ICollection, id string, ttl time.Duration) *Lease {
+	host, _ := os.Hostname()
+	return &Lease{
+		coll:  coll,
+		id:    id,
+		owner: fmt.Sprintf("%s-%d-%s", host, os.Getpid(), xmgo.NewObjectId().Hex()),
+		ttl:   ttl,
+	}
+}
+
+// Owner 获取当前持有者标识
+func (l *Lease) Owner() string {
+	return l.owner
+}
+
+// Acquire 获取或续期租约，租约过期或由当前持有者持有时可获取，否则返回 ErrHeld
+func (l *Lease) Acquire(ctx context.Context) error {
+	now := time.Now()
+	filter := xmgo.M{
+		"_id": l.id,
+		"$or": xmgo.A{
+			xmgo.M{"expiresAt": xmgo.M{"$lt": now}},
+			xmgo.M{"owner": l.owner},
+		},
+	}
+	update := xmgo.M{"$set": xmgo.M{"owner": l.owner, "expiresAt": now.Add(l.ttl)}}
+
+	var doc document
+	err := l.coll.FindWithCtx(ctx, filter).Apply(xmgo.Change{Update: update, Upsert: true, ReturnNew: true}, &doc)
+	if xmgo.IsDup(err) {
+		return ErrHeld
+	}
+
+	return err
+}
+
+// Keep 每 ttl/3 续期一次租约，直到 ctx 结束
+//
+//	续期失败时调用 cancel 结束持有租约期间的操作，并返回续期的错误；ctx 结束时返回 nil
+func (l *Lease) Keep(ctx context.Context, cancel context.CancelFunc) error {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := l.Acquire(ctx); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				cancel()
+				return fmt.Errorf("renew lease %s: %w", l.id, err)
+			}
+		}
+	}
+}
+
+// Release 释放当前持有者的租约
+func (l *Lease) Release(ctx context.Context) error {
+	return l.coll.RemoveWithCtx(ctx, xmgo.M{"_id": l.id, "owner": l.owner})
+}
@@ -0,0 +1,823 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"xtravisions.com/xmgo"
+	opts "xtravisions.com/xmgo/options"
+)
+
+// Aggregate 内存聚合，实现 xmgo.IAggregate
+//
+//	支持 $match、$project、$addFields/$set、$unset、$sort、$skip、$limit、$count、
+//	$group、$unwind、$lookup、$replaceRoot/$replaceWith 及 $sortByCount 阶段
+type Aggregate struct {
+	ctx        context.Context
+	collection *Collection
+	pipeline   interface{}
+	options    []opts.AggregateOptions
+	collation  *options.Collation
+}
+
+// ReadPreference 内存实现忽略该配置
+func (a *Aggregate) ReadPreference(_ *readpref.ReadPref) xmgo.IAggregate {
+	return a
+}
+
+// ReadConcern 内存实现忽略该配置
+func (a *Aggregate) ReadConcern(_ *readconcern.ReadConcern) xmgo.IAggregate {
+	return a
+}
+
+// Collation 内存实现仅支持 simple 排序规则
+func (a *Aggregate) Collation(collation *options.Collation) xmgo.IAggregate {
+	a.collation = collation
+	return a
+}
+
+func (a *Aggregate) All(results interface{}) (err error) {
+	defer a.wrapErr(&err, "aggregate.all")
+
+	docs, err := a.run()
+	if err != nil {
+		return err
+	}
+
+	return decodeAll(docs, results)
+}
+
+func (a *Aggregate) One(result interface{}) (err error) {
+	defer a.wrapErr(&err, "aggregate.one")
+
+	docs, err := a.run()
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return xmgo.ErrNoSuchDocuments
+	}
+
+	return decode(docs[0], result)
+}
+
+func (a *Aggregate) Iter() xmgo.ICursor {
+	docs, err := a.run()
+	a.wrapErr(&err, "aggregate.iter")
+
+	return &Cursor{docs: docs, err: err}
+}
+
+// wrapErr 为聚合的错误附加操作信息，配合 defer 使用
+func (a *Aggregate) wrapErr(err *error, op string) {
+	*err = xmgo.NewOpError(a.collection.db.name, a.collection.name, op, nil, *err)
+}
+
+func (a *Aggregate) run() ([]bson.D, error) {
+	if err := a.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkCollation(a.collation); err != nil {
+		return nil, err
+	}
+
+	stages, err := toArray(a.pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	db := a.collection.db
+	unlock, err := db.client.rlock(a.ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	docs := a.collection.snapshot()
+	for _, s := range stages {
+		stage, ok := s.(bson.D)
+		if !ok || len(stage) != 1 {
+			return nil, fmt.Errorf("%w: a pipeline stage specification object must contain exactly one field", ErrBadValue)
+		}
+		if docs, err = runStage(db, docs, stage[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	return docs, nil
+}
+
+func runStage(db *Database, docs []bson.D, stage bson.E) ([]bson.D, error) {
+	switch stage.Key {
+	case "$match":
+		cond, ok := stage.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("%w: $match expects an object", ErrBadValue)
+		}
+		res := make([]bson.D, 0, len(docs))
+		for _, doc := range docs {
+			ok, err := match(doc, cond)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				res = append(res, doc)
+			}
+		}
+		return res, nil
+	case "$project":
+		spec, ok := stage.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("%w: $project expects an object", ErrBadValue)
+		}
+		return mapDocs(docs, func(doc bson.D) (bson.D, error) {
+			return projectStage(doc, spec)
+		})
+	case "$addFields", "$set":
+		spec, ok := stage.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s expects an object", ErrBadValue, stage.Key)
+		}
+		return mapDocs(docs, func(doc bson.D) (bson.D, error) {
+			res := copyDoc(doc)
+			for _, f := range spec {
+				v, err := eval(doc, f.Value)
+				if err != nil {
+					return nil, err
+				}
+				if res, err = setField(res, splitPath(f.Key), v); err != nil {
+					return nil, err
+				}
+			}
+			return res, nil
+		})
+	case "$unset":
+		var fields []string
+		switch t := stage.Value.(type) {
+		case string:
+			fields = []string{t}
+		case bson.A:
+			for _, f := range t {
+				fields = append(fields, stringValue(f))
+			}
+		}
+		return mapDocs(docs, func(doc bson.D) (bson.D, error) {
+			res := copyDoc(doc)
+			for _, f := range fields {
+				res = unsetField(res, splitPath(f))
+			}
+			return res, nil
+		})
+	case "$sort":
+		spec, ok := stage.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("%w: $sort expects an object", ErrBadValue)
+		}
+		res := append([]bson.D(nil), docs...)
+		return res, sortDocs(res, spec)
+	case "$skip":
+		n, _ := toFloat(stage.Value)
+		if int(n) >= len(docs) {
+			return nil, nil
+		}
+		return docs[int(n):], nil
+	case "$limit":
+		n, _ := toFloat(stage.Value)
+		if int(n) < len(docs) {
+			return docs[:int(n)], nil
+		}
+		return docs, nil
+	case "$count":
+		if len(docs) == 0 {
+			return nil, nil
+		}
+		return []bson.D{{{Key: stringValue(stage.Value), Value: int32(len(docs))}}}, nil
+	case "$group":
+		spec, ok := stage.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("%w: $group expects an object", ErrBadValue)
+		}
+		return group(docs, spec)
+	case "$sortByCount":
+		res, err := group(docs, bson.D{{Key: "_id", Value: stage.Value}, {Key: "count", Value: bson.D{{Key: "$sum", Value: int32(1)}}}})
+		if err != nil {
+			return nil, err
+		}
+		return res, sortDocs(res, bson.D{{Key: "count", Value: int32(-1)}})
+	case "$unwind":
+		return unwind(docs, stage.Value)
+	case "$lookup":
+		spec, ok := stage.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("%w: $lookup expects an object", ErrBadValue)
+		}
+		return lookupStage(db, docs, spec)
+	case "$replaceRoot", "$replaceWith":
+		expr := stage.Value
+		if stage.Key == "$replaceRoot" {
+			spec, _ := stage.Value.(bson.D)
+			expr, _ = getField(spec, []string{"newRoot"})
+		}
+		return mapDocs(docs, func(doc bson.D) (bson.D, error) {
+			v, err := eval(doc, expr)
+			if err != nil {
+				return nil, err
+			}
+			d, ok := v.(bson.D)
+			if !ok {
+				return nil, fmt.Errorf("%w: 'newRoot' expression must evaluate to an object", ErrBadValue)
+			}
+			return d, nil
+		})
+	}
+
+	return nil, fmt.Errorf("%w: aggregation stage %s", ErrNotSupported, stage.Key)
+}
+
+func mapDocs(docs []bson.D, fn func(doc bson.D) (bson.D, error)) ([]bson.D, error) {
+	res := make([]bson.D, 0, len(docs))
+	for _, doc := range docs {
+		d, err := fn(doc)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+
+	return res, nil
+}
+
+func isFlag(v interface{}) bool {
+	switch v.(type) {
+	case bool, int32, int64, float64:
+		return true
+	}
+
+	return false
+}
+
+func projectStage(doc bson.D, spec bson.D) (bson.D, error) {
+	computed := false
+	for _, f := range spec {
+		if !isFlag(f.Value) {
+			computed = true
+		}
+	}
+	if !computed {
+		return project(doc, spec)
+	}
+
+	res := bson.D{}
+	includeId := true
+	for _, f := range spec {
+		if f.Key == "_id" && isFlag(f.Value) {
+			includeId = truthy(f.Value)
+		}
+	}
+	if includeId {
+		if id, ok := getField(doc, []string{"_id"}); ok {
+			res = append(res, bson.E{Key: "_id", Value: id})
+		}
+	}
+
+	for _, f := range spec {
+		var err error
+		switch {
+		case isFlag(f.Value) && f.Key == "_id":
+			continue
+		case isFlag(f.Value) && truthy(f.Value):
+			res = include(res, doc, splitPath(f.Key))
+		case isFlag(f.Value):
+			return nil, fmt.Errorf("%w: cannot do exclusion on field %s in inclusion projection", ErrBadValue, f.Key)
+		default:
+			var v interface{}
+			if v, err = eval(doc, f.Value); err != nil {
+				return nil, err
+			}
+			if res, err = setField(res, splitPath(f.Key), v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return copyDoc(res), nil
+}
+
+func unwind(docs []bson.D, arg interface{}) ([]bson.D, error) {
+	var path, indexField string
+	var preserve bool
+
+	switch t := arg.(type) {
+	case string:
+		path = t
+	case bson.D:
+		for _, e := range t {
+			switch e.Key {
+			case "path":
+				path = stringValue(e.Value)
+			case "includeArrayIndex":
+				indexField = stringValue(e.Value)
+			case "preserveNullAndEmptyArrays":
+				preserve = truthy(e.Value)
+			}
+		}
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("%w: $unwind path must be prefixed with a '$'", ErrBadValue)
+	}
+	fields := splitPath(path[1:])
+
+	var res []bson.D
+	for _, doc := range docs {
+		v, ok := getField(doc, fields)
+		a, isArray := v.(bson.A)
+
+		if !isArray {
+			if (!ok || v == nil) && !preserve {
+				continue
+			}
+			d := copyDoc(doc)
+			if indexField != "" {
+				d = append(d, bson.E{Key: indexField, Value: nil})
+			}
+			res = append(res, d)
+			continue
+		}
+
+		if len(a) == 0 && preserve {
+			d := unsetField(copyDoc(doc), fields)
+			if indexField != "" {
+				d = append(d, bson.E{Key: indexField, Value: nil})
+			}
+			res = append(res, d)
+		}
+
+		for i, item := range a {
+			d, err := setField(copyDoc(doc), fields, deepCopy(item))
+			if err != nil {
+				return nil, err
+			}
+			if indexField != "" {
+				d = append(d, bson.E{Key: indexField, Value: int64(i)})
+			}
+			res = append(res, d)
+		}
+	}
+
+	return res, nil
+}
+
+func lookupStage(db *Database, docs []bson.D, spec bson.D) ([]bson.D, error) {
+	var from, localField, foreignField, as string
+	for _, e := range spec {
+		switch e.Key {
+		case "from":
+			from = stringValue(e.Value)
+		case "localField":
+			localField = stringValue(e.Value)
+		case "foreignField":
+			foreignField = stringValue(e.Value)
+		case "as":
+			as = stringValue(e.Value)
+		default:
+			return nil, fmt.Errorf("%w: $lookup option %s", ErrNotSupported, e.Key)
+		}
+	}
+
+	foreign := db.collection(from).docs
+	return mapDocs(docs, func(doc bson.D) (bson.D, error) {
+		locals := expand(lookup(doc, splitPath(localField)))
+		if len(locals) == 0 {
+			locals = []interface{}{nil}
+		}
+
+		joined := bson.A{}
+		for _, f := range foreign {
+			for _, l := range locals {
+				if matchEq(lookup(f, splitPath(foreignField)), l) {
+					joined = append(joined, copyDoc(f))
+					break
+				}
+			}
+		}
+
+		return setField(copyDoc(doc), splitPath(as), joined)
+	})
+}
+
+type groupState struct {
+	id     interface{}
+	fields bson.D
+	counts map[string]int
+}
+
+func group(docs []bson.D, spec bson.D) ([]bson.D, error) {
+	var idExpr interface{}
+	var accs bson.D
+	for _, e := range spec {
+		if e.Key == "_id" {
+			idExpr = e.Value
+			continue
+		}
+		acc, ok := e.Value.(bson.D)
+		if !ok || len(acc) != 1 {
+			return nil, fmt.Errorf("%w: the field '%s' must be an accumulator object", ErrBadValue, e.Key)
+		}
+		accs = append(accs, e)
+	}
+
+	var groups []*groupState
+	for _, doc := range docs {
+		id, err := eval(doc, idExpr)
+		if err != nil {
+			return nil, err
+		}
+
+		var g *groupState
+		for _, candidate := range groups {
+			if equal(candidate.id, id) {
+				g = candidate
+				break
+			}
+		}
+		if g == nil {
+			g = &groupState{id: id, counts: make(map[string]int)}
+			groups = append(groups, g)
+		}
+
+		for _, a := range accs {
+			acc := a.Value.(bson.D)[0]
+			v, err := eval(doc, acc.Value)
+			if err != nil {
+				return nil, err
+			}
+			if err = accumulate(g, a.Key, acc.Key, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	res := make([]bson.D, 0, len(groups))
+	for _, g := range groups {
+		d := bson.D{{Key: "_id", Value: g.id}}
+		for _, a := range accs {
+			v, _ := getField(g.fields, []string{a.Key})
+			if a.Value.(bson.D)[0].Key == "$avg" {
+				if n := g.counts[a.Key]; n > 0 {
+					f, _ := toFloat(v)
+					v = f / float64(n)
+				} else {
+					v = nil
+				}
+			}
+			d = append(d, bson.E{Key: a.Key, Value: v})
+		}
+		res = append(res, d)
+	}
+
+	return res, nil
+}
+
+func accumulate(g *groupState, field string, op string, v interface{}) error {
+	old, exists := getField(g.fields, []string{field})
+	set := func(v interface{}) {
+		for i := range g.fields {
+			if g.fields[i].Key == field {
+				g.fields[i].Value = v
+				return
+			}
+		}
+		g.fields = append(g.fields, bson.E{Key: field, Value: v})
+	}
+
+	switch op {
+	case "$sum", "$avg":
+		if !exists {
+			set(int32(0))
+			old = int32(0)
+		}
+		if _, ok := toFloat(v); ok {
+			set(add(old, v))
+			g.counts[field]++
+		}
+	case "$count":
+		if !exists {
+			old = int32(0)
+		}
+		set(add(old, int32(1)))
+	case "$min", "$max":
+		if v == nil {
+			if !exists {
+				set(nil)
+			}
+			return nil
+		}
+		c := compare(v, old)
+		if !exists || old == nil || (op == "$min" && c < 0) || (op == "$max" && c > 0) {
+			set(v)
+		}
+	case "$first":
+		if !exists {
+			set(v)
+		}
+	case "$last":
+		set(v)
+	case "$push", "$addToSet":
+		a, _ := old.(bson.A)
+		if a == nil {
+			a = bson.A{}
+		}
+		if op == "$push" || !containsValue(a, v) {
+			a = append(a, v)
+		}
+		set(a)
+	default:
+		return fmt.Errorf("%w: accumulator %s", ErrNotSupported, op)
+	}
+
+	return nil
+}
+
+// exprField 表达式语义下获取字段值，数组中的文档逐个取值
+func exprField(v interface{}, path []string) (interface{}, bool) {
+	if len(path) == 0 {
+		return v, true
+	}
+
+	switch t := v.(type) {
+	case bson.D:
+		for _, e := range t {
+			if e.Key == path[0] {
+				return exprField(e.Value, path[1:])
+			}
+		}
+	case bson.A:
+		res := bson.A{}
+		for _, item := range t {
+			if iv, ok := exprField(item, path); ok {
+				res = append(res, iv)
+			}
+		}
+		return res, true
+	}
+
+	return nil, false
+}
+
+// eval 计算聚合表达式
+func eval(doc bson.D, expr interface{}) (interface{}, error) {
+	switch t := expr.(type) {
+	case string:
+		switch {
+		case t == "$$ROOT" || t == "$$CURRENT":
+			return doc, nil
+		case strings.HasPrefix(t, "$$"):
+			return nil, fmt.Errorf("%w: variable %s", ErrNotSupported, t)
+		case strings.HasPrefix(t, "$"):
+			v, _ := exprField(doc, splitPath(t[1:]))
+			return v, nil
+		}
+		return t, nil
+	case bson.A:
+		res := make(bson.A, len(t))
+		for i, item := range t {
+			v, err := eval(doc, item)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = v
+		}
+		return res, nil
+	case bson.D:
+		if isOperatorDoc(t) {
+			if len(t) != 1 {
+				return nil, fmt.Errorf("%w: an expression specification must contain exactly one field", ErrBadValue)
+			}
+			return evalOperator(doc, t[0].Key, t[0].Value)
+		}
+		res := bson.D{}
+		for _, e := range t {
+			v, err := eval(doc, e.Value)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, bson.E{Key: e.Key, Value: v})
+		}
+		return res, nil
+	}
+
+	return expr, nil
+}
+
+func evalArgs(doc bson.D, arg interface{}) ([]interface{}, error) {
+	a, ok := arg.(bson.A)
+	if !ok {
+		a = bson.A{arg}
+	}
+
+	res := make([]interface{}, len(a))
+	for i, item := range a {
+		v, err := eval(doc, item)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = v
+	}
+
+	return res, nil
+}
+
+func evalOperator(doc bson.D, op string, arg interface{}) (interface{}, error) {
+	if op == "$literal" {
+		return arg, nil
+	}
+	if op == "$cond" {
+		if d, ok := arg.(bson.D); ok {
+			ifv, _ := getField(d, []string{"if"})
+			thenv, _ := getField(d, []string{"then"})
+			elsev, _ := getField(d, []string{"else"})
+			arg = bson.A{ifv, thenv, elsev}
+		}
+	}
+
+	args, err := evalArgs(doc, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "$add", "$multiply":
+		var res interface{} = int32(0)
+		if op == "$multiply" {
+			res = int32(1)
+		}
+		for _, v := range args {
+			if v == nil {
+				return nil, nil
+			}
+			if _, ok := toFloat(v); !ok {
+				return nil, fmt.Errorf("%w: %s only supports numeric types", ErrBadValue, op)
+			}
+			if op == "$add" {
+				res = add(res, v)
+			} else {
+				res = multiply(res, v)
+			}
+		}
+		return res, nil
+	case "$subtract", "$divide", "$mod":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%w: %s takes exactly 2 arguments", ErrBadValue, op)
+		}
+		if args[0] == nil || args[1] == nil {
+			return nil, nil
+		}
+		a, ok1 := toFloat(args[0])
+		b, ok2 := toFloat(args[1])
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("%w: %s only supports numeric types", ErrBadValue, op)
+		}
+		switch op {
+		case "$subtract":
+			return add(args[0], multiply(args[1], int32(-1))), nil
+		case "$divide":
+			if b == 0 {
+				return nil, fmt.Errorf("%w: can't divide by zero", ErrBadValue)
+			}
+			return a / b, nil
+		}
+		if b == 0 {
+			return nil, fmt.Errorf("%w: can't $mod by zero", ErrBadValue)
+		}
+		return float64(int64(a) % int64(b)), nil
+	case "$concat":
+		var sb strings.Builder
+		for _, v := range args {
+			if v == nil {
+				return nil, nil
+			}
+			sb.WriteString(stringValue(v))
+		}
+		return sb.String(), nil
+	case "$toLower", "$toUpper":
+		s := stringValue(args[0])
+		if op == "$toLower" {
+			return strings.ToLower(s), nil
+		}
+		return strings.ToUpper(s), nil
+	case "$ifNull":
+		for _, v := range args {
+			if v != nil {
+				return v, nil
+			}
+		}
+		return nil, nil
+	case "$size":
+		a, ok := args[0].(bson.A)
+		if !ok {
+			return nil, fmt.Errorf("%w: the argument to $size must be an array", ErrBadValue)
+		}
+		return int32(len(a)), nil
+	case "$arrayElemAt":
+		a, ok := args[0].(bson.A)
+		n, _ := toFloat(args[1])
+		if !ok {
+			return nil, nil
+		}
+		i := int(n)
+		if i < 0 {
+			i += len(a)
+		}
+		if i < 0 || i >= len(a) {
+			return nil, nil
+		}
+		return a[i], nil
+	case "$in":
+		a, ok := args[1].(bson.A)
+		if !ok {
+			return nil, fmt.Errorf("%w: $in requires an array as a second argument", ErrBadValue)
+		}
+		return containsValue(a, args[0]), nil
+	case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte", "$cmp":
+		c := compare(args[0], args[1])
+		switch op {
+		case "$eq":
+			return c == 0, nil
+		case "$ne":
+			return c != 0, nil
+		case "$gt":
+			return c > 0, nil
+		case "$gte":
+			return c >= 0, nil
+		case "$lt":
+			return c < 0, nil
+		case "$lte":
+			return c <= 0, nil
+		}
+		switch {
+		case c < 0:
+			return int32(-1), nil
+		case c > 0:
+			return int32(1), nil
+		}
+		return int32(0), nil
+	case "$and":
+		for _, v := range args {
+			if !truthy(v) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case "$or":
+		for _, v := range args {
+			if truthy(v) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$not":
+		return !truthy(args[0]), nil
+	case "$cond":
+		if len(args) != 3 {
+			return nil, fmt.Errorf("%w: $cond takes exactly 3 arguments", ErrBadValue)
+		}
+		if truthy(args[0]) {
+			return args[1], nil
+		}
+		return args[2], nil
+	case "$sum", "$avg", "$min", "$max":
+		values := args
+		if len(args) == 1 {
+			if a, ok := args[0].(bson.A); ok {
+				values = a
+			}
+		}
+		g := &groupState{counts: make(map[string]int)}
+		for _, v := range values {
+			if err = accumulate(g, "v", op, v); err != nil {
+				return nil, err
+			}
+		}
+		v, _ := getField(g.fields, []string{"v"})
+		if op == "$avg" {
+			if g.counts["v"] == 0 {
+				return nil, nil
+			}
+			f, _ := toFloat(v)
+			return f / float64(g.counts["v"]), nil
+		}
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("%w: expression operator %s", ErrNotSupported, op)
+}
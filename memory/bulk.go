@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"xtravisions.com/xmgo"
+)
+
+var _ xmgo.IBulk = (*Bulk)(nil)
+
+// Bulk 内存批量写操作，实现 xmgo.IBulk
+type Bulk struct {
+	coll *Collection
+
+	queue   []writeModel
+	models  []mongo.WriteModel
+	ordered *bool
+}
+
+// add 添加写操作，models 保存与 xmgo.Bulk 一致的驱动写操作，用于关联 xmgo.WriteErrors
+func (b *Bulk) add(m writeModel, wm mongo.WriteModel) xmgo.IBulk {
+	b.queue = append(b.queue, m)
+	b.models = append(b.models, wm)
+	return b
+}
+
+func (b *Bulk) SetOrdered(ordered bool) xmgo.IBulk {
+	b.ordered = &ordered
+	return b
+}
+
+func (b *Bulk) InsertOne(doc interface{}) xmgo.IBulk {
+	return b.add(writeModel{insert: doc}, mongo.NewInsertOneModel().SetDocument(doc))
+}
+
+func (b *Bulk) Remove(filter interface{}) xmgo.IBulk {
+	return b.add(writeModel{filter: filter, remove: true}, mongo.NewDeleteOneModel().SetFilter(filter))
+}
+
+func (b *Bulk) RemoveId(id interface{}) xmgo.IBulk {
+	b.Remove(bson.M{"_id": id})
+	return b
+}
+
+func (b *Bulk) RemoveAll(filter interface{}) xmgo.IBulk {
+	return b.add(writeModel{filter: filter, remove: true, many: true}, mongo.NewDeleteManyModel().SetFilter(filter))
+}
+
+func (b *Bulk) Upsert(filter interface{}, replacement interface{}) xmgo.IBulk {
+	return b.add(writeModel{filter: filter, update: replacement, replace: true, upsert: true},
+		mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(replacement).SetUpsert(true))
+}
+
+func (b *Bulk) UpsertOne(filter interface{}, update interface{}) xmgo.IBulk {
+	return b.add(writeModel{filter: filter, update: update, upsert: true},
+		mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true))
+}
+
+func (b *Bulk) UpsertId(id interface{}, replacement interface{}) xmgo.IBulk {
+	b.Upsert(bson.M{"_id": id}, replacement)
+	return b
+}
+
+func (b *Bulk) UpdateOne(filter interface{}, update interface{}) xmgo.IBulk {
+	return b.add(writeModel{filter: filter, update: update}, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update))
+}
+
+func (b *Bulk) UpdateId(id interface{}, update interface{}) xmgo.IBulk {
+	b.UpdateOne(bson.M{"_id": id}, update)
+	return b
+}
+
+func (b *Bulk) UpdateAll(filter interface{}, update interface{}) xmgo.IBulk {
+	return b.add(writeModel{filter: filter, update: update, many: true}, mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(update))
+}
+
+func (b *Bulk) Run() (*xmgo.BulkResult, error) {
+	return b.RunWithCtx(context.TODO())
+}
+
+func (b *Bulk) RunWithCtx(ctx context.Context) (result *xmgo.BulkResult, err error) {
+	defer b.coll.wrapErr(&err, "bulk", nil)
+
+	_, result, err = b.run(ctx)
+	if err != nil {
+		// In original mgo, queue is not reset in case of error.
+		return result, xmgo.WrapWriteError(err, nil, b.models)
+	}
+
+	// Empty the queue for possible reuse, as per mgo's behavior.
+	b.queue, b.models = nil, nil
+
+	return result, nil
+}
+
+// run 依次执行全部写操作，错误以 mongo.BulkWriteException 返回
+func (b *Bulk) run(ctx context.Context) (ids []interface{}, result *xmgo.BulkResult, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if len(b.queue) == 0 {
+		return nil, nil, mongo.ErrEmptySlice
+	}
+
+	ordered := b.ordered == nil || *b.ordered
+	result = &xmgo.BulkResult{UpsertedIDs: make(map[int64]interface{})}
+
+	c := b.coll
+	unlock, err := c.db.client.lock(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	coll := c.db.ensure(c.name)
+
+	var exception mongo.BulkWriteException
+	for i, m := range b.queue {
+		res, err := m.apply(coll)
+		if err != nil {
+			we := mongo.WriteError{Index: i, Message: err.Error()}
+			if !errors.As(err, &we) {
+				we.Code = 2
+			}
+			we.Index = i
+			exception.WriteErrors = append(exception.WriteErrors, mongo.BulkWriteError{WriteError: we})
+			if ordered {
+				break
+			}
+			continue
+		}
+
+		if m.insert != nil {
+			ids = append(ids, res.insertedID)
+		}
+		result.InsertedCount += res.inserted
+		result.MatchedCount += res.matched
+		result.ModifiedCount += res.modified
+		result.DeletedCount += res.deleted
+		result.UpsertedCount += res.upserted
+		if res.upserted > 0 {
+			result.UpsertedIDs[int64(i)] = res.upsertedID
+		}
+	}
+
+	if len(exception.WriteErrors) > 0 {
+		return ids, result, exception
+	}
+
+	return ids, result, nil
+}
@@ -0,0 +1,344 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+// Package memory xmgo 接口的内存实现，用于无需 mongod 的单元测试
+//
+//	支持常用的查询及更新操作符、排序/跳过/限制/投影、唯一索引及钩子
+//	不支持的操作返回 ErrNotSupported
+package memory
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"xtravisions.com/xmgo"
+	opts "xtravisions.com/xmgo/options"
+)
+
+// Version 内存实现报告的服务器版本
+const Version = "memory"
+
+var (
+	_ xmgo.IClient   = (*Client)(nil)
+	_ xmgo.IDatabase = (*Database)(nil)
+)
+
+// Client 内存连接，实现 xmgo.IClient
+type Client struct {
+	mu sync.RWMutex
+	// tx 事务期间持有写锁，其他上下文的操作持有读锁，从而等待事务结束
+	tx sync.RWMutex
+	// owner 执行事务回调的 goroutine id，无进行中的事务时为 0
+	owner     int64
+	databases map[string]map[string]*collection
+}
+
+type transactionKey struct{}
+
+// NewClient 创建内存连接，同一连接打开的同名数据库共享数据
+func NewClient() *Client {
+	return &Client{databases: make(map[string]map[string]*collection)}
+}
+
+func (c *Client) Close() error {
+	return nil
+}
+
+func (c *Client) Database(name string, _ ...*opts.DatabaseOptions) xmgo.IDatabase {
+	return &Database{client: c, name: name}
+}
+
+func (c *Client) Ping(_ int64) error {
+	return nil
+}
+
+func (c *Client) PingWithCtx(ctx context.Context, _ ...*readpref.ReadPref) error {
+	return ctx.Err()
+}
+
+// Session 内存实现不支持会话，请使用 DoTransaction
+func (c *Client) Session(_ ...*opts.SessionOptions) (*xmgo.Session, error) {
+	return nil, ErrNotSupported
+}
+
+func (c *Client) DoTransaction(callback func(sessCtx context.Context) (interface{}, error), opts ...*opts.TransactionOptions) (interface{}, error) {
+	return c.DoTransactionWithCtx(context.TODO(), callback, opts...)
+}
+
+// DoTransactionWithCtx 执行回调，回调返回错误时恢复执行前的全部数据
+//
+//	结束后执行 xmgo.OnCommit 或 xmgo.OnRollback 注册的回调
+//	事务期间其他上下文的操作等待事务结束后执行；回调中的操作需使用回调传入的上下文，
+//	在执行回调的 goroutine 中使用其他上下文（包括不带 ctx 的方法）时返回 ErrTransactionContext；
+//	PropagationRequiresNew 的内层事务已提交的数据仍会随外层事务回滚撤销
+func (c *Client) DoTransactionWithCtx(ctx context.Context, callback func(sessCtx context.Context) (interface{}, error), o ...*opts.TransactionOptions) (interface{}, error) {
+	if handled, result, err := xmgo.PropagateTransaction(ctx, callback, o...); handled {
+		return result, err
+	}
+
+	ctx, callbacks := xmgo.WithTransactionCallbacks(ctx)
+	result, err := c.transaction(ctx, callbacks, callback)
+
+	callbacks.Finish(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// transaction 持有事务锁执行回调，回调返回错误时恢复执行前的全部数据
+//
+//	嵌套的事务已由外层事务持有事务锁
+func (c *Client) transaction(ctx context.Context, callbacks *xmgo.TransactionCallbacks, callback func(sessCtx context.Context) (interface{}, error)) (interface{}, error) {
+	if !c.inTransaction(ctx) {
+		if c.reentrant() {
+			return nil, ErrTransactionContext
+		}
+
+		c.tx.Lock()
+		atomic.StoreInt64(&c.owner, goid())
+		defer func() {
+			atomic.StoreInt64(&c.owner, 0)
+			c.tx.Unlock()
+		}()
+		ctx = context.WithValue(ctx, transactionKey{}, c)
+	}
+
+	saved := c.snapshot()
+
+	result, err := callback(ctx)
+	err = callbacks.Check(err)
+	if err != nil {
+		c.mu.Lock()
+		c.databases = saved
+		c.mu.Unlock()
+	}
+
+	return result, err
+}
+
+// Watch 内存实现不支持 change stream
+func (c *Client) Watch(pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return c.WatchWithCtx(context.TODO(), pipeline, opts...)
+}
+
+// WatchWithCtx 内存实现不支持 change stream
+func (c *Client) WatchWithCtx(_ context.Context, _ interface{}, _ ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return nil, ErrNotSupported
+}
+
+func (c *Client) ServerVersion() string {
+	return Version
+}
+
+// inTransaction 上下文是否属于当前连接进行中的事务
+func (c *Client) inTransaction(ctx context.Context) bool {
+	return ctx.Value(transactionKey{}) == c
+}
+
+// reentrant 判断当前 goroutine 是否正在执行事务回调，此时未使用回调上下文的操作等待事务结束会导致死锁
+func (c *Client) reentrant() bool {
+	owner := atomic.LoadInt64(&c.owner)
+	return owner != 0 && owner == goid()
+}
+
+// lock 获取数据写锁，不属于进行中事务的操作先等待事务结束
+//
+//	事务回调中未使用回调上下文时返回 ErrTransactionContext
+func (c *Client) lock(ctx context.Context) (unlock func(), err error) {
+	if c.inTransaction(ctx) {
+		c.mu.Lock()
+		return c.mu.Unlock, nil
+	}
+	if c.reentrant() {
+		return nil, ErrTransactionContext
+	}
+
+	c.tx.RLock()
+	c.mu.Lock()
+	return func() {
+		c.mu.Unlock()
+		c.tx.RUnlock()
+	}, nil
+}
+
+// rlock 获取数据读锁，不属于进行中事务的操作先等待事务结束
+//
+//	事务回调中未使用回调上下文时返回 ErrTransactionContext
+func (c *Client) rlock(ctx context.Context) (unlock func(), err error) {
+	if c.inTransaction(ctx) {
+		c.mu.RLock()
+		return c.mu.RUnlock, nil
+	}
+	if c.reentrant() {
+		return nil, ErrTransactionContext
+	}
+
+	c.tx.RLock()
+	c.mu.RLock()
+	return func() {
+		c.mu.RUnlock()
+		c.tx.RUnlock()
+	}, nil
+}
+
+// goid 获取当前 goroutine 的 id，仅用于检测事务回调中的重入调用
+func goid() int64 {
+	var buf [64]byte
+	s := strings.TrimPrefix(string(buf[:runtime.Stack(buf[:], false)]), "goroutine ")
+	if i := strings.IndexByte(s, ' '); i > 0 {
+		id, _ := strconv.ParseInt(s[:i], 10, 64)
+		return id
+	}
+
+	return 0
+}
+
+// snapshot 复制全部数据，调用方需持有事务锁
+func (c *Client) snapshot() map[string]map[string]*collection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	res := make(map[string]map[string]*collection, len(c.databases))
+	for db, colls := range c.databases {
+		res[db] = make(map[string]*collection, len(colls))
+		for name, coll := range colls {
+			res[db][name] = coll.clone()
+		}
+	}
+
+	return res
+}
+
+// Database 内存数据库，实现 xmgo.IDatabase
+type Database struct {
+	client *Client
+	name   string
+}
+
+func (d *Database) Name() string {
+	return d.name
+}
+
+// Clone 内存实现忽略读写参数，返回指向相同数据的数据库
+func (d *Database) Clone(_ ...*opts.DatabaseOptions) xmgo.IDatabase {
+	return &Database{client: d.client, name: d.name}
+}
+
+func (d *Database) Collection(name string) xmgo.ICollection {
+	return &Collection{db: d, name: name}
+}
+
+func (d *Database) ModelCollection(model xmgo.IModel) xmgo.ICollection {
+	return d.Collection(model.CollectionName())
+}
+
+func (d *Database) CollectionNames() ([]string, error) {
+	return d.CollectionNamesWithCtx(context.TODO())
+}
+
+func (d *Database) CollectionNamesWithCtx(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock, err := d.client.rlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	names := make([]string, 0)
+	for name := range d.client.databases[d.name] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (d *Database) Drop() error {
+	return d.DropWithCtx(context.TODO())
+}
+
+func (d *Database) DropWithCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	unlock, err := d.client.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	delete(d.client.databases, d.name)
+	return nil
+}
+
+// Watch 内存实现不支持 change stream
+func (d *Database) Watch(pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return d.WatchWithCtx(context.TODO(), pipeline, opts...)
+}
+
+// WatchWithCtx 内存实现不支持 change stream
+func (d *Database) WatchWithCtx(_ context.Context, _ interface{}, _ ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return nil, ErrNotSupported
+}
+
+// RunCommand 内存实现不支持直接执行命令
+func (d *Database) RunCommand(runCommand interface{}, opts ...opts.RunCommandOptions) *mongo.SingleResult {
+	return d.RunCommandWithCtx(context.TODO(), runCommand, opts...)
+}
+
+// RunCommandWithCtx 内存实现不支持直接执行命令
+func (d *Database) RunCommandWithCtx(_ context.Context, _ interface{}, _ ...opts.RunCommandOptions) *mongo.SingleResult {
+	return mongo.NewSingleResultFromDocument(bson.D{}, ErrNotSupported, nil)
+}
+
+// collection 获取数据，调用方需持有锁
+func (d *Database) collection(name string) *collection {
+	if coll, ok := d.client.databases[d.name][name]; ok {
+		return coll
+	}
+
+	return newCollection(d.name + "." + name)
+}
+
+// ensure 获取数据，不存在时创建，调用方需持有写锁
+func (d *Database) ensure(name string) *collection {
+	colls, ok := d.client.databases[d.name]
+	if !ok {
+		colls = make(map[string]*collection)
+		d.client.databases[d.name] = colls
+	}
+
+	coll, ok := colls[name]
+	if !ok {
+		coll = newCollection(d.name + "." + name)
+		colls[name] = coll
+	}
+
+	return coll
+}
+
+var (
+	_ xmgo.IClient     = (*Client)(nil)
+	_ xmgo.IDatabase   = (*Database)(nil)
+	_ xmgo.ICollection = (*Collection)(nil)
+	_ xmgo.IQuery      = (*Query)(nil)
+	_ xmgo.IAggregate  = (*Aggregate)(nil)
+	_ xmgo.ICursor     = (*Cursor)(nil)
+	_ xmgo.IBulk       = (*Bulk)(nil)
+)
@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"xtravisions.com/xmgo"
+	"xtravisions.com/xmgo/memory"
+)
+
+func count(t *testing.T, coll xmgo.ICollection) int64 {
+	t.Helper()
+
+	n, err := coll.FindWithCtx(context.Background(), xmgo.M{}).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestDoTransactionCommit(t *testing.T) {
+	ctx := context.Background()
+	client := memory.NewClient()
+	coll := client.Database("test").Collection("users")
+
+	committed := false
+	_, err := client.DoTransactionWithCtx(ctx, func(sessCtx context.Context) (interface{}, error) {
+		_ = xmgo.OnCommit(sessCtx, func() { committed = true })
+		return coll.InsertOneWithCtx(sessCtx, xmgo.M{"_id": 1})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !committed || count(t, coll) != 1 {
+		t.Errorf("committed = %v, count = %d, want true, 1", committed, count(t, coll))
+	}
+}
+
+func TestDoTransactionRollback(t *testing.T) {
+	ctx := context.Background()
+	client := memory.NewClient()
+	coll := client.Database("test").Collection("users")
+	if _, err := coll.InsertOneWithCtx(ctx, xmgo.M{"_id": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	var rollbackErr error
+	_, err := client.DoTransactionWithCtx(ctx, func(sessCtx context.Context) (interface{}, error) {
+		_ = xmgo.OnRollback(sessCtx, func(err error) { rollbackErr = err })
+		if _, err := coll.InsertOneWithCtx(sessCtx, xmgo.M{"_id": 2}); err != nil {
+			return nil, err
+		}
+		return coll.InsertOneWithCtx(sessCtx, xmgo.M{"_id": 1})
+	})
+	if !xmgo.IsDup(err) || !xmgo.IsDup(rollbackErr) {
+		t.Fatalf("DoTransactionWithCtx() = %v, rollback callback got %v, want duplicate key", err, rollbackErr)
+	}
+
+	if n := count(t, coll); n != 1 {
+		t.Errorf("count after rollback = %d, want 1", n)
+	}
+}
+
+// 事务回滚不影响其他 goroutine 在事务期间发起的写入
+func TestDoTransactionConcurrentWrite(t *testing.T) {
+	ctx := context.Background()
+	client := memory.NewClient()
+	coll := client.Database("test").Collection("users")
+
+	written := make(chan error, 1)
+	_, err := client.DoTransactionWithCtx(ctx, func(sessCtx context.Context) (interface{}, error) {
+		if _, err := coll.InsertOneWithCtx(sessCtx, xmgo.M{"_id": "tx"}); err != nil {
+			return nil, err
+		}
+
+		go func() {
+			_, err := coll.InsertOneWithCtx(ctx, xmgo.M{"_id": "outside"})
+			written <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		return nil, errors.New("abort")
+	})
+	if err == nil {
+		t.Fatal("DoTransactionWithCtx() error = nil, want abort")
+	}
+	if err = <-written; err != nil {
+		t.Fatalf("concurrent InsertOneWithCtx() error = %v", err)
+	}
+
+	var ids []string
+	if err = coll.FindWithCtx(ctx, xmgo.M{}).Distinct("_id", &ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "outside" {
+		t.Errorf("ids = %v, want [outside]", ids)
+	}
+}
+
+// 事务回调中未使用回调上下文时返回错误，而不是等待事务结束导致死锁
+func TestDoTransactionWrongContext(t *testing.T) {
+	ctx := context.Background()
+	client := memory.NewClient()
+	coll := client.Database("test").Collection("users")
+
+	var inner []error
+	_, err := client.DoTransactionWithCtx(ctx, func(sessCtx context.Context) (interface{}, error) {
+		_, err := coll.InsertOne(xmgo.M{"_id": 1})
+		inner = append(inner, err)
+		_, err = coll.FindWithCtx(ctx, xmgo.M{}).Count()
+		inner = append(inner, err)
+		_, err = client.DoTransactionWithCtx(ctx, func(context.Context) (interface{}, error) { return nil, nil })
+		inner = append(inner, err)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, err := range inner {
+		if !errors.Is(err, memory.ErrTransactionContext) {
+			t.Errorf("call %d error = %v, want ErrTransactionContext", i, err)
+		}
+	}
+
+	// 事务结束后不带 ctx 的方法恢复正常
+	if _, err = coll.InsertOne(xmgo.M{"_id": 1}); err != nil {
+		t.Errorf("InsertOne() after transaction = %v", err)
+	}
+}
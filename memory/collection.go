@@ -0,0 +1,650 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"xtravisions.com/xmgo"
+	"xtravisions.com/xmgo/hooks"
+	opts "xtravisions.com/xmgo/options"
+)
+
+var _ xmgo.ICollection = (*Collection)(nil)
+
+// Collection 内存 collection，实现 xmgo.ICollection
+type Collection struct {
+	db   *Database
+	name string
+}
+
+func (c *Collection) Name() string {
+	return c.name
+}
+
+// Clone 内存实现忽略读写参数，返回指向相同数据的 collection
+func (c *Collection) Clone(_ ...*opts.CollectionOptions) xmgo.ICollection {
+	return &Collection{db: c.db, name: c.name}
+}
+
+func (c *Collection) Drop() (err error) {
+	defer c.wrapErr(&err, "drop", nil)
+
+	unlock, err := c.db.client.lock(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	delete(c.db.client.databases[c.db.name], c.name)
+	return nil
+}
+
+// Watch 内存实现不支持 change stream
+func (c *Collection) Watch(pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return c.WatchWithCtx(context.TODO(), pipeline, opts...)
+}
+
+// WatchWithCtx 内存实现不支持 change stream
+func (c *Collection) WatchWithCtx(_ context.Context, _ interface{}, _ ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return nil, ErrNotSupported
+}
+
+func (c *Collection) Aggregate(pipeline interface{}, opts ...opts.AggregateOptions) xmgo.IAggregate {
+	return c.AggregateWithCtx(context.TODO(), pipeline, opts...)
+}
+
+func (c *Collection) AggregateWithCtx(ctx context.Context, pipeline interface{}, opts ...opts.AggregateOptions) xmgo.IAggregate {
+	return &Aggregate{
+		ctx:        ctx,
+		collection: c,
+		pipeline:   pipeline,
+		options:    opts,
+	}
+}
+
+func (c *Collection) Find(filter interface{}, opts ...opts.FindOptions) xmgo.IQuery {
+	return c.FindWithCtx(context.TODO(), filter, opts...)
+}
+
+func (c *Collection) FindWithCtx(ctx context.Context, filter interface{}, opts ...opts.FindOptions) xmgo.IQuery {
+	return &Query{
+		ctx:        ctx,
+		collection: c,
+		filter:     filter,
+		opts:       opts,
+	}
+}
+
+// snapshot 获取全部文档的副本，调用方需持有锁
+func (c *Collection) snapshot() []bson.D {
+	return c.db.collection(c.name).clone().docs
+}
+
+// write 持有写锁执行写操作
+func (c *Collection) write(ctx context.Context, m writeModel) (writeResult, error) {
+	if err := ctx.Err(); err != nil {
+		return writeResult{}, err
+	}
+
+	unlock, err := c.db.client.lock(ctx)
+	if err != nil {
+		return writeResult{}, err
+	}
+	defer unlock()
+
+	res, err := m.apply(c.db.ensure(c.name))
+	return res, writeError(err)
+}
+
+func (c *Collection) InsertOne(doc interface{}, opts ...opts.InsertOneOptions) (*xmgo.InsertOneResult, error) {
+	return c.InsertOneWithCtx(context.TODO(), doc, opts...)
+}
+
+func (c *Collection) InsertOneWithCtx(ctx context.Context, doc interface{}, opts ...opts.InsertOneOptions) (result *xmgo.InsertOneResult, err error) {
+	defer c.wrapErr(&err, "insertOne", nil)
+
+	h := doc
+	if len(opts) > 0 && opts[0].InsertHook != nil {
+		h = opts[0].InsertHook
+	}
+
+	if err = hooks.On(ctx, doc, hooks.BeforeInsert, h); err != nil {
+		return
+	}
+
+	res, err := c.write(ctx, writeModel{insert: doc})
+	if err != nil {
+		return
+	}
+
+	result = &xmgo.InsertOneResult{InsertedID: res.insertedID}
+
+	if err = hooks.On(ctx, doc, hooks.AfterInsert, h); err != nil {
+		return
+	}
+
+	return
+}
+
+func (c *Collection) InsertMany(docs interface{}, opts ...opts.InsertManyOptions) (*xmgo.InsertManyResult, error) {
+	return c.InsertManyWithCtx(context.TODO(), docs, opts...)
+}
+
+func (c *Collection) InsertManyWithCtx(ctx context.Context, docs interface{}, opts ...opts.InsertManyOptions) (result *xmgo.InsertManyResult, err error) {
+	defer c.wrapErr(&err, "insertMany", nil)
+
+	h := docs
+	ordered := true
+	if len(opts) > 0 {
+		if opts[0].InsertManyOptions != nil && opts[0].Ordered != nil {
+			ordered = *opts[0].Ordered
+		}
+		if opts[0].InsertHook != nil {
+			h = opts[0].InsertHook
+		}
+	}
+
+	if err = hooks.On(ctx, docs, hooks.BeforeInsert, h); err != nil {
+		return
+	}
+
+	rv := reflect.ValueOf(docs)
+	if rv.Kind() != reflect.Slice || rv.Len() == 0 {
+		return nil, xmgo.ErrNotValidSliceToInsert
+	}
+
+	b := &Bulk{coll: c, ordered: &ordered}
+	inputs := make([]interface{}, rv.Len())
+	for i := range inputs {
+		inputs[i] = rv.Index(i).Interface()
+		b.InsertOne(inputs[i])
+	}
+
+	ids, _, err := b.run(ctx)
+	if err != nil {
+		err = xmgo.WrapWriteError(err, inputs, nil)
+		return
+	}
+
+	result = &xmgo.InsertManyResult{InsertedIDs: ids}
+
+	if err = hooks.On(ctx, docs, hooks.AfterInsert, h); err != nil {
+		return
+	}
+
+	return
+}
+
+func (c *Collection) UpdateById(id interface{}, update interface{}, opts ...opts.UpdateOptions) error {
+	return c.UpdateByIdWithCtx(context.TODO(), id, update, opts...)
+}
+
+func (c *Collection) UpdateByIdWithCtx(ctx context.Context, id interface{}, update interface{}, opts ...opts.UpdateOptions) (err error) {
+	defer c.wrapErr(&err, "updateById", bson.M{"_id": id})
+
+	return c.updateOne(ctx, bson.M{"_id": id}, update, false, opts...)
+}
+
+func (c *Collection) UpdateOne(filter interface{}, update interface{}, opts ...opts.UpdateOptions) error {
+	return c.UpdateOneWithCtx(context.TODO(), filter, update, opts...)
+}
+
+func (c *Collection) UpdateOneWithCtx(ctx context.Context, filter interface{}, update interface{}, opts ...opts.UpdateOptions) (err error) {
+	defer c.wrapErr(&err, "updateOne", filter)
+
+	return c.updateOne(ctx, filter, update, true, opts...)
+}
+
+func (c *Collection) updateOne(ctx context.Context, filter interface{}, update interface{}, allowUpsert bool, opts ...opts.UpdateOptions) (err error) {
+	upsert := false
+	if len(opts) > 0 {
+		if opts[0].UpdateOptions != nil && opts[0].Upsert != nil {
+			upsert = *opts[0].Upsert
+		}
+		if opts[0].UpdateHook != nil {
+			if err = hooks.On(ctx, opts[0].UpdateHook, hooks.BeforeUpdate); err != nil {
+				return
+			}
+		}
+	}
+
+	res, err := c.write(ctx, writeModel{filter: filter, update: update, upsert: upsert})
+	if err == nil && res.matched == 0 && (!allowUpsert || !upsert) {
+		err = xmgo.ErrNoSuchDocuments
+	}
+	if err != nil {
+		return
+	}
+
+	if len(opts) > 0 && opts[0].UpdateHook != nil {
+		if err = hooks.On(ctx, opts[0].UpdateHook, hooks.AfterUpdate); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (c *Collection) UpdateAll(filter interface{}, update interface{}, opts ...opts.UpdateOptions) (*xmgo.UpdateResult, error) {
+	return c.UpdateAllWithCtx(context.TODO(), filter, update, opts...)
+}
+
+func (c *Collection) UpdateAllWithCtx(ctx context.Context, filter interface{}, update interface{}, opts ...opts.UpdateOptions) (result *xmgo.UpdateResult, err error) {
+	defer c.wrapErr(&err, "updateAll", filter)
+
+	upsert := false
+	if len(opts) > 0 {
+		if opts[0].UpdateOptions != nil && opts[0].Upsert != nil {
+			upsert = *opts[0].Upsert
+		}
+		if opts[0].UpdateHook != nil {
+			if err = hooks.On(ctx, opts[0].UpdateHook, hooks.BeforeUpdate); err != nil {
+				return
+			}
+		}
+	}
+
+	res, err := c.write(ctx, writeModel{filter: filter, update: update, upsert: upsert, many: true})
+	if err != nil {
+		return
+	}
+	result = res.updateResult()
+
+	if len(opts) > 0 && opts[0].UpdateHook != nil {
+		if err = hooks.On(ctx, opts[0].UpdateHook, hooks.AfterUpdate); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (c *Collection) Upsert(filter interface{}, replacement interface{}, opts ...opts.UpsertOptions) (*xmgo.UpdateResult, error) {
+	return c.UpsertWithCtx(context.TODO(), filter, replacement, opts...)
+}
+
+func (c *Collection) UpsertWithCtx(ctx context.Context, filter interface{}, replacement interface{}, opts ...opts.UpsertOptions) (result *xmgo.UpdateResult, err error) {
+	defer c.wrapErr(&err, "upsert", filter)
+
+	return c.upsert(ctx, filter, replacement, opts...)
+}
+
+func (c *Collection) upsert(ctx context.Context, filter interface{}, replacement interface{}, opts ...opts.UpsertOptions) (result *xmgo.UpdateResult, err error) {
+	h := replacement
+	if len(opts) > 0 && opts[0].UpsertHook != nil {
+		h = opts[0].UpsertHook
+	}
+
+	if err = hooks.On(ctx, replacement, hooks.BeforeUpsert, h); err != nil {
+		return
+	}
+
+	res, err := c.write(ctx, writeModel{filter: filter, update: replacement, replace: true, upsert: true})
+	if err != nil {
+		return
+	}
+	result = res.updateResult()
+
+	if err = hooks.On(ctx, replacement, hooks.AfterUpsert, h); err != nil {
+		return
+	}
+
+	return
+}
+
+func (c *Collection) UpsertById(id interface{}, replacement interface{}, opts ...opts.UpsertOptions) (*xmgo.UpdateResult, error) {
+	return c.UpsertByIdWithCtx(context.TODO(), id, replacement, opts...)
+}
+
+func (c *Collection) UpsertByIdWithCtx(ctx context.Context, id interface{}, replacement interface{}, opts ...opts.UpsertOptions) (result *xmgo.UpdateResult, err error) {
+	defer c.wrapErr(&err, "upsertById", bson.M{"_id": id})
+
+	return c.upsert(ctx, bson.M{"_id": id}, replacement, opts...)
+}
+
+func (c *Collection) ReplaceOne(filter interface{}, doc interface{}, opts ...opts.ReplaceOptions) error {
+	return c.ReplaceOneWithCtx(context.TODO(), filter, doc, opts...)
+}
+
+func (c *Collection) ReplaceOneWithCtx(ctx context.Context, filter interface{}, doc interface{}, opts ...opts.ReplaceOptions) (err error) {
+	defer c.wrapErr(&err, "replaceOne", filter)
+
+	h := doc
+	upsert := false
+	if len(opts) > 0 {
+		if opts[0].ReplaceOptions != nil && opts[0].Upsert != nil {
+			upsert = *opts[0].Upsert
+		}
+		if opts[0].UpdateHook != nil {
+			h = opts[0].UpdateHook
+		}
+	}
+
+	if err = hooks.On(ctx, doc, hooks.BeforeReplace, h); err != nil {
+		return
+	}
+
+	res, err := c.write(ctx, writeModel{filter: filter, update: doc, replace: true, upsert: upsert})
+	if err == nil && res.matched == 0 {
+		err = xmgo.ErrNoSuchDocuments
+	}
+	if err != nil {
+		return
+	}
+
+	if err = hooks.On(ctx, doc, hooks.AfterReplace, h); err != nil {
+		return
+	}
+
+	return
+}
+
+func (c *Collection) Remove(filter interface{}, opts ...opts.RemoveOptions) error {
+	return c.RemoveWithCtx(context.TODO(), filter, opts...)
+}
+
+func (c *Collection) RemoveWithCtx(ctx context.Context, filter interface{}, opts ...opts.RemoveOptions) (err error) {
+	defer c.wrapErr(&err, "remove", filter)
+
+	return c.remove(ctx, filter, opts...)
+}
+
+func (c *Collection) remove(ctx context.Context, filter interface{}, opts ...opts.RemoveOptions) (err error) {
+	if len(opts) > 0 && opts[0].RemoveHook != nil {
+		if err = hooks.On(ctx, opts[0].RemoveHook, hooks.BeforeRemove); err != nil {
+			return err
+		}
+	}
+
+	res, err := c.write(ctx, writeModel{filter: filter, remove: true})
+	if err == nil && res.deleted == 0 {
+		err = xmgo.ErrNoSuchDocuments
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(opts) > 0 && opts[0].RemoveHook != nil {
+		if err = hooks.On(ctx, opts[0].RemoveHook, hooks.AfterRemove); err != nil {
+			return err
+		}
+	}
+
+	return
+}
+
+func (c *Collection) RemoveById(id interface{}, opts ...opts.RemoveOptions) error {
+	return c.RemoveByIdWithCtx(context.TODO(), id, opts...)
+}
+
+func (c *Collection) RemoveByIdWithCtx(ctx context.Context, id interface{}, opts ...opts.RemoveOptions) (err error) {
+	defer c.wrapErr(&err, "removeById", bson.M{"_id": id})
+
+	return c.remove(ctx, bson.M{"_id": id}, opts...)
+}
+
+func (c *Collection) Bulk() xmgo.IBulk {
+	return &Bulk{coll: c}
+}
+
+// Export 以 Extended JSON 格式导出文档
+func (c *Collection) Export(ctx context.Context, w io.Writer, filter interface{}, o ...opts.ExportOptions) (n int64, err error) {
+	defer c.wrapErr(&err, "export", filter)
+
+	var eo opts.ExportOptions
+	if len(o) > 0 {
+		eo = o[0]
+	}
+
+	q := &Query{ctx: ctx, collection: c, filter: filter, project: eo.Projection}
+	if eo.Sort != nil {
+		sort, err := toDoc(eo.Sort)
+		if err != nil {
+			return 0, err
+		}
+		q.sort = sort
+	}
+	if eo.Limit > 0 {
+		q.limit = &eo.Limit
+	}
+
+	return xmgo.ExportCursor(w, q.Cursor(), eo)
+}
+
+func (c *Collection) Import(ctx context.Context, r io.Reader, o ...opts.ImportOptions) (result *xmgo.ImportResult, err error) {
+	defer c.wrapErr(&err, "import", nil)
+
+	return xmgo.ImportInto(ctx, c, r, o...)
+}
+
+func (c *Collection) ImportCSV(ctx context.Context, r io.Reader, o ...opts.CSVImportOptions) (result *xmgo.CSVImportResult, err error) {
+	defer c.wrapErr(&err, "importCSV", nil)
+
+	return xmgo.ImportCSVInto(ctx, c, r, o...)
+}
+
+func (c *Collection) DropIndex(indexes []string) error {
+	return c.DropIndexWithCtx(context.TODO(), indexes)
+}
+
+func (c *Collection) DropIndexWithCtx(ctx context.Context, indexes []string) (err error) {
+	defer c.wrapErr(&err, "dropIndex", nil)
+
+	return c.dropIndex(ctx, xmgo.IndexName(opts.IndexOptions{Key: indexes}))
+}
+
+func (c *Collection) DropIndexByName(name string) error {
+	return c.DropIndexByNameWithCtx(context.TODO(), name)
+}
+
+func (c *Collection) DropIndexByNameWithCtx(ctx context.Context, name string) (err error) {
+	defer c.wrapErr(&err, "dropIndexByName", nil)
+
+	return c.dropIndex(ctx, name)
+}
+
+func (c *Collection) dropIndex(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	unlock, err := c.db.client.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	coll := c.db.ensure(c.name)
+	for i, idx := range coll.indexes {
+		if idx.name == name && name != "_id_" {
+			coll.indexes = append(coll.indexes[:i:i], coll.indexes[i+1:]...)
+			return nil
+		}
+	}
+
+	return mongo.CommandError{Code: 27, Name: "IndexNotFound", Message: "index not found with name [" + name + "]"}
+}
+
+func (c *Collection) DropAllIndex() error {
+	return c.DropAllIndexWithCtx(context.TODO())
+}
+
+func (c *Collection) DropAllIndexWithCtx(ctx context.Context) (err error) {
+	defer c.wrapErr(&err, "dropAllIndex", nil)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	unlock, err := c.db.client.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	coll := c.db.ensure(c.name)
+	coll.indexes = coll.indexes[:1]
+
+	return nil
+}
+
+func (c *Collection) ListIndexes() ([]*xmgo.IndexSpecification, error) {
+	return c.ListIndexesWithCtx(context.TODO())
+}
+
+func (c *Collection) ListIndexesWithCtx(ctx context.Context) (specs []*xmgo.IndexSpecification, err error) {
+	defer c.wrapErr(&err, "listIndexes", nil)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock, err := c.db.client.rlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	coll := c.db.collection(c.name)
+	res := make([]*xmgo.IndexSpecification, 0, len(coll.indexes))
+	for _, idx := range coll.indexes {
+		keys, err := bson.Marshal(idx.keys)
+		if err != nil {
+			return nil, err
+		}
+
+		spec := &xmgo.IndexSpecification{
+			Name:               idx.name,
+			Namespace:          coll.ns,
+			KeysDocument:       keys,
+			Version:            2,
+			ExpireAfterSeconds: idx.expireAfterSeconds,
+		}
+		if idx.unique && idx.name != "_id_" {
+			spec.Unique = &idx.unique
+		}
+		if idx.sparse {
+			spec.Sparse = &idx.sparse
+		}
+		res = append(res, spec)
+	}
+
+	return res, nil
+}
+
+func (c *Collection) CreateIndexes(indexes []opts.IndexOptions) error {
+	return c.CreateIndexesWithCtx(context.TODO(), indexes)
+}
+
+func (c *Collection) CreateIndexesWithCtx(ctx context.Context, indexes []opts.IndexOptions) (err error) {
+	defer c.wrapErr(&err, "createIndexes", nil)
+
+	return c.createIndexes(ctx, indexes)
+}
+
+func (c *Collection) createIndexes(ctx context.Context, indexes []opts.IndexOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	unlock, err := c.db.client.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	coll := c.db.ensure(c.name)
+	for _, o := range indexes {
+		idx := &index{name: xmgo.IndexName(o), keys: xmgo.IndexKeys(o.Key)}
+		if o.IndexOptions != nil {
+			idx.unique = o.Unique != nil && *o.Unique
+			idx.sparse = o.Sparse != nil && *o.Sparse
+			idx.expireAfterSeconds = o.ExpireAfterSeconds
+		}
+
+		exists := false
+		for _, e := range coll.indexes {
+			if e.name == idx.name {
+				exists = true
+			}
+		}
+		if exists {
+			continue
+		}
+
+		if idx.unique {
+			check := &collection{ns: coll.ns, indexes: []*index{idx}}
+			for _, doc := range coll.docs {
+				if _, err := check.insert(doc); err != nil {
+					return writeError(err)
+				}
+			}
+		}
+
+		coll.indexes = append(coll.indexes, idx)
+	}
+
+	return nil
+}
+
+func (c *Collection) EnsureIndexes(uniques []string, indexes []string) error {
+	return c.EnsureIndexesWithCtx(context.TODO(), uniques, indexes)
+}
+
+func (c *Collection) EnsureIndexesWithCtx(ctx context.Context, uniques []string, indexes []string) (err error) {
+	defer c.wrapErr(&err, "ensureIndexes", nil)
+
+	var models []opts.IndexOptions
+	for _, v := range uniques {
+		models = append(models, opts.IndexOptions{
+			Key:          strings.Split(v, ","),
+			IndexOptions: options.Index().SetUnique(true),
+		})
+	}
+	for _, v := range indexes {
+		models = append(models, opts.IndexOptions{Key: strings.Split(v, ",")})
+	}
+
+	return c.createIndexes(ctx, models)
+}
+
+// find 获取满足条件的文档副本
+func (c *Collection) find(ctx context.Context, filter bson.D) ([]bson.D, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock, err := c.db.client.rlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	coll := c.db.collection(c.name)
+	matched, err := coll.filter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]bson.D, len(matched))
+	for i, n := range matched {
+		docs[i] = copyDoc(coll.docs[n])
+	}
+
+	return docs, nil
+}
+
+// wrapErr 为 collection 操作的错误附加操作信息，配合 defer 使用
+func (c *Collection) wrapErr(err *error, op string, filter interface{}) {
+	*err = xmgo.NewOpError(c.db.name, c.name, op, filter, *err)
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"xtravisions.com/xmgo"
+)
+
+var (
+	// ErrNotSupported return if operation is not supported by in-memory implementation
+	ErrNotSupported = errors.New("not supported by in-memory implementation")
+	// ErrBadValue return if argument is invalid
+	ErrBadValue = errors.New("bad value")
+	// ErrTransactionContext return if an operation inside DoTransaction callback does not use the callback context
+	ErrTransactionContext = errors.New("operation inside DoTransaction must use the callback context")
+)
+
+const duplicateKeyCode = 11000
+
+// duplicateKeyError 构造与服务器一致的唯一索引冲突错误
+func duplicateKeyError(ns string, idx *index, doc bson.D) mongo.WriteError {
+	var keys []string
+	for _, k := range idx.keys {
+		v, _ := getField(doc, splitPath(k.Key))
+		keys = append(keys, fmt.Sprintf("%s: %s", k.Key, keyValue(v)))
+	}
+
+	return mongo.WriteError{
+		Code:    duplicateKeyCode,
+		Message: fmt.Sprintf("E11000 duplicate key error collection: %s index: %s dup key: { %s }", ns, idx.name, strings.Join(keys, ", ")),
+	}
+}
+
+// keyValue 按服务器错误信息的格式输出键值
+func keyValue(v interface{}) string {
+	switch vv := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(vv)
+	case primitive.ObjectID:
+		return "ObjectId('" + vv.Hex() + "')"
+	case int32, int64, float64, bool:
+		return fmt.Sprint(vv)
+	}
+
+	data, _ := bson.MarshalExtJSON(bson.D{{Key: "v", Value: v}}, false, false)
+	return strings.TrimSuffix(strings.TrimPrefix(string(data), `{"v":`), "}")
+}
+
+// writeError 将单个写操作的错误转换为驱动的 WriteException 及 xmgo 类型化错误
+func writeError(err error) error {
+	var we mongo.WriteError
+	if errors.As(err, &we) {
+		return xmgo.WrapWriteError(mongo.WriteException{WriteErrors: mongo.WriteErrors{we}}, nil, nil)
+	}
+
+	return err
+}
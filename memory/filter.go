@@ -0,0 +1,428 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// match 判断文档是否满足查询条件
+func match(doc bson.D, filter bson.D) (bool, error) {
+	for _, e := range filter {
+		ok, err := matchElement(doc, e)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchElement(doc bson.D, e bson.E) (bool, error) {
+	switch e.Key {
+	case "$and", "$or", "$nor":
+		clauses, ok := e.Value.(bson.A)
+		if !ok || len(clauses) == 0 {
+			return false, fmt.Errorf("%w: %s must be a nonempty array", ErrBadValue, e.Key)
+		}
+
+		for _, c := range clauses {
+			cd, ok := c.(bson.D)
+			if !ok {
+				return false, fmt.Errorf("%w: %s entries must be objects", ErrBadValue, e.Key)
+			}
+			ok, err := match(doc, cd)
+			if err != nil {
+				return false, err
+			}
+			switch {
+			case e.Key == "$and" && !ok:
+				return false, nil
+			case e.Key == "$or" && ok:
+				return true, nil
+			case e.Key == "$nor" && ok:
+				return false, nil
+			}
+		}
+		return e.Key != "$or", nil
+	case "$comment":
+		return true, nil
+	}
+
+	if strings.HasPrefix(e.Key, "$") {
+		return false, fmt.Errorf("%w: query operator %s", ErrNotSupported, e.Key)
+	}
+
+	values := lookup(doc, splitPath(e.Key))
+	if isOperatorDoc(e.Value) {
+		return matchOperators(values, e.Value.(bson.D))
+	}
+
+	return matchEq(values, e.Value), nil
+}
+
+// matchOperators 判断字段值是否满足全部操作符条件
+func matchOperators(values []interface{}, ops bson.D) (bool, error) {
+	for _, op := range ops {
+		var ok bool
+		var err error
+
+		switch op.Key {
+		case "$eq":
+			ok = matchEq(values, op.Value)
+		case "$ne":
+			ok = !matchEq(values, op.Value)
+		case "$gt", "$gte", "$lt", "$lte":
+			ok = matchCompare(values, op.Key, op.Value)
+		case "$in":
+			ok, err = matchIn(values, op.Value)
+		case "$nin":
+			ok, err = matchIn(values, op.Value)
+			ok = !ok
+		case "$exists":
+			ok = (len(values) > 0) == truthy(op.Value)
+		case "$not":
+			ok, err = matchNot(values, op.Value)
+		case "$regex":
+			ok, err = matchRegex(values, op.Value, regexOptions(ops))
+		case "$options":
+			ok = true
+		case "$size":
+			ok = matchSize(values, op.Value)
+		case "$all":
+			ok, err = matchAll(values, op.Value)
+		case "$elemMatch":
+			ok, err = matchElem(values, op.Value)
+		case "$type":
+			ok, err = matchType(values, op.Value)
+		case "$mod":
+			ok, err = matchMod(values, op.Value)
+		default:
+			err = fmt.Errorf("%w: query operator %s", ErrNotSupported, op.Key)
+		}
+
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// expand 展开数组，返回值本身及数组元素
+func expand(values []interface{}) []interface{} {
+	res := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		res = append(res, v)
+		if a, ok := v.(bson.A); ok {
+			res = append(res, a...)
+		}
+	}
+
+	return res
+}
+
+func matchEq(values []interface{}, arg interface{}) bool {
+	if re, ok := arg.(primitive.Regex); ok {
+		ok, _ = matchRegex(values, re, "")
+		return ok
+	}
+
+	if len(values) == 0 {
+		return typeOrder(arg) == typeOrder(nil)
+	}
+
+	for _, v := range expand(values) {
+		if equal(v, arg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchCompare(values []interface{}, op string, arg interface{}) bool {
+	for _, v := range expand(values) {
+		if typeOrder(v) != typeOrder(arg) {
+			continue
+		}
+
+		c := compare(v, arg)
+		switch op {
+		case "$gt":
+			if c > 0 {
+				return true
+			}
+		case "$gte":
+			if c >= 0 {
+				return true
+			}
+		case "$lt":
+			if c < 0 {
+				return true
+			}
+		case "$lte":
+			if c <= 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func matchIn(values []interface{}, arg interface{}) (bool, error) {
+	candidates, ok := arg.(bson.A)
+	if !ok {
+		return false, fmt.Errorf("%w: $in/$nin needs an array", ErrBadValue)
+	}
+
+	for _, c := range candidates {
+		if matchEq(values, c) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func matchNot(values []interface{}, arg interface{}) (bool, error) {
+	switch t := arg.(type) {
+	case primitive.Regex:
+		ok, err := matchRegex(values, t, "")
+		return !ok, err
+	case bson.D:
+		ok, err := matchOperators(values, t)
+		return !ok, err
+	}
+
+	return false, fmt.Errorf("%w: $not needs a regex or a document", ErrBadValue)
+}
+
+func regexOptions(ops bson.D) string {
+	for _, op := range ops {
+		if op.Key == "$options" {
+			return stringValue(op.Value)
+		}
+	}
+
+	return ""
+}
+
+func compileRegex(pattern string, options string) (*regexp.Regexp, error) {
+	var flags string
+	for _, o := range options {
+		switch o {
+		case 'i', 'm', 's':
+			flags += string(o)
+		case 'x':
+			pattern = regexp.MustCompile(`\s+|#.*`).ReplaceAllString(pattern, "")
+		}
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+
+	return regexp.Compile(pattern)
+}
+
+func matchRegex(values []interface{}, arg interface{}, options string) (bool, error) {
+	var pattern string
+	switch t := arg.(type) {
+	case primitive.Regex:
+		pattern = t.Pattern
+		if options == "" {
+			options = t.Options
+		}
+	case string:
+		pattern = t
+	default:
+		return false, fmt.Errorf("%w: $regex has to be a string", ErrBadValue)
+	}
+
+	re, err := compileRegex(pattern, options)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrBadValue, err)
+	}
+
+	for _, v := range expand(values) {
+		if s, ok := v.(string); ok && re.MatchString(s) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func matchSize(values []interface{}, arg interface{}) bool {
+	n, ok := toFloat(arg)
+	if !ok {
+		return false
+	}
+
+	for _, v := range values {
+		if a, ok := v.(bson.A); ok && float64(len(a)) == n {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchAll(values []interface{}, arg interface{}) (bool, error) {
+	candidates, ok := arg.(bson.A)
+	if !ok {
+		return false, fmt.Errorf("%w: $all needs an array", ErrBadValue)
+	}
+	if len(candidates) == 0 {
+		return false, nil
+	}
+
+	for _, c := range candidates {
+		if em, ok := c.(bson.D); ok && len(em) == 1 && em[0].Key == "$elemMatch" {
+			if ok, err := matchElem(values, em[0].Value); err != nil || !ok {
+				return false, err
+			}
+			continue
+		}
+		if !matchEq(values, c) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func matchElem(values []interface{}, arg interface{}) (bool, error) {
+	cond, ok := arg.(bson.D)
+	if !ok {
+		return false, fmt.Errorf("%w: $elemMatch needs an object", ErrBadValue)
+	}
+
+	for _, v := range values {
+		a, ok := v.(bson.A)
+		if !ok {
+			continue
+		}
+
+		for _, item := range a {
+			var ok bool
+			var err error
+			if isOperatorDoc(cond) {
+				ok, err = matchOperators([]interface{}{item}, cond)
+			} else if d, isDoc := item.(bson.D); isDoc {
+				ok, err = match(d, cond)
+			}
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+var typeAliases = map[string][]int{
+	"double":     {3},
+	"string":     {4},
+	"object":     {5},
+	"array":      {6},
+	"binData":    {7},
+	"objectId":   {8},
+	"bool":       {9},
+	"date":       {10},
+	"null":       {2},
+	"regex":      {12},
+	"int":        {3},
+	"timestamp":  {11},
+	"long":       {3},
+	"decimal":    {3},
+	"number":     {3},
+	"minKey":     {1},
+	"maxKey":     {13},
+	"undefined":  {2},
+	"javascript": {14},
+}
+
+func matchType(values []interface{}, arg interface{}) (bool, error) {
+	var names []string
+	switch t := arg.(type) {
+	case string:
+		names = []string{t}
+	case bson.A:
+		for _, n := range t {
+			if s, ok := n.(string); ok {
+				names = append(names, s)
+			}
+		}
+	default:
+		return false, fmt.Errorf("%w: $type only supports type aliases", ErrNotSupported)
+	}
+
+	for _, v := range expand(values) {
+		for _, n := range names {
+			if typeMatches(v, n) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func typeMatches(v interface{}, name string) bool {
+	switch name {
+	case "double":
+		_, ok := v.(float64)
+		return ok
+	case "int":
+		_, ok := v.(int32)
+		return ok
+	case "long":
+		_, ok := v.(int64)
+		return ok
+	case "decimal":
+		_, ok := v.(primitive.Decimal128)
+		return ok
+	}
+
+	for _, order := range typeAliases[name] {
+		if typeOrder(v) == order {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchMod(values []interface{}, arg interface{}) (bool, error) {
+	a, ok := arg.(bson.A)
+	if !ok || len(a) != 2 {
+		return false, fmt.Errorf("%w: $mod needs an array of [divisor, remainder]", ErrBadValue)
+	}
+
+	divisor, ok1 := toFloat(a[0])
+	remainder, ok2 := toFloat(a[1])
+	if !ok1 || !ok2 || divisor == 0 {
+		return false, fmt.Errorf("%w: malformed $mod", ErrBadValue)
+	}
+
+	for _, v := range expand(values) {
+		if f, ok := toFloat(v); ok && math.Mod(math.Trunc(f), math.Trunc(divisor)) == math.Trunc(remainder) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
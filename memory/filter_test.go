@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var matchDoc = bson.D{
+	{Key: "_id", Value: int32(1)},
+	{Key: "name", Value: "alice"},
+	{Key: "age", Value: int32(30)},
+	{Key: "tags", Value: bson.A{"a", "b"}},
+	{Key: "address", Value: bson.D{{Key: "city", Value: "Shanghai"}}},
+	{Key: "items", Value: bson.A{
+		bson.D{{Key: "sku", Value: "x"}, {Key: "qty", Value: int32(2)}},
+		bson.D{{Key: "sku", Value: "y"}, {Key: "qty", Value: int32(5)}},
+	}},
+}
+
+func TestMatchSelects(t *testing.T) {
+	filters := map[string]bson.D{
+		"empty":          {},
+		"numeric widen":  {{Key: "age", Value: int64(30)}},
+		"nested path":    {{Key: "address.city", Value: "Shanghai"}},
+		"array element":  {{Key: "tags", Value: "b"}},
+		"array of docs":  {{Key: "items.sku", Value: "y"}},
+		"$in":            {{Key: "name", Value: bson.D{{Key: "$in", Value: bson.A{"bob", "alice"}}}}},
+		"$exists false":  {{Key: "email", Value: bson.D{{Key: "$exists", Value: false}}}},
+		"$ne missing":    {{Key: "email", Value: bson.D{{Key: "$ne", Value: "x"}}}},
+		"$regex options": {{Key: "name", Value: bson.D{{Key: "$regex", Value: "^AL"}, {Key: "$options", Value: "i"}}}},
+		"$size":          {{Key: "tags", Value: bson.D{{Key: "$size", Value: int32(2)}}}},
+		"$or":            {{Key: "$or", Value: bson.A{bson.D{{Key: "name", Value: "bob"}}, bson.D{{Key: "age", Value: int32(30)}}}}},
+	}
+	for name, filter := range filters {
+		if ok, err := match(matchDoc, filter); err != nil || !ok {
+			t.Errorf("%s: match(%v) = %v, %v, want true", name, filter, ok, err)
+		}
+	}
+}
+
+func TestMatchRejects(t *testing.T) {
+	filters := map[string]bson.D{
+		"not equal":     {{Key: "name", Value: "bob"}},
+		"range":         {{Key: "age", Value: bson.D{{Key: "$gte", Value: int32(18)}, {Key: "$lt", Value: int32(30)}}}},
+		"$all":          {{Key: "tags", Value: bson.D{{Key: "$all", Value: bson.A{"a", "c"}}}}},
+		"$nor":          {{Key: "$nor", Value: bson.A{bson.D{{Key: "name", Value: "alice"}}}}},
+		"$elemMatch":    {{Key: "items", Value: bson.D{{Key: "$elemMatch", Value: bson.D{{Key: "sku", Value: "x"}, {Key: "qty", Value: bson.D{{Key: "$gt", Value: int32(3)}}}}}}}},
+		"$not of match": {{Key: "age", Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$lt", Value: int32(40)}}}}}},
+	}
+	for name, filter := range filters {
+		if ok, err := match(matchDoc, filter); err != nil || ok {
+			t.Errorf("%s: match(%v) = %v, %v, want false", name, filter, ok, err)
+		}
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	if _, err := match(matchDoc, bson.D{{Key: "$or", Value: bson.A{}}}); !errors.Is(err, ErrBadValue) {
+		t.Errorf("empty $or error = %v, want ErrBadValue", err)
+	}
+	if _, err := match(matchDoc, bson.D{{Key: "$where", Value: "true"}}); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("$where error = %v, want ErrNotSupported", err)
+	}
+	if _, err := match(matchDoc, bson.D{{Key: "name", Value: bson.D{{Key: "$near", Value: bson.A{}}}}}); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("$near error = %v, want ErrNotSupported", err)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func splitPath(path string) []string {
+	return strings.Split(path, ".")
+}
+
+// lookup 查询条件语义下获取路径对应的全部值，中间层级的数组会被展开
+func lookup(v interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{v}
+	}
+
+	switch t := v.(type) {
+	case bson.D:
+		for _, e := range t {
+			if e.Key == path[0] {
+				return lookup(e.Value, path[1:])
+			}
+		}
+	case bson.A:
+		if i, err := strconv.Atoi(path[0]); err == nil {
+			if i >= 0 && i < len(t) {
+				return lookup(t[i], path[1:])
+			}
+			return nil
+		}
+
+		var values []interface{}
+		for _, item := range t {
+			if d, ok := item.(bson.D); ok {
+				values = append(values, lookup(d, path)...)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
+
+// getField 获取路径对应的值，不展开数组
+func getField(v interface{}, path []string) (interface{}, bool) {
+	if len(path) == 0 {
+		return v, true
+	}
+
+	switch t := v.(type) {
+	case bson.D:
+		for _, e := range t {
+			if e.Key == path[0] {
+				return getField(e.Value, path[1:])
+			}
+		}
+	case bson.A:
+		if i, err := strconv.Atoi(path[0]); err == nil && i >= 0 && i < len(t) {
+			return getField(t[i], path[1:])
+		}
+	}
+
+	return nil, false
+}
+
+// setField 设置路径对应的值，不存在的中间文档会被创建
+func setField(doc bson.D, path []string, v interface{}) (bson.D, error) {
+	res, err := setValue(doc, path, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(bson.D), nil
+}
+
+func setValue(cur interface{}, path []string, v interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+
+	switch t := cur.(type) {
+	case bson.D:
+		for i, e := range t {
+			if e.Key == path[0] {
+				nv, err := setValue(e.Value, path[1:], v)
+				if err != nil {
+					return nil, err
+				}
+				t[i].Value = nv
+				return t, nil
+			}
+		}
+
+		nv, err := setValue(bson.D{}, path[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		return append(t, bson.E{Key: path[0], Value: nv}), nil
+	case bson.A:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("%w: cannot create field '%s' in array", ErrBadValue, path[0])
+		}
+		for len(t) <= i {
+			t = append(t, nil)
+		}
+
+		var child interface{} = bson.D{}
+		if t[i] != nil {
+			child = t[i]
+		}
+		nv, err := setValue(child, path[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		t[i] = nv
+		return t, nil
+	default:
+		return nil, fmt.Errorf("%w: cannot create field '%s' in element of type %T", ErrBadValue, path[0], cur)
+	}
+}
+
+// unsetField 删除路径对应的值
+func unsetField(doc bson.D, path []string) bson.D {
+	res, _ := unsetValue(doc, path).(bson.D)
+	return res
+}
+
+func unsetValue(cur interface{}, path []string) interface{} {
+	switch t := cur.(type) {
+	case bson.D:
+		for i, e := range t {
+			if e.Key != path[0] {
+				continue
+			}
+			if len(path) == 1 {
+				return append(t[:i:i], t[i+1:]...)
+			}
+			t[i].Value = unsetValue(e.Value, path[1:])
+			return t
+		}
+	case bson.A:
+		if i, err := strconv.Atoi(path[0]); err == nil && i >= 0 && i < len(t) {
+			if len(path) == 1 {
+				t[i] = nil
+			} else {
+				t[i] = unsetValue(t[i], path[1:])
+			}
+		}
+	}
+
+	return cur
+}
@@ -0,0 +1,473 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"xtravisions.com/xmgo"
+	"xtravisions.com/xmgo/hooks"
+	opts "xtravisions.com/xmgo/options"
+)
+
+// Query 内存查询，实现 xmgo.IQuery
+type Query struct {
+	filter  interface{}
+	sort    bson.D
+	project interface{}
+	limit   *int64
+	skip    *int64
+
+	collation *options.Collation
+
+	ctx        context.Context
+	collection *Collection
+	opts       []opts.FindOptions
+}
+
+func (q *Query) Sort(fields ...string) xmgo.IQuery {
+	if len(fields) == 0 {
+		return q
+	}
+
+	var sorts bson.D
+	for _, field := range fields {
+		key, n := field, int32(1)
+		if strings.HasPrefix(field, "-") {
+			key, n = field[1:], -1
+		} else if strings.HasPrefix(field, "+") {
+			key = field[1:]
+		}
+		if key == "" {
+			panic("Mongo Sort: 字段名不能为空")
+		}
+
+		sorts = append(sorts, bson.E{Key: key, Value: n})
+	}
+	q.sort = sorts
+
+	return q
+}
+
+func (q *Query) Select(projection interface{}) xmgo.IQuery {
+	q.project = projection
+	return q
+}
+
+func (q *Query) Skip(n int64) xmgo.IQuery {
+	q.skip = &n
+	return q
+}
+
+// BatchSize 内存实现忽略该配置
+func (q *Query) BatchSize(_ int64) xmgo.IQuery {
+	return q
+}
+
+// SetArrayFilters 内存实现忽略该配置
+func (q *Query) SetArrayFilters(_ *options.ArrayFilters) xmgo.IQuery {
+	return q
+}
+
+// NoCursorTimeout 内存实现忽略该配置
+func (q *Query) NoCursorTimeout(_ bool) xmgo.IQuery {
+	return q
+}
+
+// Hint 内存实现忽略该配置
+func (q *Query) Hint(_ interface{}) xmgo.IQuery {
+	return q
+}
+
+// ReadPreference 内存实现忽略该配置
+func (q *Query) ReadPreference(_ *readpref.ReadPref) xmgo.IQuery {
+	return q
+}
+
+// ReadConcern 内存实现忽略该配置
+func (q *Query) ReadConcern(_ *readconcern.ReadConcern) xmgo.IQuery {
+	return q
+}
+
+// Collation 内存实现仅支持 simple 排序规则
+func (q *Query) Collation(collation *options.Collation) xmgo.IQuery {
+	q.collation = collation
+	return q
+}
+
+func (q *Query) Limit(n int64) xmgo.IQuery {
+	q.limit = &n
+	return q
+}
+
+func (q *Query) One(result interface{}) (err error) {
+	defer q.wrapErr(&err, "find.one")
+
+	if len(q.opts) > 0 {
+		if err := hooks.On(q.ctx, q.opts[0].QueryHook, hooks.BeforeQuery); err != nil {
+			return err
+		}
+	}
+
+	one := int64(1)
+	limit := q.limit
+	q.limit = &one
+	docs, err := q.run()
+	q.limit = limit
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return xmgo.ErrNoSuchDocuments
+	}
+	if err = decode(docs[0], result); err != nil {
+		return err
+	}
+
+	if len(q.opts) > 0 {
+		if err := hooks.On(q.ctx, q.opts[0].QueryHook, hooks.AfterQuery); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (q *Query) All(result interface{}) (err error) {
+	defer q.wrapErr(&err, "find.all")
+
+	if len(q.opts) > 0 {
+		if err := hooks.On(q.ctx, q.opts[0].QueryHook, hooks.BeforeQuery); err != nil {
+			return err
+		}
+	}
+
+	docs, err := q.run()
+	if err != nil {
+		return err
+	}
+	if err = decodeAll(docs, result); err != nil {
+		return err
+	}
+
+	if len(q.opts) > 0 {
+		if err := hooks.On(q.ctx, q.opts[0].QueryHook, hooks.AfterQuery); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (q *Query) Count() (n int64, err error) {
+	defer q.wrapErr(&err, "find.count")
+
+	project := q.project
+	q.project = nil
+	docs, err := q.run()
+	q.project = project
+
+	return int64(len(docs)), err
+}
+
+func (q *Query) EstimatedCount() (n int64, err error) {
+	defer q.wrapErr(&err, "find.estimatedCount")
+
+	if err = q.ctx.Err(); err != nil {
+		return
+	}
+
+	unlock, err := q.collection.db.client.rlock(q.ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	return int64(len(q.collection.db.collection(q.collection.name).docs)), nil
+}
+
+func (q *Query) Exists() (b bool, err error) {
+	var n int64 = 0
+	if n, err = q.Count(); err == nil {
+		if n > 0 {
+			b = true
+		}
+	}
+
+	return
+}
+
+func (q *Query) Distinct(key string, result interface{}) (err error) {
+	defer q.wrapErr(&err, "find.distinct")
+
+	resultVal := reflect.ValueOf(result)
+
+	if resultVal.Kind() != reflect.Ptr {
+		return xmgo.ErrQueryNotSlicePointer
+	}
+
+	resultElmVal := resultVal.Elem()
+	if resultElmVal.Kind() != reflect.Interface && resultElmVal.Kind() != reflect.Slice {
+		return xmgo.ErrQueryNotSliceType
+	}
+
+	if err = checkCollation(q.collation); err != nil {
+		return err
+	}
+
+	filter, err := toDoc(q.filter)
+	if err != nil {
+		return err
+	}
+	docs, err := q.collection.find(q.ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	values := bson.A{}
+	for _, doc := range docs {
+		for _, v := range lookup(doc, splitPath(key)) {
+			if arr, ok := v.(bson.A); ok {
+				for _, e := range arr {
+					values = appendDistinct(values, e)
+				}
+			} else {
+				values = appendDistinct(values, v)
+			}
+		}
+	}
+
+	valueType, valueBytes, err := bson.MarshalValue(values)
+	if err != nil {
+		return err
+	}
+
+	rawValue := bson.RawValue{Type: valueType, Value: valueBytes}
+	if err = rawValue.Unmarshal(result); err != nil {
+		return xmgo.ErrQueryResultTypeInconsistent
+	}
+
+	return nil
+}
+
+func (q *Query) Cursor() xmgo.ICursor {
+	docs, err := q.run()
+	q.wrapErr(&err, "find.cursor")
+
+	return &Cursor{docs: docs, err: err}
+}
+
+func (q *Query) Apply(change xmgo.Change, result interface{}) (err error) {
+	defer q.wrapErr(&err, "find.apply")
+
+	if err = q.ctx.Err(); err != nil {
+		return err
+	}
+	if err = checkCollation(q.collation); err != nil {
+		return err
+	}
+
+	filter, err := toDoc(q.filter)
+	if err != nil {
+		return err
+	}
+
+	c := q.collection
+	unlock, err := c.db.client.lock(q.ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	coll := c.db.ensure(c.name)
+	matched, err := coll.filter(filter)
+	if err != nil {
+		return err
+	}
+	if len(q.sort) > 0 {
+		if err = checkSort(q.sort); err != nil {
+			return err
+		}
+		sort.SliceStable(matched, func(i, j int) bool {
+			return less(coll.docs[matched[i]], coll.docs[matched[j]], q.sort)
+		})
+	}
+
+	var before, after bson.D
+	switch {
+	case len(matched) == 0 && (change.Remove || !change.Upsert):
+		return xmgo.ErrNoSuchDocuments
+	case change.Remove:
+		before = coll.docs[matched[0]]
+		coll.remove(matched[:1])
+	case len(matched) == 0:
+		res, err := writeModel{filter: filter, update: change.Update, replace: change.Replace, upsert: true}.apply(coll)
+		if err != nil {
+			return writeError(err)
+		}
+		if !change.ReturnNew {
+			return nil
+		}
+		for _, doc := range coll.docs {
+			if id, _ := getField(doc, []string{"_id"}); equal(id, res.upsertedID) {
+				after = doc
+			}
+		}
+	default:
+		update, err := toDoc(change.Update)
+		if err != nil {
+			return err
+		}
+		i := matched[0]
+		before = coll.docs[i]
+		if change.Replace {
+			after, err = applyReplace(before, update)
+		} else {
+			after, err = applyUpdate(before, update, false)
+		}
+		if err != nil {
+			return err
+		}
+		if err = coll.replace(i, after); err != nil {
+			return writeError(err)
+		}
+	}
+
+	doc := before
+	if change.ReturnNew && !change.Remove {
+		doc = after
+	}
+	if q.project != nil {
+		projection, err := toDoc(q.project)
+		if err != nil {
+			return err
+		}
+		if doc, err = project(doc, projection); err != nil {
+			return err
+		}
+	}
+
+	return decode(doc, result)
+}
+
+// wrapErr 为查询的错误附加操作信息，配合 defer 使用
+func (q *Query) wrapErr(err *error, op string) {
+	*err = xmgo.NewOpError(q.collection.db.name, q.collection.name, op, q.filter, *err)
+}
+
+// run 执行查询，返回排序、分页、投影后的文档副本
+func (q *Query) run() ([]bson.D, error) {
+	if err := checkCollation(q.collation); err != nil {
+		return nil, err
+	}
+
+	filter, err := toDoc(q.filter)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := q.collection.find(q.ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(q.sort) > 0 {
+		if err = sortDocs(docs, q.sort); err != nil {
+			return nil, err
+		}
+	}
+	if q.skip != nil {
+		if *q.skip >= int64(len(docs)) {
+			docs = nil
+		} else if *q.skip > 0 {
+			docs = docs[*q.skip:]
+		}
+	}
+	if q.limit != nil && *q.limit > 0 && *q.limit < int64(len(docs)) {
+		docs = docs[:*q.limit]
+	}
+
+	if q.project != nil {
+		projection, err := toDoc(q.project)
+		if err != nil {
+			return nil, err
+		}
+		for i, doc := range docs {
+			if docs[i], err = project(doc, projection); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return docs, nil
+}
+
+func appendDistinct(values bson.A, v interface{}) bson.A {
+	for _, e := range values {
+		if equal(e, v) {
+			return values
+		}
+	}
+
+	return append(values, v)
+}
+
+// Cursor 内存游标，实现 xmgo.ICursor
+type Cursor struct {
+	docs []bson.D
+	err  error
+}
+
+func (c *Cursor) Next(result interface{}) bool {
+	if c.err != nil || len(c.docs) == 0 {
+		return false
+	}
+
+	doc := c.docs[0]
+	c.docs = c.docs[1:]
+	if c.err = decode(doc, result); c.err != nil {
+		return false
+	}
+
+	return true
+}
+
+func (c *Cursor) All(results interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	docs := c.docs
+	c.docs = nil
+
+	return decodeAll(docs, results)
+}
+
+func (c *Cursor) Close() error {
+	c.docs = nil
+	return c.err
+}
+
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// checkCollation 检查排序规则，仅支持 simple
+func checkCollation(collation *options.Collation) error {
+	if collation != nil && collation.Locale != "simple" {
+		return fmt.Errorf("%w: collation %s", ErrNotSupported, collation.Locale)
+	}
+
+	return nil
+}
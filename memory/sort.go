@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// sortDocs 按排序规则稳定排序文档
+func sortDocs(docs []bson.D, spec bson.D) error {
+	if err := checkSort(spec); err != nil {
+		return err
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		return less(docs[i], docs[j], spec)
+	})
+
+	return nil
+}
+
+func checkSort(spec bson.D) error {
+	for _, s := range spec {
+		if _, ok := toFloat(s.Value); !ok {
+			return fmt.Errorf("%w: sort key %s", ErrNotSupported, s.Key)
+		}
+	}
+
+	return nil
+}
+
+// less 按排序规则比较两个文档
+func less(a, b bson.D, spec bson.D) bool {
+	for _, s := range spec {
+		desc := !positive(s.Value)
+		path := splitPath(s.Key)
+
+		c := compare(sortValue(a, path, desc), sortValue(b, path, desc))
+		if c == 0 {
+			continue
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	}
+
+	return false
+}
+
+func positive(v interface{}) bool {
+	f, _ := toFloat(v)
+	return f >= 0
+}
+
+// sortValue 获取排序使用的值，数组升序取最小元素，降序取最大元素
+func sortValue(doc bson.D, path []string, desc bool) interface{} {
+	values := lookup(doc, path)
+	if len(values) == 0 {
+		return nil
+	}
+
+	var res interface{}
+	first := true
+	for _, v := range values {
+		candidates := []interface{}{v}
+		if a, ok := v.(bson.A); ok {
+			if len(a) == 0 {
+				continue
+			}
+			candidates = a
+		}
+		for _, c := range candidates {
+			cmp := compare(c, res)
+			if first || (desc && cmp > 0) || (!desc && cmp < 0) {
+				res, first = c, false
+			}
+		}
+	}
+
+	return res
+}
+
+// project 对文档应用投影，仅支持字段包含及排除
+func project(doc bson.D, projection bson.D) (bson.D, error) {
+	if len(projection) == 0 {
+		return doc, nil
+	}
+
+	inclusion, includeId := false, true
+	for _, p := range projection {
+		if isOperatorDoc(p.Value) || strings.Contains(p.Key, "$") {
+			return nil, fmt.Errorf("%w: projection %s", ErrNotSupported, p.Key)
+		}
+		if p.Key == "_id" {
+			includeId = truthy(p.Value)
+			continue
+		}
+		if truthy(p.Value) {
+			inclusion = true
+		}
+	}
+
+	if !inclusion {
+		res := copyDoc(doc)
+		for _, p := range projection {
+			if !truthy(p.Value) {
+				res = unsetField(res, splitPath(p.Key))
+			}
+		}
+		return res, nil
+	}
+
+	res := bson.D{}
+	if includeId {
+		if id, ok := getField(doc, []string{"_id"}); ok {
+			res = append(res, bson.E{Key: "_id", Value: id})
+		}
+	}
+
+	for _, p := range projection {
+		if p.Key == "_id" || !truthy(p.Value) {
+			continue
+		}
+		res = include(res, doc, splitPath(p.Key))
+	}
+
+	return copyDoc(res), nil
+}
+
+// include 将 src 中路径对应的字段合并到 dst，数组中的文档逐个投影
+func include(dst bson.D, src bson.D, path []string) bson.D {
+	for _, e := range src {
+		if e.Key != path[0] {
+			continue
+		}
+
+		var value interface{}
+		if len(path) == 1 {
+			value = e.Value
+		} else {
+			existing, _ := getField(dst, path[:1])
+			value = includeValue(existing, e.Value, path[1:])
+			if value == nil {
+				return dst
+			}
+		}
+
+		for i := range dst {
+			if dst[i].Key == path[0] {
+				dst[i].Value = value
+				return dst
+			}
+		}
+		return append(dst, bson.E{Key: path[0], Value: value})
+	}
+
+	return dst
+}
+
+func includeValue(existing interface{}, v interface{}, path []string) interface{} {
+	switch t := v.(type) {
+	case bson.D:
+		d, _ := existing.(bson.D)
+		return include(d, t, path)
+	case bson.A:
+		old, _ := existing.(bson.A)
+		res := bson.A{}
+		for i, item := range t {
+			var prev interface{}
+			if i < len(old) {
+				prev = old[i]
+			}
+			if d, ok := item.(bson.D); ok {
+				pd, _ := prev.(bson.D)
+				res = append(res, include(pd, d, path))
+			}
+		}
+		return res
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type index struct {
+	name               string
+	keys               bson.D
+	unique             bool
+	sparse             bool
+	expireAfterSeconds *int32
+}
+
+// collection 内存中的 collection 数据
+type collection struct {
+	ns      string
+	docs    []bson.D
+	indexes []*index
+}
+
+func newCollection(ns string) *collection {
+	return &collection{
+		ns:      ns,
+		indexes: []*index{{name: "_id_", keys: bson.D{{Key: "_id", Value: int32(1)}}, unique: true}},
+	}
+}
+
+func (c *collection) clone() *collection {
+	res := &collection{ns: c.ns, docs: make([]bson.D, len(c.docs)), indexes: append([]*index(nil), c.indexes...)}
+	for i, doc := range c.docs {
+		res.docs[i] = copyDoc(doc)
+	}
+
+	return res
+}
+
+// filter 获取满足条件的文档下标
+func (c *collection) filter(filter bson.D) ([]int, error) {
+	var res []int
+	for i, doc := range c.docs {
+		ok, err := match(doc, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, i)
+		}
+	}
+
+	return res, nil
+}
+
+// checkUnique 检查文档是否违反唯一索引
+//
+//	@param skip 忽略的文档下标，更新时为文档自身，插入时为 -1
+func (c *collection) checkUnique(doc bson.D, skip int) error {
+	for _, idx := range c.indexes {
+		if !idx.unique {
+			continue
+		}
+
+		key, present := indexKey(idx, doc)
+		if idx.sparse && !present {
+			continue
+		}
+
+		for i, other := range c.docs {
+			if i == skip {
+				continue
+			}
+			otherKey, otherPresent := indexKey(idx, other)
+			if idx.sparse && !otherPresent {
+				continue
+			}
+			if equal(key, otherKey) {
+				return duplicateKeyError(c.ns, idx, doc)
+			}
+		}
+	}
+
+	return nil
+}
+
+func indexKey(idx *index, doc bson.D) (bson.A, bool) {
+	key := make(bson.A, len(idx.keys))
+	present := false
+	for i, k := range idx.keys {
+		if v, ok := getField(doc, splitPath(k.Key)); ok {
+			key[i] = v
+			present = true
+		}
+	}
+
+	return key, present
+}
+
+// insert 插入文档，缺少 _id 时自动生成
+func (c *collection) insert(doc bson.D) (interface{}, error) {
+	id, ok := getField(doc, []string{"_id"})
+	if !ok {
+		id = primitive.NewObjectID()
+		doc = append(bson.D{{Key: "_id", Value: id}}, doc...)
+	}
+	if _, isArray := id.(bson.A); isArray {
+		return nil, mongo.WriteError{Code: 2, Message: "The '_id' value cannot be of type array"}
+	}
+
+	if err := c.checkUnique(doc, -1); err != nil {
+		return nil, err
+	}
+
+	c.docs = append(c.docs, doc)
+	return id, nil
+}
+
+// replace 替换指定下标的文档
+func (c *collection) replace(i int, doc bson.D) error {
+	if err := c.checkUnique(doc, i); err != nil {
+		return err
+	}
+
+	c.docs[i] = doc
+	return nil
+}
+
+// remove 删除指定下标的文档，下标需按升序传入
+func (c *collection) remove(indexes []int) {
+	if len(indexes) == 0 {
+		return
+	}
+
+	res := c.docs[:0]
+	j := 0
+	for i, doc := range c.docs {
+		if j < len(indexes) && indexes[j] == i {
+			j++
+			continue
+		}
+		res = append(res, doc)
+	}
+	for i := len(res); i < len(c.docs); i++ {
+		c.docs[i] = nil
+	}
+	c.docs = res
+}
@@ -0,0 +1,394 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"xtravisions.com/xmgo"
+)
+
+// applyUpdate 对文档应用更新操作符，返回更新后的新文档
+//
+//	@param inserting 是否为 upsert 插入，决定 $setOnInsert 是否生效
+func applyUpdate(doc bson.D, update bson.D, inserting bool) (bson.D, error) {
+	if len(update) == 0 || !isOperatorDoc(update) {
+		return nil, fmt.Errorf("%w: update document must contain only atomic operators", ErrBadValue)
+	}
+
+	res := copyDoc(doc)
+	for _, op := range update {
+		fields, ok := op.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("%w: modifier %s expects an object", ErrBadValue, op.Key)
+		}
+
+		for _, f := range fields {
+			if strings.Contains(f.Key, "$") {
+				return nil, fmt.Errorf("%w: positional update %s", ErrNotSupported, f.Key)
+			}
+			if f.Key == "_id" && op.Key != "$setOnInsert" {
+				if old, ok := getField(res, []string{"_id"}); ok && (op.Key != "$set" || !equal(old, f.Value)) {
+					return nil, fmt.Errorf("%w: performing an update on the path '_id' would modify the immutable field '_id'", ErrBadValue)
+				}
+			}
+
+			var err error
+			path := splitPath(f.Key)
+			switch op.Key {
+			case "$set":
+				res, err = setField(res, path, deepCopy(f.Value))
+			case "$setOnInsert":
+				if inserting {
+					res, err = setField(res, path, deepCopy(f.Value))
+				}
+			case "$unset":
+				res = unsetField(res, path)
+			case "$inc", "$mul":
+				res, err = updateArithmetic(res, path, op.Key, f.Value)
+			case "$min", "$max":
+				old, ok := getField(res, path)
+				c := compare(f.Value, old)
+				if !ok || (op.Key == "$min" && c < 0) || (op.Key == "$max" && c > 0) {
+					res, err = setField(res, path, deepCopy(f.Value))
+				}
+			case "$rename":
+				if old, ok := getField(res, path); ok {
+					res = unsetField(res, path)
+					res, err = setField(res, splitPath(stringValue(f.Value)), old)
+				}
+			case "$currentDate":
+				now := time.Now()
+				var v interface{} = primitive.NewDateTimeFromTime(now)
+				if spec, ok := f.Value.(bson.D); ok && len(spec) > 0 && spec[0].Value == "timestamp" {
+					v = primitive.Timestamp{T: uint32(now.Unix())}
+				}
+				res, err = setField(res, path, v)
+			case "$push", "$addToSet":
+				res, err = updatePush(res, path, op.Key, f.Value)
+			case "$pull", "$pullAll":
+				res, err = updatePull(res, path, op.Key, f.Value)
+			case "$pop":
+				res, err = updatePop(res, path, f.Value)
+			default:
+				err = fmt.Errorf("%w: update operator %s", ErrNotSupported, op.Key)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// applyReplace 使用替换文档替换原文档，保留原文档的 _id
+func applyReplace(doc bson.D, replacement bson.D) (bson.D, error) {
+	for _, e := range replacement {
+		if strings.HasPrefix(e.Key, "$") {
+			return nil, xmgo.ErrReplacementContainUpdateOperators
+		}
+	}
+
+	res := bson.D{}
+	id, hasId := getField(doc, []string{"_id"})
+	if newId, ok := getField(replacement, []string{"_id"}); ok && hasId && !equal(id, newId) {
+		return nil, fmt.Errorf("%w: the _id field cannot be changed", ErrBadValue)
+	}
+	if hasId {
+		res = append(res, bson.E{Key: "_id", Value: id})
+	}
+
+	for _, e := range replacement {
+		if e.Key == "_id" && hasId {
+			continue
+		}
+		res = append(res, bson.E{Key: e.Key, Value: deepCopy(e.Value)})
+	}
+
+	return res, nil
+}
+
+// upsertDocument 由查询条件中的等值字段生成 upsert 插入的初始文档
+func upsertDocument(filter bson.D) (bson.D, error) {
+	doc := bson.D{}
+	var err error
+
+	for _, e := range filter {
+		switch {
+		case e.Key == "$and":
+			clauses, _ := e.Value.(bson.A)
+			for _, c := range clauses {
+				if cd, ok := c.(bson.D); ok {
+					sub, err := upsertDocument(cd)
+					if err != nil {
+						return nil, err
+					}
+					for _, se := range sub {
+						if doc, err = setField(doc, splitPath(se.Key), se.Value); err != nil {
+							return nil, err
+						}
+					}
+				}
+			}
+		case strings.HasPrefix(e.Key, "$"):
+			continue
+		case isOperatorDoc(e.Value):
+			for _, op := range e.Value.(bson.D) {
+				if op.Key == "$eq" {
+					if doc, err = setField(doc, splitPath(e.Key), deepCopy(op.Value)); err != nil {
+						return nil, err
+					}
+				}
+			}
+		default:
+			if _, isRegex := e.Value.(primitive.Regex); isRegex {
+				continue
+			}
+			if doc, err = setField(doc, splitPath(e.Key), deepCopy(e.Value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return doc, nil
+}
+
+func updateArithmetic(doc bson.D, path []string, op string, arg interface{}) (bson.D, error) {
+	if _, ok := toFloat(arg); !ok {
+		return nil, fmt.Errorf("%w: cannot %s with non-numeric argument", ErrBadValue, op)
+	}
+
+	old, ok := getField(doc, path)
+	if !ok || old == nil {
+		if op == "$mul" {
+			return setField(doc, path, multiply(zeroOf(arg), arg))
+		}
+		return setField(doc, path, arg)
+	}
+	if _, ok := toFloat(old); !ok {
+		return nil, fmt.Errorf("%w: cannot apply %s to a value of non-numeric type %T", ErrBadValue, op, old)
+	}
+
+	if op == "$inc" {
+		return setField(doc, path, add(old, arg))
+	}
+	return setField(doc, path, multiply(old, arg))
+}
+
+func zeroOf(v interface{}) interface{} {
+	switch v.(type) {
+	case int32:
+		return int32(0)
+	case int64:
+		return int64(0)
+	}
+
+	return float64(0)
+}
+
+// add 数值相加，整数溢出时提升类型
+func add(a, b interface{}) interface{} {
+	switch x := a.(type) {
+	case int32:
+		switch y := b.(type) {
+		case int32:
+			r := int64(x) + int64(y)
+			if r >= math.MinInt32 && r <= math.MaxInt32 {
+				return int32(r)
+			}
+			return r
+		case int64:
+			return int64(x) + y
+		}
+	case int64:
+		switch y := b.(type) {
+		case int32:
+			return x + int64(y)
+		case int64:
+			return x + y
+		}
+	}
+
+	fa, _ := toFloat(a)
+	fb, _ := toFloat(b)
+	return fa + fb
+}
+
+func multiply(a, b interface{}) interface{} {
+	switch x := a.(type) {
+	case int32:
+		switch y := b.(type) {
+		case int32:
+			r := int64(x) * int64(y)
+			if r >= math.MinInt32 && r <= math.MaxInt32 {
+				return int32(r)
+			}
+			return r
+		case int64:
+			return int64(x) * y
+		}
+	case int64:
+		switch y := b.(type) {
+		case int32:
+			return x * int64(y)
+		case int64:
+			return x * y
+		}
+	}
+
+	fa, _ := toFloat(a)
+	fb, _ := toFloat(b)
+	return fa * fb
+}
+
+func arrayField(doc bson.D, path []string, op string) (bson.A, error) {
+	old, ok := getField(doc, path)
+	if !ok || old == nil {
+		return bson.A{}, nil
+	}
+
+	a, ok := old.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("%w: the field '%s' must be an array for %s", ErrBadValue, strings.Join(path, "."), op)
+	}
+
+	return a, nil
+}
+
+func updatePush(doc bson.D, path []string, op string, arg interface{}) (bson.D, error) {
+	a, err := arrayField(doc, path, op)
+	if err != nil {
+		return nil, err
+	}
+
+	items := bson.A{arg}
+	position := -1
+	slice, hasSlice := 0, false
+
+	if mod, ok := arg.(bson.D); ok && len(mod) > 0 && mod[0].Key == "$each" {
+		items = nil
+		for _, m := range mod {
+			switch m.Key {
+			case "$each":
+				each, ok := m.Value.(bson.A)
+				if !ok {
+					return nil, fmt.Errorf("%w: $each requires an array", ErrBadValue)
+				}
+				items = each
+			case "$position":
+				n, _ := toFloat(m.Value)
+				position = int(n)
+			case "$slice":
+				n, _ := toFloat(m.Value)
+				slice, hasSlice = int(n), true
+			default:
+				return nil, fmt.Errorf("%w: %s modifier %s", ErrNotSupported, op, m.Key)
+			}
+		}
+	}
+
+	for _, item := range items {
+		if op == "$addToSet" && containsValue(a, item) {
+			continue
+		}
+		if position < 0 || position >= len(a) {
+			a = append(a, deepCopy(item))
+		} else {
+			a = append(a[:position], append(bson.A{deepCopy(item)}, a[position:]...)...)
+			position++
+		}
+	}
+
+	if hasSlice {
+		switch {
+		case slice >= 0 && slice < len(a):
+			a = a[:slice]
+		case slice < 0 && -slice < len(a):
+			a = a[len(a)+slice:]
+		}
+	}
+
+	return setField(doc, path, a)
+}
+
+func containsValue(a bson.A, v interface{}) bool {
+	for _, item := range a {
+		if equal(item, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func updatePull(doc bson.D, path []string, op string, arg interface{}) (bson.D, error) {
+	if _, ok := getField(doc, path); !ok {
+		return doc, nil
+	}
+
+	a, err := arrayField(doc, path, op)
+	if err != nil {
+		return nil, err
+	}
+
+	res := bson.A{}
+	for _, item := range a {
+		var remove bool
+		switch {
+		case op == "$pullAll":
+			all, ok := arg.(bson.A)
+			if !ok {
+				return nil, fmt.Errorf("%w: $pullAll requires an array argument", ErrBadValue)
+			}
+			remove = containsValue(all, item)
+		case isOperatorDoc(arg):
+			if remove, err = matchOperators([]interface{}{item}, arg.(bson.D)); err != nil {
+				return nil, err
+			}
+		default:
+			cond, isCond := arg.(bson.D)
+			itemDoc, isDoc := item.(bson.D)
+			if isCond && isDoc {
+				if remove, err = match(itemDoc, cond); err != nil {
+					return nil, err
+				}
+			} else {
+				remove = equal(item, arg)
+			}
+		}
+
+		if !remove {
+			res = append(res, item)
+		}
+	}
+
+	return setField(doc, path, res)
+}
+
+func updatePop(doc bson.D, path []string, arg interface{}) (bson.D, error) {
+	if _, ok := getField(doc, path); !ok {
+		return doc, nil
+	}
+
+	a, err := arrayField(doc, path, "$pop")
+	if err != nil {
+		return nil, err
+	}
+	if len(a) == 0 {
+		return doc, nil
+	}
+
+	if n, _ := toFloat(arg); n < 0 {
+		return setField(doc, path, a[1:])
+	}
+	return setField(doc, path, a[:len(a)-1])
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"xtravisions.com/xmgo"
+	"xtravisions.com/xmgo/memory"
+)
+
+func TestUpdateOperators(t *testing.T) {
+	ctx := context.Background()
+	coll := memory.NewClient().Database("test").Collection("counters")
+	if _, err := coll.InsertOneWithCtx(ctx, xmgo.M{"_id": 1, "n": 2, "tags": bson.A{"a", "b"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	update := xmgo.D{
+		{Key: "$inc", Value: xmgo.M{"n": 3}},
+		{Key: "$set", Value: xmgo.M{"profile.name": "alice"}},
+		{Key: "$addToSet", Value: xmgo.M{"tags": "b"}},
+		{Key: "$push", Value: xmgo.M{"tags": "c"}},
+	}
+	if err := coll.UpdateOneWithCtx(ctx, xmgo.M{"_id": 1}, update); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		N       int
+		Tags    []string
+		Profile struct{ Name string }
+	}
+	if err := coll.FindWithCtx(ctx, xmgo.M{"_id": 1}).One(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.N != 5 || got.Profile.Name != "alice" || len(got.Tags) != 3 || got.Tags[2] != "c" {
+		t.Errorf("document after update = %+v", got)
+	}
+
+	if err := coll.UpdateOneWithCtx(ctx, xmgo.M{"_id": 1}, xmgo.M{"$unset": xmgo.M{"profile": ""}}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := coll.FindWithCtx(ctx, xmgo.M{"profile": xmgo.M{"$exists": true}}).Count(); n != 0 {
+		t.Errorf("documents with profile after $unset = %d, want 0", n)
+	}
+}
+
+func TestUpdateRejectsInvalidDocuments(t *testing.T) {
+	ctx := context.Background()
+	coll := memory.NewClient().Database("test").Collection("counters")
+	if _, err := coll.InsertOneWithCtx(ctx, xmgo.M{"_id": 1, "n": "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := coll.UpdateOneWithCtx(ctx, xmgo.M{"_id": 1}, xmgo.M{"$inc": xmgo.M{"n": 1}})
+	if !errors.Is(err, memory.ErrBadValue) {
+		t.Errorf("$inc on string error = %v, want ErrBadValue", err)
+	}
+
+	err = coll.UpdateOneWithCtx(ctx, xmgo.M{"_id": 1}, xmgo.M{"$set": xmgo.M{"_id": 2}})
+	if err == nil {
+		t.Error("modifying _id error = nil, want error")
+	}
+
+	err = coll.UpdateOneWithCtx(ctx, xmgo.M{"_id": 1}, xmgo.M{"$set": xmgo.M{"tags.$": "x"}})
+	if !errors.Is(err, memory.ErrNotSupported) {
+		t.Errorf("positional update error = %v, want ErrNotSupported", err)
+	}
+}
@@ -0,0 +1,300 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"xtravisions.com/xmgo"
+)
+
+// toDoc 将任意文档转换为标准化的 bson.D
+//
+//	嵌套文档转换为 bson.D，数组转换为 bson.A，时间转换为 primitive.DateTime
+func toDoc(v interface{}) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc bson.D
+	if err = bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// toArray 将切片转换为标准化的 bson.A
+func toArray(v interface{}) (bson.A, error) {
+	doc, err := toDoc(bson.D{{Key: "v", Value: v}})
+	if err != nil {
+		return nil, err
+	}
+
+	switch a := doc[0].Value.(type) {
+	case bson.A:
+		return a, nil
+	case nil:
+		return bson.A{}, nil
+	default:
+		return nil, fmt.Errorf("%w: expect array, got %T", ErrBadValue, v)
+	}
+}
+
+// toValue 将任意值转换为标准化的 bson 值
+func toValue(v interface{}) (interface{}, error) {
+	doc, err := toDoc(bson.D{{Key: "v", Value: v}})
+	if err != nil {
+		return nil, err
+	}
+
+	return doc[0].Value, nil
+}
+
+// decode 将文档解码到 result
+func decode(doc bson.D, result interface{}) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	return bson.Unmarshal(data, result)
+}
+
+// decodeAll 将文档解码到 results 指向的切片
+func decodeAll(docs []bson.D, results interface{}) error {
+	rv := reflect.ValueOf(results)
+	if rv.Kind() != reflect.Ptr {
+		return xmgo.ErrQueryNotSlicePointer
+	}
+
+	sv := rv.Elem()
+	if sv.Kind() == reflect.Interface {
+		sv = sv.Elem()
+	}
+	if sv.Kind() != reflect.Slice {
+		return xmgo.ErrQueryNotSliceType
+	}
+
+	slice := reflect.MakeSlice(sv.Type(), 0, len(docs))
+	for _, doc := range docs {
+		elem := reflect.New(sv.Type().Elem())
+		if err := decode(doc, elem.Interface()); err != nil {
+			return err
+		}
+		slice = reflect.Append(slice, elem.Elem())
+	}
+
+	rv.Elem().Set(slice)
+	return nil
+}
+
+// deepCopy 深拷贝 bson 值
+func deepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case bson.D:
+		res := make(bson.D, len(t))
+		for i, e := range t {
+			res[i] = bson.E{Key: e.Key, Value: deepCopy(e.Value)}
+		}
+		return res
+	case bson.A:
+		res := make(bson.A, len(t))
+		for i, e := range t {
+			res[i] = deepCopy(e)
+		}
+		return res
+	case primitive.Binary:
+		return primitive.Binary{Subtype: t.Subtype, Data: append([]byte(nil), t.Data...)}
+	default:
+		return v
+	}
+}
+
+func copyDoc(doc bson.D) bson.D {
+	return deepCopy(doc).(bson.D)
+}
+
+// typeOrder mongodb 跨类型比较顺序
+func typeOrder(v interface{}) int {
+	switch v.(type) {
+	case primitive.MinKey:
+		return 1
+	case nil, primitive.Null, primitive.Undefined:
+		return 2
+	case int32, int64, float64, primitive.Decimal128:
+		return 3
+	case string, primitive.Symbol:
+		return 4
+	case bson.D:
+		return 5
+	case bson.A:
+		return 6
+	case primitive.Binary:
+		return 7
+	case primitive.ObjectID:
+		return 8
+	case bool:
+		return 9
+	case primitive.DateTime:
+		return 10
+	case primitive.Timestamp:
+		return 11
+	case primitive.Regex:
+		return 12
+	case primitive.MaxKey:
+		return 13
+	default:
+		return 14
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(n.String(), 64)
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+// compare 按 mongodb 排序规则比较两个 bson 值
+func compare(a, b interface{}) int {
+	ta, tb := typeOrder(a), typeOrder(b)
+	if ta != tb {
+		return ta - tb
+	}
+
+	switch x := a.(type) {
+	case int32, int64, float64, primitive.Decimal128:
+		fa, _ := toFloat(x)
+		fb, _ := toFloat(b)
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		case math.IsNaN(fa) && !math.IsNaN(fb):
+			return -1
+		case !math.IsNaN(fa) && math.IsNaN(fb):
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(x, stringValue(b))
+	case primitive.Symbol:
+		return strings.Compare(string(x), stringValue(b))
+	case bson.D:
+		y := b.(bson.D)
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := strings.Compare(x[i].Key, y[i].Key); c != 0 {
+				return c
+			}
+			if c := compare(x[i].Value, y[i].Value); c != 0 {
+				return c
+			}
+		}
+		return len(x) - len(y)
+	case bson.A:
+		y := b.(bson.A)
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := compare(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+		return len(x) - len(y)
+	case primitive.Binary:
+		y := b.(primitive.Binary)
+		if x.Subtype != y.Subtype {
+			return int(x.Subtype) - int(y.Subtype)
+		}
+		return bytes.Compare(x.Data, y.Data)
+	case primitive.ObjectID:
+		y := b.(primitive.ObjectID)
+		return bytes.Compare(x[:], y[:])
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	case primitive.DateTime:
+		y := b.(primitive.DateTime)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case primitive.Timestamp:
+		y := b.(primitive.Timestamp)
+		return primitive.CompareTimestamp(x, y)
+	case primitive.Regex:
+		y := b.(primitive.Regex)
+		return strings.Compare(x.Pattern+"/"+x.Options, y.Pattern+"/"+y.Options)
+	}
+
+	return 0
+}
+
+func stringValue(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case primitive.Symbol:
+		return string(s)
+	}
+
+	return ""
+}
+
+// equal 判断两个 bson 值是否相等，数值类型按值比较
+func equal(a, b interface{}) bool {
+	return typeOrder(a) == typeOrder(b) && compare(a, b) == 0
+}
+
+// truthy 判断投影、排序等参数值是否为真
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return false
+	case bool:
+		return t
+	case int32, int64, float64, primitive.Decimal128:
+		f, _ := toFloat(t)
+		return f != 0
+	}
+
+	return true
+}
+
+func isOperatorDoc(v interface{}) bool {
+	d, ok := v.(bson.D)
+	return ok && len(d) > 0 && strings.HasPrefix(d[0].Key, "$")
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package memory
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+
+	"xtravisions.com/xmgo"
+)
+
+// writeModel 单个写操作，供 Collection 及 Bulk 共用
+type writeModel struct {
+	insert  interface{}
+	filter  interface{}
+	update  interface{}
+	replace bool
+	upsert  bool
+	many    bool
+	remove  bool
+}
+
+type writeResult struct {
+	inserted   int64
+	matched    int64
+	modified   int64
+	deleted    int64
+	upserted   int64
+	upsertedID interface{}
+	insertedID interface{}
+}
+
+// apply 执行写操作，调用方需持有写锁
+func (m writeModel) apply(c *collection) (res writeResult, err error) {
+	if m.insert != nil {
+		doc, err := toDoc(m.insert)
+		if err != nil {
+			return res, err
+		}
+		if res.insertedID, err = c.insert(doc); err != nil {
+			return res, err
+		}
+		res.inserted = 1
+		return res, nil
+	}
+
+	filter, err := toDoc(m.filter)
+	if err != nil {
+		return
+	}
+	matched, err := c.filter(filter)
+	if err != nil {
+		return
+	}
+	if !m.many && len(matched) > 1 {
+		matched = matched[:1]
+	}
+
+	if m.remove {
+		c.remove(matched)
+		res.deleted = int64(len(matched))
+		return
+	}
+
+	update, err := toDoc(m.update)
+	if err != nil {
+		return
+	}
+
+	for _, i := range matched {
+		var doc bson.D
+		if m.replace {
+			doc, err = applyReplace(c.docs[i], update)
+		} else {
+			doc, err = applyUpdate(c.docs[i], update, false)
+		}
+		if err != nil {
+			return
+		}
+
+		res.matched++
+		if compare(doc, c.docs[i]) == 0 {
+			continue
+		}
+		if err = c.replace(i, doc); err != nil {
+			return
+		}
+		res.modified++
+	}
+
+	if len(matched) > 0 || !m.upsert {
+		return
+	}
+
+	doc, err := upsertDocument(filter)
+	if err != nil {
+		return
+	}
+	if m.replace {
+		base := bson.D{}
+		if id, ok := getField(doc, []string{"_id"}); ok {
+			base = bson.D{{Key: "_id", Value: id}}
+		}
+		if doc, err = applyReplace(base, update); err != nil {
+			return
+		}
+	} else if doc, err = applyUpdate(doc, update, true); err != nil {
+		return
+	}
+
+	if res.upsertedID, err = c.insert(doc); err != nil {
+		return
+	}
+	res.upserted = 1
+
+	return
+}
+
+func (r writeResult) updateResult() *xmgo.UpdateResult {
+	return &xmgo.UpdateResult{
+		MatchedCount:  r.matched,
+		ModifiedCount: r.modified,
+		UpsertedCount: r.upserted,
+		UpsertedID:    r.upsertedID,
+	}
+}
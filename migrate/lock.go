@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package migrate
+
+import (
+	"context"
+	"errors"
+
+	"xtravisions.com/xmgo/internal/lease"
+)
+
+const lockID = "_lock"
+
+// withLock 在持有分布式锁期间执行 fn
+//
+//	锁续期失败时取消传给 fn 的上下文并返回续期的错误
+func (m *Migrator) withLock(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if err = m.lock.Acquire(ctx); err != nil {
+		if errors.Is(err, lease.ErrHeld) {
+			return ErrLocked
+		}
+		return
+	}
+
+	lCtx, cancel := context.WithCancel(ctx)
+	kept := make(chan error, 1)
+	go func() {
+		kept <- m.lock.Keep(lCtx, cancel)
+	}()
+
+	defer func() {
+		cancel()
+		if kErr := <-kept; kErr != nil {
+			err = kErr
+		}
+		if rErr := m.lock.Release(context.Background()); rErr != nil && err == nil {
+			err = rErr
+		}
+	}()
+
+	return fn(lCtx)
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"xtravisions.com/xmgo"
+)
+
+var (
+	// ErrLocked return if migrations are being run by another instance
+	ErrLocked = errors.New("migrations are locked by another instance")
+	// ErrUnknownMigration return if migration id is not registered
+	ErrUnknownMigration = errors.New("unknown migration")
+	// ErrIrreversible return if migration has no Down func
+	ErrIrreversible = errors.New("migration is irreversible")
+)
+
+// Migration 版本迁移
+type Migration struct {
+	// 迁移唯一标识，按字典序执行，建议使用时间戳前缀，如 `20221019_add_user_status`
+	ID string
+	// 迁移说明
+	Description string
+	// 升级操作
+	Up func(ctx context.Context, db *xmgo.Database) error
+	// 回滚操作，为空表示不可回滚
+	Down func(ctx context.Context, db *xmgo.Database) error
+	// 不在事务中执行，如创建索引等不支持事务的操作
+	NoTransaction bool
+}
+
+var migrations = make(map[string]Migration, 0)
+
+// Register 注册全局迁移
+//
+//	通常在迁移所在包的 init 中调用，重复的 ID 会引发 panic
+func Register(m Migration) {
+	if m.ID == "" {
+		panic("Mongo Migrate: 迁移 ID 不能为空")
+	}
+	if m.Up == nil {
+		panic(fmt.Sprintf("Mongo Migrate: 迁移 %s 缺少 Up", m.ID))
+	}
+	if _, ok := migrations[m.ID]; ok {
+		panic(fmt.Sprintf("Mongo Migrate: 迁移 %s 重复注册", m.ID))
+	}
+
+	migrations[m.ID] = m
+}
+
+// Registered 获取已注册的全局迁移，按 ID 排序
+func Registered() []Migration {
+	res := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		res = append(res, m)
+	}
+
+	return sortMigrations(res)
+}
+
+func sortMigrations(ms []Migration) []Migration {
+	sort.SliceStable(ms, func(i, j int) bool {
+		return ms[i].ID < ms[j].ID
+	})
+
+	return ms
+}
@@ -0,0 +1,252 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"xtravisions.com/xmgo"
+	"xtravisions.com/xmgo/internal/lease"
+)
+
+// DefaultCollection 迁移状态默认存储的 collection
+const DefaultCollection = "_migrations"
+
+// Options 迁移配置
+type Options struct {
+	// 迁移状态存储的 collection，默认为 DefaultCollection
+	Collection string
+	// 分布式锁有效期，执行期间自动续期，默认为 1 分钟
+	LockTTL time.Duration
+	// 待执行的迁移，为空时使用 Register 注册的全局迁移
+	Migrations []Migration
+}
+
+// Status 迁移状态
+type Status struct {
+	ID          string
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+}
+
+type record struct {
+	Id          string    `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+// Migrator 迁移执行器
+type Migrator struct {
+	client     *xmgo.Client
+	db         *xmgo.Database
+	name       string
+	lock       *lease.Lease
+	migrations []Migration
+}
+
+// New 创建迁移执行器
+//
+//	@param client mongodb 连接
+//	@param database 数据库名称
+//	@param o 迁移配置
+func New(client *xmgo.Client, database string, o ...Options) *Migrator {
+	m := &Migrator{
+		client: client,
+		db:     client.Database(database),
+		name:   DefaultCollection,
+	}
+
+	lockTTL := time.Minute
+	var migrations []Migration
+	if len(o) > 0 {
+		if o[0].Collection != "" {
+			m.name = o[0].Collection
+		}
+		if o[0].LockTTL > 0 {
+			lockTTL = o[0].LockTTL
+		}
+		migrations = append(migrations, o[0].Migrations...)
+	}
+	if len(migrations) == 0 {
+		migrations = Registered()
+	}
+	m.migrations = sortMigrations(migrations)
+	m.lock = lease.New(m.collection().Interface(), lockID, lockTTL)
+
+	return m
+}
+
+func (m *Migrator) collection() *xmgo.Collection {
+	return m.db.Collection(m.name)
+}
+
+// Status 获取全部迁移的执行状态
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Status, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		s := Status{ID: mg.ID, Description: mg.Description}
+		if r, ok := applied[mg.ID]; ok {
+			s.Applied = true
+			s.AppliedAt = r.AppliedAt
+		}
+		res = append(res, s)
+	}
+
+	return res, nil
+}
+
+// Up 执行全部未执行的迁移
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, mg := range m.migrations {
+			if _, ok := applied[mg.ID]; ok {
+				continue
+			}
+			if err = m.up(ctx, mg); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Down 回滚最近执行的一个迁移
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].ID]; ok {
+				return m.down(ctx, m.migrations[i])
+			}
+		}
+
+		return nil
+	})
+}
+
+// To 迁移到指定版本
+//
+//	执行 id 及之前全部未执行的迁移，并回滚 id 之后已执行的迁移
+//	id 为空时回滚全部迁移
+func (m *Migrator) To(ctx context.Context, id string) error {
+	target := -1
+	for i, mg := range m.migrations {
+		if mg.ID == id {
+			target = i
+		}
+	}
+	if id != "" && target < 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownMigration, id)
+	}
+
+	return m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i > target; i-- {
+			if _, ok := applied[m.migrations[i].ID]; ok {
+				if err = m.down(ctx, m.migrations[i]); err != nil {
+					return err
+				}
+			}
+		}
+
+		for i := 0; i <= target; i++ {
+			if _, ok := applied[m.migrations[i].ID]; !ok {
+				if err = m.up(ctx, m.migrations[i]); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[string]record, error) {
+	var records []record
+	if err := m.collection().FindWithCtx(ctx, xmgo.M{"_id": xmgo.M{"$ne": lockID}}).All(&records); err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]record, len(records))
+	for _, r := range records {
+		res[r.Id] = r
+	}
+
+	return res, nil
+}
+
+func (m *Migrator) up(ctx context.Context, mg Migration) error {
+	err := m.run(ctx, mg, func(ctx context.Context) error {
+		if err := mg.Up(ctx, m.db); err != nil {
+			return err
+		}
+
+		_, err := m.collection().InsertOneWithCtx(ctx, record{Id: mg.ID, Description: mg.Description, AppliedAt: time.Now()})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("migration %s up: %w", mg.ID, err)
+	}
+
+	return nil
+}
+
+func (m *Migrator) down(ctx context.Context, mg Migration) error {
+	if mg.Down == nil {
+		return fmt.Errorf("migration %s down: %w", mg.ID, ErrIrreversible)
+	}
+
+	err := m.run(ctx, mg, func(ctx context.Context) error {
+		if err := mg.Down(ctx, m.db); err != nil {
+			return err
+		}
+
+		return m.collection().RemoveByIdWithCtx(ctx, mg.ID)
+	})
+	if err != nil {
+		return fmt.Errorf("migration %s down: %w", mg.ID, err)
+	}
+
+	return nil
+}
+
+// run 在服务器支持时于事务中执行 fn，否则直接执行
+func (m *Migrator) run(ctx context.Context, mg Migration, fn func(ctx context.Context) error) error {
+	if mg.NoTransaction {
+		return fn(ctx)
+	}
+
+	_, err := m.client.DoTransactionWithCtx(ctx, func(sessCtx context.Context) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	if errors.Is(err, xmgo.ErrTransactionNotSupported) {
+		return fn(ctx)
+	}
+
+	return err
+}
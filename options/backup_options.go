@@ -0,0 +1,23 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package options
+
+// BackupOptions 备份配置
+type BackupOptions struct {
+	Include  []string    // 需要备份的 collection，为空表示全部
+	Exclude  []string    // 不需要备份的 collection
+	Filter   interface{} // 备份数据的查询条件，应用于全部 collection
+	Progress func(collection string, n int64)
+}
+
+// RestoreOptions 还原配置
+type RestoreOptions struct {
+	Include   []string // 需要还原的 collection，为空表示全部
+	Exclude   []string // 不需要还原的 collection
+	Drop      bool     // 还原前删除已存在的 collection
+	NoIndexes bool     // 不还原索引
+	BatchSize int      // 每批写入的文档数量，默认为 1000
+	Progress  func(collection string, n int64)
+}
@@ -0,0 +1,14 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package options
+
+import "go.mongodb.org/mongo-driver/mongo/options"
+
+// CollectionOptions 源生 collection 参数引用，用于设置读策略、读关注及写关注
+//
+//	参见 go.mongodb.org/mongo-driver/mongo/options/CollectionOptions
+type CollectionOptions struct {
+	*options.CollectionOptions
+}
@@ -0,0 +1,34 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package options
+
+// CSV 字段类型
+const (
+	CSVString   = "string"
+	CSVInt      = "int"
+	CSVFloat    = "float"
+	CSVBool     = "bool"
+	CSVDate     = "date"
+	CSVObjectId = "objectId"
+	CSVArray    = "array"
+)
+
+// CSVField CSV 列到文档字段的映射
+type CSVField struct {
+	Header     string // CSV 列名
+	Path       string // 文档字段，支持 a.b 形式，默认与 Header 相同
+	Type       string // 字段类型，默认为 CSVString
+	TimeLayout string // CSVDate 的时间格式，默认为 time.RFC3339
+	Separator  string // CSVArray 的元素分隔符，默认为 `;`
+}
+
+// CSVImportOptions CSV 导入配置
+type CSVImportOptions struct {
+	Fields    []CSVField // 列映射，为空时按表头导入全部列为字符串
+	Comma     rune       // 列分隔符，默认为 `,`
+	BatchSize int        // 每批写入的文档数量，默认为 1000
+	SkipEmpty bool       // 忽略空单元格，不写入对应字段
+	Progress  func(n int64)
+}
@@ -0,0 +1,33 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package options
+
+// 导入导出数据格式
+const (
+	// FormatNDJSON 每行一个 Extended JSON 文档
+	FormatNDJSON = "ndjson"
+	// FormatJSONArray Extended JSON 文档数组
+	FormatJSONArray = "json"
+)
+
+// ExportOptions 导出配置
+type ExportOptions struct {
+	Format     string      // 导出格式，默认为 FormatNDJSON
+	Canonical  bool        // 使用 canonical 模式的 Extended JSON，默认为 relaxed 模式
+	Sort       interface{} // 排序
+	Projection interface{} // 投影
+	Limit      int64       // 导出数量，0 表示不限制
+	BatchSize  int64       // 每导出多少文档回调一次 Progress，默认为 1000
+	Progress   func(n int64)
+}
+
+// ImportOptions 导入配置
+type ImportOptions struct {
+	Format     string   // 导入格式，默认按内容自动识别 FormatNDJSON 或 FormatJSONArray
+	BatchSize  int      // 每批写入的文档数量，默认为 1000
+	UpsertKeys []string // 按指定字段（支持 a.b 形式）更新或插入，为空时直接插入
+	Ordered    bool     // 是否有序写入，有序写入遇到错误即停止
+	Progress   func(n int64)
+}
@@ -8,6 +8,10 @@ import "go.mongodb.org/mongo-driver/mongo/options"
 
 // IndexOptions 索引配置
 type IndexOptions struct {
-	Key []string // Index key fields; prefix name with dash (-) for descending order
+	// Index key fields; prefix name with dash (-) for descending order
+	//	`$text:title` text index, `#userId` hashed index, `@location` 2dsphere index
+	//	`$2d:location`, `$2dsphere:location`, `$hashed:userId` explicit index type
+	//	`$**` or `path.$**` wildcard index
+	Key []string
 	*options.IndexOptions
 }
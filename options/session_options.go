@@ -6,6 +6,10 @@ package options
 
 import "go.mongodb.org/mongo-driver/mongo/options"
 
+// SessionOptions 源生会话参数引用
+//
+//	通过 SetCausalConsistency 设置因果一致性（默认开启），SetDefaultReadConcern、SetDefaultWriteConcern 设置默认读写关注
+//	参见 go.mongodb.org/mongo-driver/mongo/options/SessionOptions
 type SessionOptions struct {
 	*options.SessionOptions
 }
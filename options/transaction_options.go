@@ -6,6 +6,21 @@ package options
 
 import "go.mongodb.org/mongo-driver/mongo/options"
 
+// Propagation 事务传播方式，决定在已存在的事务中调用 DoTransaction 时的行为
+type Propagation int
+
+const (
+	// PropagationRequired 已存在事务时加入该事务，否则开启新事务
+	//	内层回调返回错误时外层事务只能回滚
+	PropagationRequired Propagation = iota
+	// PropagationRequiresNew 总是使用新会话开启独立事务，与外层事务分别提交或回滚
+	PropagationRequiresNew
+	// PropagationNever 不使用事务执行回调，已存在事务时返回错误
+	PropagationNever
+)
+
 type TransactionOptions struct {
+	// 事务传播方式，默认为 PropagationRequired
+	Propagation Propagation
 	*options.TransactionOptions
 }
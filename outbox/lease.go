@@ -0,0 +1,29 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package outbox
+
+import (
+	"context"
+	"errors"
+
+	"xtravisions.com/xmgo/internal/lease"
+)
+
+// leaseID 租约文档 id，与事件存储在同一 collection，无 status 字段不会被投递
+const leaseID = "_lease"
+
+// acquire 获取或续期租约，租约过期或由当前实例持有时可获取
+func (r *Relay) acquire(ctx context.Context) error {
+	err := r.lease.Acquire(ctx)
+	if errors.Is(err, lease.ErrHeld) {
+		return ErrLeased
+	}
+
+	return err
+}
+
+func (r *Relay) release(ctx context.Context) error {
+	return r.lease.Release(ctx)
+}
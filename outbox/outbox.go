@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+// Package outbox 事务性发件箱，与业务数据在同一事务中写入事件，由 Relay 可靠地投递到消息系统
+//
+//	在 DoTransaction 回调中调用 Outbox.Enqueue 写入事件，事务提交后事件才对 Relay 可见；
+//	Relay 按写入顺序读取未投递的事件交给 Publisher，投递成功后标记为已投递，失败时按退避策略重试，
+//	多个实例通过租约保证同一时刻只有一个 Relay 投递，已投递的事件由 TTL 索引定期清理
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"xtravisions.com/xmgo"
+	opts "xtravisions.com/xmgo/options"
+)
+
+// DefaultCollection 事件默认存储的 collection
+const DefaultCollection = "_outbox"
+
+var (
+	// ErrLeased return if relay lease is held by another instance
+	ErrLeased = errors.New("outbox relay is leased by another instance")
+	// ErrEmptyTopic return if message topic is empty
+	ErrEmptyTopic = errors.New("outbox message topic is empty")
+)
+
+// Status 事件投递状态
+type Status string
+
+const (
+	// StatusPending 待投递
+	StatusPending Status = "pending"
+	// StatusSent 已投递
+	StatusSent Status = "sent"
+	// StatusFailed 超过最大投递次数，不再投递，相同分区键的后续事件同样暂停投递
+	StatusFailed Status = "failed"
+)
+
+// Options 发件箱配置
+type Options struct {
+	// 事件存储的 collection，默认为 DefaultCollection
+	Collection string
+	// 已投递事件的保留时间，由 EnsureIndexes 创建的 TTL 索引清理，默认为 7 天
+	Retention time.Duration
+}
+
+// Message 待写入发件箱的事件
+type Message struct {
+	// 主题，如消息队列的 topic 或 exchange
+	Topic string
+	// 分区键，相同分区键的事件按写入顺序投递，为空时不保证相对顺序
+	Key string
+	// 事件内容
+	Payload interface{}
+	// 附加信息
+	Headers map[string]string
+}
+
+// Event 发件箱中的事件
+type Event struct {
+	Id       xmgo.ObjectId     `bson:"_id"`
+	Topic    string            `bson:"topic"`
+	Key      string            `bson:"key,omitempty"`
+	Payload  bson.RawValue     `bson:"payload"`
+	Headers  map[string]string `bson:"headers,omitempty"`
+	Status   Status            `bson:"status"`
+	Attempts int               `bson:"attempts"`
+	// 最近一次投递失败的原因
+	LastError   string     `bson:"lastError,omitempty"`
+	CreatedAt   time.Time  `bson:"createdAt"`
+	NextAttempt time.Time  `bson:"nextAttempt"`
+	SentAt      *time.Time `bson:"sentAt,omitempty"`
+}
+
+// Outbox 事务性发件箱
+type Outbox struct {
+	db        xmgo.IDatabase
+	name      string
+	retention time.Duration
+}
+
+// New 创建发件箱
+//
+//	@param db 业务数据所在的数据库，事件与业务数据需在同一事务中写入
+//	@param o 发件箱配置
+func New(db xmgo.IDatabase, o ...Options) *Outbox {
+	ob := &Outbox{
+		db:        db,
+		name:      DefaultCollection,
+		retention: 7 * 24 * time.Hour,
+	}
+
+	if len(o) > 0 {
+		if o[0].Collection != "" {
+			ob.name = o[0].Collection
+		}
+		if o[0].Retention > 0 {
+			ob.retention = o[0].Retention
+		}
+	}
+
+	return ob
+}
+
+func (ob *Outbox) collection() xmgo.ICollection {
+	return ob.db.Collection(ob.name)
+}
+
+// EnsureIndexes 创建投递查询索引及已投递事件的 TTL 索引
+//
+//	投递查询按 status 等值匹配、createdAt 与 _id 排序、nextAttempt 范围过滤，索引字段按此顺序排列；
+//	不支持在事务中执行
+func (ob *Outbox) EnsureIndexes(ctx context.Context) error {
+	return ob.collection().CreateIndexesWithCtx(ctx, []opts.IndexOptions{
+		{Key: []string{"status", "createdAt", "_id", "nextAttempt"}},
+		{Key: []string{"sentAt"}, IndexOptions: options.Index().SetExpireAfterSeconds(int32(ob.retention / time.Second))},
+	})
+}
+
+// Enqueue 写入事件，需使用 DoTransaction 回调或 Session.Begin 返回的上下文，与业务数据一同提交或回滚
+//
+//	ctx 不处于事务中（包括 TransactionBestEffort 模式）时返回 xmgo.ErrNotInTransaction
+//	@param ctx 事务上下文
+//	@param messages 事件
+func (ob *Outbox) Enqueue(ctx context.Context, messages ...Message) error {
+	if !xmgo.InTransaction(ctx) {
+		return xmgo.ErrNotInTransaction
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	docs := make([]interface{}, 0, len(messages))
+	for _, m := range messages {
+		if m.Topic == "" {
+			return ErrEmptyTopic
+		}
+
+		docs = append(docs, xmgo.M{
+			"_id":         xmgo.NewObjectId(),
+			"topic":       m.Topic,
+			"key":         m.Key,
+			"payload":     m.Payload,
+			"headers":     m.Headers,
+			"status":      StatusPending,
+			"attempts":    0,
+			"createdAt":   now,
+			"nextAttempt": now,
+		})
+	}
+
+	_, err := ob.collection().InsertManyWithCtx(ctx, docs)
+	return err
+}
+
+// Pending 获取待投递事件数量
+func (ob *Outbox) Pending(ctx context.Context) (int64, error) {
+	return ob.collection().FindWithCtx(ctx, xmgo.M{"status": StatusPending}).Count()
+}
+
+// Retry 将投递失败的事件重置为待投递
+//
+//	重置后相同分区键被阻塞的后续事件在该事件之后继续投递
+//	@param ctx 上下文
+//	@param ids 事件 id，为空时重置全部失败事件
+func (ob *Outbox) Retry(ctx context.Context, ids ...xmgo.ObjectId) error {
+	filter := xmgo.M{"status": StatusFailed}
+	if len(ids) > 0 {
+		filter["_id"] = xmgo.M{"$in": ids}
+	}
+
+	_, err := ob.collection().UpdateAllWithCtx(ctx, filter, xmgo.M{
+		"$set": xmgo.M{"status": StatusPending, "attempts": 0, "nextAttempt": time.Now()},
+	})
+	return err
+}
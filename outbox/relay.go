@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"xtravisions.com/xmgo"
+	"xtravisions.com/xmgo/internal/lease"
+)
+
+// Publisher 事件投递接口，如发送到消息队列
+//
+//	返回 nil 表示投递成功；投递可能重复（如标记已投递前进程退出），消费方需按 Event.Id 去重
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// PublisherFunc 函数形式的 Publisher
+type PublisherFunc func(ctx context.Context, event Event) error
+
+func (f PublisherFunc) Publish(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// RelayOptions 投递配置
+type RelayOptions struct {
+	// 每批读取的事件数量，默认为 100
+	BatchSize int64
+	// 无待投递事件或未持有租约时的轮询间隔，默认为 1 秒
+	PollInterval time.Duration
+	// 租约有效期，投递期间自动续期，默认为 30 秒
+	LeaseTTL time.Duration
+	// 最大投递次数，达到后事件状态为 StatusFailed，相同分区键的后续事件不再投递，
+	// 可通过 Outbox.Retry 重新投递；默认为 DefaultMaxAttempts，小于 0 时不限次数
+	MaxAttempts int
+	// 投递失败后的重试间隔，默认为 xmgo.DefaultRetryPolicy 的退避策略，仅使用其中的退避参数
+	Backoff *xmgo.RetryPolicy
+	// 单个事件投递超时，默认为 10 秒
+	PublishTimeout time.Duration
+}
+
+// DefaultMaxAttempts 默认最大投递次数
+const DefaultMaxAttempts = 20
+
+// Relay 发件箱投递器，多个实例中同一时刻只有持有租约的实例投递
+type Relay struct {
+	outbox         *Outbox
+	publisher      Publisher
+	batchSize      int64
+	pollInterval   time.Duration
+	leaseTTL       time.Duration
+	maxAttempts    int
+	backoff        *xmgo.RetryPolicy
+	publishTimeout time.Duration
+	lease          *lease.Lease
+}
+
+// NewRelay 创建投递器，需调用 Run 开始投递
+//
+//	@param outbox 发件箱
+//	@param publisher 事件投递接口
+//	@param o 投递配置
+func NewRelay(outbox *Outbox, publisher Publisher, o ...RelayOptions) *Relay {
+	r := &Relay{
+		outbox:         outbox,
+		publisher:      publisher,
+		batchSize:      100,
+		pollInterval:   time.Second,
+		leaseTTL:       30 * time.Second,
+		maxAttempts:    DefaultMaxAttempts,
+		backoff:        xmgo.DefaultRetryPolicy(),
+		publishTimeout: 10 * time.Second,
+	}
+
+	if len(o) > 0 {
+		if o[0].BatchSize > 0 {
+			r.batchSize = o[0].BatchSize
+		}
+		if o[0].PollInterval > 0 {
+			r.pollInterval = o[0].PollInterval
+		}
+		if o[0].LeaseTTL > 0 {
+			r.leaseTTL = o[0].LeaseTTL
+		}
+		if o[0].MaxAttempts != 0 {
+			r.maxAttempts = o[0].MaxAttempts
+		}
+		if o[0].Backoff != nil {
+			r.backoff = o[0].Backoff
+		}
+		if o[0].PublishTimeout > 0 {
+			r.publishTimeout = o[0].PublishTimeout
+		}
+	}
+	r.lease = lease.New(outbox.collection(), leaseID, r.leaseTTL)
+
+	return r
+}
+
+// Run 持续投递，直到 ctx 结束，结束时释放租约
+func (r *Relay) Run(ctx context.Context) error {
+	defer func() {
+		_ = r.release(context.Background())
+	}()
+
+	for {
+		n, err := r.RelayOnce(ctx)
+		if err != nil && !errors.Is(err, ErrLeased) && ctx.Err() == nil {
+			fmt.Println("Mongo Outbox: 投递事件失败", err)
+		}
+
+		if n > 0 && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+// RelayOnce 获取或续期租约后投递一批事件，返回投递成功的事件数量
+//
+//	租约由其他实例持有时返回 ErrLeased
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	if err := r.acquire(ctx); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	coll := r.outbox.collection()
+
+	// 等待重试或投递失败的事件是其分区键最早的未投递事件，跳过该分区键的后续事件以保证顺序，
+	// 失败事件通过 Outbox.Retry 重置前该分区键保持阻塞
+	var waiting []string
+	err := coll.FindWithCtx(ctx, xmgo.M{"$or": []xmgo.M{
+		{"status": StatusPending, "nextAttempt": xmgo.M{"$gt": now}},
+		{"status": StatusFailed},
+	}}).Distinct("key", &waiting)
+	if err != nil {
+		return 0, err
+	}
+	blocked := make(map[string]bool, len(waiting))
+	for _, key := range waiting {
+		blocked[key] = true
+	}
+
+	var events []Event
+	err = coll.FindWithCtx(ctx, xmgo.M{
+		"status":      StatusPending,
+		"nextAttempt": xmgo.M{"$lte": now},
+	}).Sort("createdAt", "_id").Limit(r.batchSize).All(&events)
+	if err != nil {
+		return 0, err
+	}
+
+	leased := time.Now()
+	sent := 0
+	for _, e := range events {
+		if e.Key != "" && blocked[e.Key] {
+			continue
+		}
+
+		// 投递耗时较长时在租约过期前续期
+		if time.Since(leased) > r.leaseTTL/3 {
+			if err = r.acquire(ctx); err != nil {
+				return sent, err
+			}
+			leased = time.Now()
+		}
+
+		if err = r.publish(ctx, e); err != nil {
+			if ctx.Err() != nil {
+				return sent, ctx.Err()
+			}
+			blocked[e.Key] = true
+			if err = r.fail(ctx, e, err); err != nil {
+				return sent, err
+			}
+			continue
+		}
+
+		if err = r.markSent(ctx, e); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+func (r *Relay) publish(ctx context.Context, e Event) error {
+	ctx, cancel := context.WithTimeout(ctx, r.publishTimeout)
+	defer cancel()
+
+	return r.publisher.Publish(ctx, e)
+}
+
+func (r *Relay) markSent(ctx context.Context, e Event) error {
+	return r.outbox.collection().UpdateOneWithCtx(ctx, xmgo.M{"_id": e.Id}, xmgo.M{
+		"$set":   xmgo.M{"status": StatusSent, "sentAt": time.Now()},
+		"$inc":   xmgo.M{"attempts": 1},
+		"$unset": xmgo.M{"lastError": ""},
+	})
+}
+
+// fail 记录投递失败，按退避策略设置下次投递时间，超过最大投递次数时不再投递
+func (r *Relay) fail(ctx context.Context, e Event, cause error) error {
+	attempts := e.Attempts + 1
+	set := xmgo.M{
+		"attempts":    attempts,
+		"lastError":   cause.Error(),
+		"nextAttempt": time.Now().Add(r.backoff.Backoff(attempts)),
+	}
+	if r.maxAttempts > 0 && attempts >= r.maxAttempts {
+		set["status"] = StatusFailed
+	}
+
+	return r.outbox.collection().UpdateOneWithCtx(ctx, xmgo.M{"_id": e.Id}, xmgo.M{"$set": set})
+}
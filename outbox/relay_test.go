@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"xtravisions.com/xmgo"
+	"xtravisions.com/xmgo/memory"
+	"xtravisions.com/xmgo/outbox"
+)
+
+// broker 记录投递的事件 topic，down 中的 topic 投递失败
+type broker struct {
+	published []string
+	down      map[string]bool
+}
+
+func (b *broker) Publish(_ context.Context, e outbox.Event) error {
+	b.published = append(b.published, e.Topic)
+	if b.down[e.Topic] {
+		return errors.New("broker unavailable")
+	}
+	return nil
+}
+
+type relayEnv struct {
+	t      *testing.T
+	ctx    context.Context
+	outbox *outbox.Outbox
+	events xmgo.ICollection
+	broker *broker
+	relay  *outbox.Relay
+}
+
+func newRelayEnv(t *testing.T, maxAttempts int, messages ...outbox.Message) *relayEnv {
+	ctx := context.Background()
+	client := memory.NewClient()
+	db := client.Database("test")
+	ob := outbox.New(db)
+
+	_, err := client.DoTransactionWithCtx(ctx, func(sessCtx context.Context) (interface{}, error) {
+		return nil, ob.Enqueue(sessCtx, messages...)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &broker{down: map[string]bool{}}
+	hour := time.Hour.Milliseconds()
+	return &relayEnv{
+		t:      t,
+		ctx:    ctx,
+		outbox: ob,
+		events: db.Collection(outbox.DefaultCollection),
+		broker: b,
+		relay: outbox.NewRelay(ob, b, outbox.RelayOptions{
+			MaxAttempts: maxAttempts,
+			Backoff:     &xmgo.RetryPolicy{InitialBackoffMS: hour, MaxBackoffMS: hour},
+		}),
+	}
+}
+
+// round 将等待重试的事件设为到期后执行一次 RelayOnce
+func (env *relayEnv) round() int {
+	env.t.Helper()
+
+	_, err := env.events.UpdateAllWithCtx(env.ctx, xmgo.M{"status": outbox.StatusPending}, xmgo.M{"$set": xmgo.M{"nextAttempt": time.Now()}})
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	n, err := env.relay.RelayOnce(env.ctx)
+	if err != nil {
+		env.t.Fatalf("RelayOnce() error = %v", err)
+	}
+	return n
+}
+
+func (env *relayEnv) event(topic string) outbox.Event {
+	env.t.Helper()
+
+	var e outbox.Event
+	if err := env.events.FindWithCtx(env.ctx, xmgo.M{"topic": topic}).One(&e); err != nil {
+		env.t.Fatal(err)
+	}
+	return e
+}
+
+func (env *relayEnv) wantPublished(topics ...string) {
+	env.t.Helper()
+
+	if !reflect.DeepEqual(env.broker.published, topics) {
+		env.t.Errorf("published = %v, want %v", env.broker.published, topics)
+	}
+}
+
+func TestRelayDeliversInOrder(t *testing.T) {
+	env := newRelayEnv(t, 0, outbox.Message{Topic: "a1", Key: "a"}, outbox.Message{Topic: "b1", Key: "b"}, outbox.Message{Topic: "a2", Key: "a"})
+
+	if n := env.round(); n != 3 {
+		t.Errorf("RelayOnce() = %d, want 3", n)
+	}
+	env.wantPublished("a1", "b1", "a2")
+
+	if e := env.event("a2"); e.Status != outbox.StatusSent || e.Attempts != 1 || e.SentAt == nil {
+		t.Errorf("a2 = %+v, want sent once", e)
+	}
+}
+
+func TestRelayFailureBlocksKey(t *testing.T) {
+	env := newRelayEnv(t, 0, outbox.Message{Topic: "a1", Key: "a"}, outbox.Message{Topic: "a2", Key: "a"}, outbox.Message{Topic: "b1", Key: "b"}, outbox.Message{Topic: "x1"}, outbox.Message{Topic: "x2"})
+	env.broker.down["a1"] = true
+	env.broker.down["x1"] = true
+
+	env.round()
+	// 无分区键的事件不受其他事件失败的影响
+	env.wantPublished("a1", "b1", "x1", "x2")
+
+	a1 := env.event("a1")
+	if a1.Status != outbox.StatusPending || a1.Attempts != 1 || a1.LastError == "" {
+		t.Errorf("a1 = %+v, want pending with one failed attempt", a1)
+	}
+	if time.Until(a1.NextAttempt) < 50*time.Minute {
+		t.Errorf("a1.NextAttempt = %v, want backoff applied", a1.NextAttempt)
+	}
+
+	// a1 等待重试期间 a2 不投递
+	if n, err := env.relay.RelayOnce(env.ctx); err != nil || n != 0 {
+		t.Fatalf("RelayOnce() = %d, %v, want 0", n, err)
+	}
+	if e := env.event("a2"); e.Status != outbox.StatusPending || e.Attempts != 0 {
+		t.Errorf("a2 = %+v, want untouched", e)
+	}
+}
+
+func TestRelayFailedEventKeepsKeyBlocked(t *testing.T) {
+	env := newRelayEnv(t, 2, outbox.Message{Topic: "a1", Key: "a"}, outbox.Message{Topic: "a2", Key: "a"})
+	env.broker.down["a1"] = true
+
+	env.round()
+	env.round()
+	if e := env.event("a1"); e.Status != outbox.StatusFailed || e.Attempts != 2 {
+		t.Fatalf("a1 = %+v, want failed after 2 attempts", e)
+	}
+
+	env.round()
+	env.wantPublished("a1", "a1")
+	if e := env.event("a2"); e.Status != outbox.StatusPending {
+		t.Errorf("a2.Status = %s while a1 failed, want pending", e.Status)
+	}
+
+	// 重置失败事件后按原顺序继续投递
+	delete(env.broker.down, "a1")
+	if err := env.outbox.Retry(env.ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := env.round(); n != 2 {
+		t.Errorf("RelayOnce() after Retry = %d, want 2", n)
+	}
+	env.wantPublished("a1", "a1", "a1", "a2")
+}
+
+func TestEnqueueOutsideTransaction(t *testing.T) {
+	ctx := context.Background()
+	ob := outbox.New(memory.NewClient().Database("test"))
+
+	if err := ob.Enqueue(ctx, outbox.Message{Topic: "a"}); !errors.Is(err, xmgo.ErrNotInTransaction) {
+		t.Errorf("Enqueue() error = %v, want ErrNotInTransaction", err)
+	}
+	if n, _ := ob.Pending(ctx); n != 0 {
+		t.Errorf("Pending() = %d, want 0", n)
+	}
+}
+
+func TestEnqueueEmptyTopicRollsBack(t *testing.T) {
+	ctx := context.Background()
+	client := memory.NewClient()
+	ob := outbox.New(client.Database("test"))
+
+	_, err := client.DoTransactionWithCtx(ctx, func(sessCtx context.Context) (interface{}, error) {
+		return nil, ob.Enqueue(sessCtx, outbox.Message{Topic: "a"}, outbox.Message{})
+	})
+	if !errors.Is(err, outbox.ErrEmptyTopic) {
+		t.Fatalf("Enqueue() error = %v, want ErrEmptyTopic", err)
+	}
+	if n, _ := ob.Pending(ctx); n != 0 {
+		t.Errorf("Pending() = %d, want 0", n)
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 
 	"xtravisions.com/xmgo/hooks"
 	opts "xtravisions.com/xmgo/options"
@@ -35,6 +37,9 @@ type IQuery interface {
 	Cursor() ICursor
 	Apply(change Change, result interface{}) error
 	Hint(hint interface{}) IQuery
+	ReadPreference(rp *readpref.ReadPref) IQuery
+	ReadConcern(rc *readconcern.ReadConcern) IQuery
+	Collation(collation *options.Collation) IQuery
 }
 
 type Change struct {
@@ -55,11 +60,13 @@ type Query struct {
 	batchSize       *int64
 	arrayFilters    *options.ArrayFilters
 	noCursorTimeout *bool
+	collation       *options.Collation
 
 	ctx        context.Context
 	collection *mongo.Collection
 	opts       []opts.FindOptions
 	registry   *bsoncodec.Registry
+	exec       *executor
 }
 
 func (q *Query) Sort(fields ...string) IQuery {
@@ -129,9 +136,48 @@ func (q *Query) Limit(n int64) IQuery {
 	return newQ
 }
 
-func (q *Query) One(result interface{}) error {
+// ReadPreference 设置查询的读策略，如 readpref.SecondaryPreferred()、readpref.Nearest(readpref.WithTags(...))
+func (q *Query) ReadPreference(rp *readpref.ReadPref) IQuery {
+	return q.clone(options.Collection().SetReadPreference(rp))
+}
+
+// ReadConcern 设置查询的读关注，如 readconcern.Majority()
+func (q *Query) ReadConcern(rc *readconcern.ReadConcern) IQuery {
+	return q.clone(options.Collection().SetReadConcern(rc))
+}
+
+// Collation 设置查询的排序规则
+func (q *Query) Collation(collation *options.Collation) IQuery {
+	newQ := q
+	newQ.collation = collation
+
+	return newQ
+}
+
+// clone 按参数克隆查询使用的 collection，克隆失败时查询返回克隆错误
+func (q *Query) clone(o *options.CollectionOptions) IQuery {
+	newQ := q
+	c, err := q.collection.Clone(o)
+	if err != nil {
+		newQ.exec = q.exec.withErr(err)
+	} else {
+		newQ.collection = c
+	}
+
+	return newQ
+}
+
+func (q *Query) One(result interface{}) (err error) {
+	defer q.wrapErr(&err, "find.one")
+
+	ctx, cancel, err := q.exec.prepare(q.ctx, opRead)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	if len(q.opts) > 0 {
-		if err := hooks.On(q.ctx, q.opts[0].QueryHook, hooks.BeforeQuery); err != nil {
+		if err := hooks.On(ctx, q.opts[0].QueryHook, hooks.BeforeQuery); err != nil {
 			return err
 		}
 	}
@@ -149,15 +195,19 @@ func (q *Query) One(result interface{}) error {
 	if q.hint != nil {
 		opt.SetHint(q.hint)
 	}
+	if q.collation != nil {
+		opt.SetCollation(q.collation)
+	}
 
-	err := q.collection.FindOne(q.ctx, q.filter, opt).Decode(result)
-
+	err = q.exec.do(ctx, true, func() error {
+		return q.collection.FindOne(ctx, q.filter, opt).Decode(result)
+	})
 	if err != nil {
 		return err
 	}
 
 	if len(q.opts) > 0 {
-		if err := hooks.On(q.ctx, q.opts[0].QueryHook, hooks.AfterQuery); err != nil {
+		if err := hooks.On(ctx, q.opts[0].QueryHook, hooks.AfterQuery); err != nil {
 			return err
 		}
 	}
@@ -165,9 +215,17 @@ func (q *Query) One(result interface{}) error {
 	return nil
 }
 
-func (q *Query) All(result interface{}) error {
+func (q *Query) All(result interface{}) (err error) {
+	defer q.wrapErr(&err, "find.all")
+
+	ctx, cancel, err := q.exec.prepare(q.ctx, opRead)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	if len(q.opts) > 0 {
-		if err := hooks.On(q.ctx, q.opts[0].QueryHook, hooks.BeforeQuery); err != nil {
+		if err := hooks.On(ctx, q.opts[0].QueryHook, hooks.BeforeQuery); err != nil {
 			return err
 		}
 	}
@@ -194,23 +252,25 @@ func (q *Query) All(result interface{}) error {
 	if q.noCursorTimeout != nil {
 		opt.SetNoCursorTimeout(*q.noCursorTimeout)
 	}
+	if q.collation != nil {
+		opt.SetCollation(q.collation)
+	}
 
-	var err error
-	var cursor *mongo.Cursor
-
-	cursor, err = q.collection.Find(q.ctx, q.filter, opt)
+	err = q.exec.do(ctx, true, func() error {
+		cursor, err := q.collection.Find(ctx, q.filter, opt)
 
-	c := Cursor{
-		ctx:    q.ctx,
-		cursor: cursor,
-		err:    err,
-	}
-	err = c.All(result)
+		c := Cursor{
+			ctx:    ctx,
+			cursor: cursor,
+			err:    err,
+		}
+		return c.All(result)
+	})
 	if err != nil {
 		return err
 	}
 	if len(q.opts) > 0 {
-		if err := hooks.On(q.ctx, q.opts[0].QueryHook, hooks.AfterQuery); err != nil {
+		if err := hooks.On(ctx, q.opts[0].QueryHook, hooks.AfterQuery); err != nil {
 			return err
 		}
 	}
@@ -218,6 +278,14 @@ func (q *Query) All(result interface{}) error {
 }
 
 func (q *Query) Count() (n int64, err error) {
+	defer q.wrapErr(&err, "find.count")
+
+	ctx, cancel, err := q.exec.prepare(q.ctx, opRead)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	opt := options.Count()
 
 	if q.limit != nil {
@@ -226,12 +294,33 @@ func (q *Query) Count() (n int64, err error) {
 	if q.skip != nil {
 		opt.SetSkip(*q.skip)
 	}
+	if q.collation != nil {
+		opt.SetCollation(q.collation)
+	}
+
+	err = q.exec.do(ctx, true, func() (err error) {
+		n, err = q.collection.CountDocuments(ctx, q.filter, opt)
+		return
+	})
 
-	return q.collection.CountDocuments(q.ctx, q.filter, opt)
+	return
 }
 
 func (q *Query) EstimatedCount() (n int64, err error) {
-	return q.collection.EstimatedDocumentCount(q.ctx)
+	defer q.wrapErr(&err, "find.estimatedCount")
+
+	ctx, cancel, err := q.exec.prepare(q.ctx, opRead)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	err = q.exec.do(ctx, true, func() (err error) {
+		n, err = q.collection.EstimatedDocumentCount(ctx)
+		return
+	})
+
+	return
 }
 
 func (q *Query) Exists() (b bool, err error) {
@@ -245,7 +334,15 @@ func (q *Query) Exists() (b bool, err error) {
 	return
 }
 
-func (q *Query) Distinct(key string, result interface{}) error {
+func (q *Query) Distinct(key string, result interface{}) (err error) {
+	defer q.wrapErr(&err, "find.distinct")
+
+	ctx, cancel, err := q.exec.prepare(q.ctx, opRead)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
 	resultVal := reflect.ValueOf(result)
 
 	if resultVal.Kind() != reflect.Ptr {
@@ -258,7 +355,14 @@ func (q *Query) Distinct(key string, result interface{}) error {
 	}
 
 	opt := options.Distinct()
-	res, err := q.collection.Distinct(q.ctx, key, q.filter, opt)
+	if q.collation != nil {
+		opt.SetCollation(q.collation)
+	}
+	var res []interface{}
+	err = q.exec.do(ctx, true, func() (err error) {
+		res, err = q.collection.Distinct(ctx, key, q.filter, opt)
+		return
+	})
 	if err != nil {
 		return err
 	}
@@ -303,33 +407,57 @@ func (q *Query) Cursor() ICursor {
 	if q.noCursorTimeout != nil {
 		opt.SetNoCursorTimeout(*q.noCursorTimeout)
 	}
+	if q.collation != nil {
+		opt.SetCollation(q.collation)
+	}
+
+	ctx, cancel, err := q.exec.prepare(q.ctx, opRead)
 
-	var err error
 	var cur *mongo.Cursor
-	cur, err = q.collection.Find(q.ctx, q.filter, opt)
+	if err == nil {
+		err = q.exec.do(ctx, true, func() (err error) {
+			cur, err = q.collection.Find(ctx, q.filter, opt)
+			return
+		})
+	}
+	q.wrapErr(&err, "find.cursor")
+	if err != nil {
+		cancel()
+	}
 
 	return &Cursor{
-		ctx:    q.ctx,
+		ctx:    ctx,
 		cursor: cur,
 		err:    err,
+		cancel: cancel,
 	}
 }
 
-func (q *Query) Apply(change Change, result interface{}) error {
-	var err error
+func (q *Query) Apply(change Change, result interface{}) (err error) {
+	defer q.wrapErr(&err, "find.apply")
 
-	if change.Remove {
-		err = q.findOneAndDelete(change, result)
-	} else if change.Replace {
-		err = q.findOneAndReplace(change, result)
-	} else {
-		err = q.findOneAndUpdate(change, result)
-	}
+	ctx, cancel, err := q.exec.prepare(q.ctx, opWrite)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	// 仅按 _id 匹配且返回修改后文档的替换或幂等更新可安全重试
+	idempotent := !change.Remove && change.ReturnNew && idFilter(q.filter) &&
+		(change.Replace || idempotentUpdate(change.Update))
+	err = q.exec.do(ctx, idempotent, func() error {
+		if change.Remove {
+			return q.findOneAndDelete(ctx, change, result)
+		} else if change.Replace {
+			return q.findOneAndReplace(ctx, change, result)
+		}
+		return q.findOneAndUpdate(ctx, change, result)
+	})
 
-	return err
+	return WrapWriteError(err, nil, nil)
 }
 
-func (q *Query) findOneAndDelete(_ Change, result interface{}) error {
+func (q *Query) findOneAndDelete(ctx context.Context, _ Change, result interface{}) error {
 	opt := options.FindOneAndDelete()
 	if q.sort != nil {
 		opt.SetSort(q.sort)
@@ -337,11 +465,14 @@ func (q *Query) findOneAndDelete(_ Change, result interface{}) error {
 	if q.project != nil {
 		opt.SetProjection(q.project)
 	}
+	if q.collation != nil {
+		opt.SetCollation(q.collation)
+	}
 
-	return q.collection.FindOneAndDelete(q.ctx, q.filter, opt).Decode(result)
+	return q.collection.FindOneAndDelete(ctx, q.filter, opt).Decode(result)
 }
 
-func (q *Query) findOneAndReplace(change Change, result interface{}) error {
+func (q *Query) findOneAndReplace(ctx context.Context, change Change, result interface{}) error {
 	opt := options.FindOneAndReplace()
 	if q.sort != nil {
 		opt.SetSort(q.sort)
@@ -349,6 +480,9 @@ func (q *Query) findOneAndReplace(change Change, result interface{}) error {
 	if q.project != nil {
 		opt.SetProjection(q.project)
 	}
+	if q.collation != nil {
+		opt.SetCollation(q.collation)
+	}
 	if change.Upsert {
 		opt.SetUpsert(change.Upsert)
 	}
@@ -356,7 +490,7 @@ func (q *Query) findOneAndReplace(change Change, result interface{}) error {
 		opt.SetReturnDocument(options.After)
 	}
 
-	err := q.collection.FindOneAndReplace(q.ctx, q.filter, change.Update, opt).Decode(result)
+	err := q.collection.FindOneAndReplace(ctx, q.filter, change.Update, opt).Decode(result)
 	if change.Upsert && !change.ReturnNew && err == mongo.ErrNoDocuments {
 		return nil
 	}
@@ -364,7 +498,7 @@ func (q *Query) findOneAndReplace(change Change, result interface{}) error {
 	return err
 }
 
-func (q *Query) findOneAndUpdate(change Change, result interface{}) error {
+func (q *Query) findOneAndUpdate(ctx context.Context, change Change, result interface{}) error {
 	opt := options.FindOneAndUpdate()
 	if q.sort != nil {
 		opt.SetSort(q.sort)
@@ -372,6 +506,9 @@ func (q *Query) findOneAndUpdate(change Change, result interface{}) error {
 	if q.project != nil {
 		opt.SetProjection(q.project)
 	}
+	if q.collation != nil {
+		opt.SetCollation(q.collation)
+	}
 	if change.Upsert {
 		opt.SetUpsert(change.Upsert)
 	}
@@ -382,10 +519,15 @@ func (q *Query) findOneAndUpdate(change Change, result interface{}) error {
 		opt.SetArrayFilters(*q.arrayFilters)
 	}
 
-	err := q.collection.FindOneAndUpdate(q.ctx, q.filter, change.Update, opt).Decode(result)
+	err := q.collection.FindOneAndUpdate(ctx, q.filter, change.Update, opt).Decode(result)
 	if change.Upsert && !change.ReturnNew && err == mongo.ErrNoDocuments {
 		return nil
 	}
 
 	return err
 }
+
+// wrapErr 为查询的错误附加操作信息，配合 defer 使用
+func (q *Query) wrapErr(err *error, op string) {
+	*err = NewOpError(q.collection.Database().Name(), q.collection.Name(), op, q.filter, *err)
+}
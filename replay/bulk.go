@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package replay
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"xtravisions.com/xmgo"
+)
+
+var _ xmgo.IBulk = (*Bulk)(nil)
+
+// Bulk 录制或回放的批量写操作，实现 xmgo.IBulk
+type Bulk struct {
+	collection *Collection
+
+	models  bson.A
+	queue   []func(b xmgo.IBulk)
+	ordered *bool
+}
+
+func (b *Bulk) add(op string, model bson.D, fn func(b xmgo.IBulk)) xmgo.IBulk {
+	b.models = append(b.models, append(bson.D{{Key: "op", Value: op}}, model...))
+	b.queue = append(b.queue, fn)
+	return b
+}
+
+func (b *Bulk) SetOrdered(ordered bool) xmgo.IBulk {
+	b.ordered = &ordered
+	return b
+}
+
+func (b *Bulk) InsertOne(doc interface{}) xmgo.IBulk {
+	return b.add("insertOne", bson.D{{Key: "document", Value: doc}}, func(b xmgo.IBulk) {
+		b.InsertOne(doc)
+	})
+}
+
+func (b *Bulk) Remove(filter interface{}) xmgo.IBulk {
+	return b.add("remove", bson.D{{Key: "filter", Value: filter}}, func(b xmgo.IBulk) {
+		b.Remove(filter)
+	})
+}
+
+func (b *Bulk) RemoveId(id interface{}) xmgo.IBulk {
+	return b.add("removeId", bson.D{{Key: "id", Value: id}}, func(b xmgo.IBulk) {
+		b.RemoveId(id)
+	})
+}
+
+func (b *Bulk) RemoveAll(filter interface{}) xmgo.IBulk {
+	return b.add("removeAll", bson.D{{Key: "filter", Value: filter}}, func(b xmgo.IBulk) {
+		b.RemoveAll(filter)
+	})
+}
+
+func (b *Bulk) Upsert(filter interface{}, replacement interface{}) xmgo.IBulk {
+	return b.add("upsert", bson.D{{Key: "filter", Value: filter}, {Key: "replacement", Value: replacement}}, func(b xmgo.IBulk) {
+		b.Upsert(filter, replacement)
+	})
+}
+
+func (b *Bulk) UpsertOne(filter interface{}, update interface{}) xmgo.IBulk {
+	return b.add("upsertOne", bson.D{{Key: "filter", Value: filter}, {Key: "update", Value: update}}, func(b xmgo.IBulk) {
+		b.UpsertOne(filter, update)
+	})
+}
+
+func (b *Bulk) UpsertId(id interface{}, replacement interface{}) xmgo.IBulk {
+	return b.add("upsertId", bson.D{{Key: "id", Value: id}, {Key: "replacement", Value: replacement}}, func(b xmgo.IBulk) {
+		b.UpsertId(id, replacement)
+	})
+}
+
+func (b *Bulk) UpdateOne(filter interface{}, update interface{}) xmgo.IBulk {
+	return b.add("updateOne", bson.D{{Key: "filter", Value: filter}, {Key: "update", Value: update}}, func(b xmgo.IBulk) {
+		b.UpdateOne(filter, update)
+	})
+}
+
+func (b *Bulk) UpdateId(id interface{}, update interface{}) xmgo.IBulk {
+	return b.add("updateId", bson.D{{Key: "id", Value: id}, {Key: "update", Value: update}}, func(b xmgo.IBulk) {
+		b.UpdateId(id, update)
+	})
+}
+
+func (b *Bulk) UpdateAll(filter interface{}, update interface{}) xmgo.IBulk {
+	return b.add("updateAll", bson.D{{Key: "filter", Value: filter}, {Key: "update", Value: update}}, func(b xmgo.IBulk) {
+		b.UpdateAll(filter, update)
+	})
+}
+
+func (b *Bulk) Run() (*xmgo.BulkResult, error) {
+	return b.RunWithCtx(context.TODO())
+}
+
+func (b *Bulk) RunWithCtx(ctx context.Context) (*xmgo.BulkResult, error) {
+	request := bson.D{{Key: "models", Value: b.models}}
+	if b.ordered != nil {
+		request = append(request, bson.E{Key: "ordered", Value: *b.ordered})
+	}
+
+	v, err := b.collection.do("bulk", request, func() (interface{}, error) {
+		inner := b.collection.inner.Bulk()
+		if b.ordered != nil {
+			inner.SetOrdered(*b.ordered)
+		}
+		for _, fn := range b.queue {
+			fn(inner)
+		}
+		return inner.RunWithCtx(ctx)
+	})
+	if err != nil {
+		// In original mgo, queue is not reset in case of error.
+		return nil, err
+	}
+
+	// Empty the queue for possible reuse, as per mgo's behavior.
+	b.models, b.queue = nil, nil
+
+	result := &xmgo.BulkResult{}
+	return result, decode(v, result)
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+// Package replay 录制及回放 xmgo 操作的测试工具
+//
+//	录制模式包装真实的 xmgo.ICollection，将请求及响应以 Extended JSON 格式保存到 golden 文件；
+//	回放模式按录制顺序返回保存的响应，操作或请求不一致时返回错误，使 CI 无需连接 mongod
+package replay
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Interaction 单次操作的请求及响应
+type Interaction struct {
+	Collection string         `bson:"collection"`
+	Op         string         `bson:"op"`
+	Request    bson.Raw       `bson:"request"`
+	Response   *bson.RawValue `bson:"response,omitempty"`
+	Error      *Error         `bson:"error,omitempty"`
+}
+
+// Cassette 按顺序保存的操作记录
+type Cassette struct {
+	mu           sync.Mutex
+	Interactions []*Interaction `bson:"interactions"`
+
+	pos int
+	err error
+}
+
+// NewCassette 创建用于录制的空记录
+func NewCassette() *Cassette {
+	return &Cassette{}
+}
+
+// Load 从 golden 文件加载记录
+//
+//	@param path golden 文件路径
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cassette{}
+	if err = bson.UnmarshalExtJSON(data, true, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// Save 以 canonical Extended JSON 格式保存记录到 golden 文件，目录不存在时自动创建
+//
+//	@param path golden 文件路径
+func (c *Cassette) Save(path string) error {
+	c.mu.Lock()
+	data, err := bson.MarshalExtJSONIndent(c, true, false, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Done 检查回放是否完成
+//
+//	返回回放过程中的第一个错误，或存在未回放的记录时返回 ErrInteractionsRemaining
+func (c *Cassette) Done() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	if c.pos < len(c.Interactions) {
+		it := c.Interactions[c.pos]
+		return fmt.Errorf("%w: %d left, next %s on %s", ErrInteractionsRemaining, len(c.Interactions)-c.pos, it.Op, it.Collection)
+	}
+
+	return nil
+}
+
+func (c *Cassette) append(it *Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Interactions = append(c.Interactions, it)
+}
+
+// next 获取下一条记录并校验操作及请求
+func (c *Cassette) next(coll, op string, request bson.Raw) (*Interaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.check(coll, op, request)
+	if err != nil {
+		if c.err == nil {
+			c.err = err
+		}
+		return nil, err
+	}
+
+	it := c.Interactions[c.pos]
+	c.pos++
+
+	return it, nil
+}
+
+func (c *Cassette) check(coll, op string, request bson.Raw) error {
+	if c.pos >= len(c.Interactions) {
+		return fmt.Errorf("%w: %s on %s, all %d interactions replayed", ErrUnexpectedOperation, op, coll, len(c.Interactions))
+	}
+
+	it := c.Interactions[c.pos]
+	if it.Op != op || it.Collection != coll {
+		return fmt.Errorf("%w: interaction %d want %s on %s, got %s on %s", ErrUnexpectedOperation, c.pos, it.Op, it.Collection, op, coll)
+	}
+
+	if !equalValue(rawDoc(it.Request), rawDoc(request)) {
+		return fmt.Errorf("%w: interaction %d %s on %s\n  want: %s\n  got:  %s", ErrRequestMismatch, c.pos, op, coll, extJSON(it.Request), extJSON(request))
+	}
+
+	return nil
+}
+
+func rawDoc(doc bson.Raw) bson.RawValue {
+	return bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: doc}
+}
+
+// equalValue 比较两个值，文档字段忽略顺序
+func equalValue(a, b bson.RawValue) bool {
+	if a.Type != b.Type {
+		return false
+	}
+
+	switch a.Type {
+	case bson.TypeEmbeddedDocument:
+		ae, err := a.Document().Elements()
+		if err != nil {
+			return false
+		}
+		be, err := b.Document().Elements()
+		if err != nil || len(ae) != len(be) {
+			return false
+		}
+		for _, e := range ae {
+			v, err := b.Document().LookupErr(e.Key())
+			if err != nil || !equalValue(e.Value(), v) {
+				return false
+			}
+		}
+		return true
+	case bson.TypeArray:
+		av, err := a.Array().Values()
+		if err != nil {
+			return false
+		}
+		bv, err := b.Array().Values()
+		if err != nil || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !equalValue(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a.Equal(b)
+	}
+}
+
+func extJSON(doc bson.Raw) string {
+	data, err := bson.MarshalExtJSON(doc, true, false)
+	if err != nil {
+		return doc.String()
+	}
+
+	return string(data)
+}
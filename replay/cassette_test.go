@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package replay
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func mustRaw(t *testing.T, v interface{}) bson.Raw {
+	t.Helper()
+
+	data, err := bson.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestEqualValueIgnoresFieldOrder(t *testing.T) {
+	a := mustRaw(t, bson.D{{Key: "a", Value: 1}, {Key: "f", Value: bson.D{{Key: "x", Value: 1}, {Key: "y", Value: 2}}}})
+	b := mustRaw(t, bson.D{{Key: "f", Value: bson.D{{Key: "y", Value: 2}, {Key: "x", Value: 1}}}, {Key: "a", Value: 1}})
+	if !equalValue(rawDoc(a), rawDoc(b)) {
+		t.Errorf("equalValue(%s, %s) = false, want true", a, b)
+	}
+
+	for _, other := range []bson.D{
+		{{Key: "a", Value: int64(1)}, {Key: "f", Value: bson.D{{Key: "x", Value: 1}, {Key: "y", Value: 2}}}},
+		{{Key: "a", Value: 1}, {Key: "f", Value: bson.D{{Key: "x", Value: 1}}}},
+		{{Key: "a", Value: 1}, {Key: "g", Value: bson.D{{Key: "x", Value: 1}, {Key: "y", Value: 2}}}},
+	} {
+		if c := mustRaw(t, other); equalValue(rawDoc(a), rawDoc(c)) {
+			t.Errorf("equalValue(%s, %s) = true, want false", a, c)
+		}
+	}
+
+	arr := mustRaw(t, bson.D{{Key: "a", Value: bson.A{1, 2}}})
+	rev := mustRaw(t, bson.D{{Key: "a", Value: bson.A{2, 1}}})
+	if equalValue(rawDoc(arr), rawDoc(rev)) {
+		t.Error("equalValue() ignored array order")
+	}
+}
+
+func newTestCassette(t *testing.T) *Cassette {
+	return &Cassette{Interactions: []*Interaction{
+		{Collection: "users", Op: "find", Request: mustRaw(t, bson.D{{Key: "filter", Value: bson.D{{Key: "name", Value: "alice"}}}})},
+		{Collection: "users", Op: "insertOne", Request: mustRaw(t, bson.D{{Key: "doc", Value: bson.D{{Key: "_id", Value: 1}}}})},
+	}}
+}
+
+func TestCassetteReplayInOrder(t *testing.T) {
+	c := newTestCassette(t)
+
+	if _, err := c.next("users", "find", mustRaw(t, bson.D{{Key: "filter", Value: bson.D{{Key: "name", Value: "alice"}}}})); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Done(); !errors.Is(err, ErrInteractionsRemaining) {
+		t.Errorf("Done() after one interaction = %v, want ErrInteractionsRemaining", err)
+	}
+
+	it, err := c.next("users", "insertOne", mustRaw(t, bson.D{{Key: "doc", Value: bson.D{{Key: "_id", Value: 1}}}}))
+	if err != nil || it.Op != "insertOne" {
+		t.Fatalf("next() = %v, %v", it, err)
+	}
+	if err = c.Done(); err != nil {
+		t.Errorf("Done() = %v", err)
+	}
+
+	if _, err = c.next("users", "find", mustRaw(t, bson.D{})); !errors.Is(err, ErrUnexpectedOperation) {
+		t.Errorf("next() past the end = %v, want ErrUnexpectedOperation", err)
+	}
+}
+
+func TestCassetteMismatch(t *testing.T) {
+	c := newTestCassette(t)
+	if _, err := c.next("orders", "find", mustRaw(t, bson.D{})); !errors.Is(err, ErrUnexpectedOperation) {
+		t.Errorf("next() on another collection = %v, want ErrUnexpectedOperation", err)
+	}
+
+	c = newTestCassette(t)
+	_, err := c.next("users", "find", mustRaw(t, bson.D{{Key: "filter", Value: bson.D{{Key: "name", Value: "bob"}}}}))
+	if !errors.Is(err, ErrRequestMismatch) {
+		t.Fatalf("next() with another filter = %v, want ErrRequestMismatch", err)
+	}
+
+	// Done 返回回放过程中的第一个错误，即使之后的操作匹配
+	_, _ = c.next("users", "find", mustRaw(t, bson.D{{Key: "filter", Value: bson.D{{Key: "name", Value: "alice"}}}}))
+	if err = c.Done(); !errors.Is(err, ErrRequestMismatch) {
+		t.Errorf("Done() = %v, want ErrRequestMismatch", err)
+	}
+}
+
+func TestCassetteSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden", "users.json")
+	response := bson.RawValue{Type: bson.TypeInt32, Value: []byte{3, 0, 0, 0}}
+	request := mustRaw(t, bson.D{{Key: "filter", Value: bson.D{}}})
+
+	c := NewCassette()
+	c.append(&Interaction{Collection: "users", Op: "count", Request: request, Response: &response})
+	if err := c.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it, err := loaded.next("users", "count", request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it.Response == nil || !it.Response.Equal(response) {
+		t.Errorf("Response = %v, want %v", it.Response, response)
+	}
+}
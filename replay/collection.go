@@ -0,0 +1,519 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package replay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"xtravisions.com/xmgo"
+	opts "xtravisions.com/xmgo/options"
+)
+
+var _ xmgo.ICollection = (*Collection)(nil)
+
+// Collection 录制或回放操作的 collection，实现 xmgo.ICollection
+//
+//	回放模式不执行钩子，请求按录制时传入的原始参数比较，文档字段顺序不影响比较结果
+type Collection struct {
+	name     string
+	cassette *Cassette
+	inner    xmgo.ICollection
+}
+
+// Record 包装 collection，执行操作的同时录制请求及响应
+//
+//	@param cassette 录制记录，多个 collection 可共用以保持操作顺序
+//	@param coll 真实的 collection
+func Record(cassette *Cassette, coll xmgo.ICollection) xmgo.ICollection {
+	return &Collection{name: coll.Name(), cassette: cassette, inner: coll}
+}
+
+// Replay 创建按录制记录返回响应的 collection
+//
+//	@param cassette 由 Load 加载的录制记录
+//	@param name collection 名称
+func Replay(cassette *Cassette, name string) xmgo.ICollection {
+	return &Collection{name: name, cassette: cassette}
+}
+
+// do 录制模式下执行 fn 并保存请求及响应，回放模式下校验请求并返回录制的响应
+func (c *Collection) do(op string, request bson.D, fn func() (interface{}, error)) (bson.RawValue, error) {
+	req, err := bson.Marshal(request)
+	if err != nil {
+		return bson.RawValue{}, err
+	}
+
+	if c.inner == nil {
+		it, err := c.cassette.next(c.name, op, req)
+		if err != nil {
+			return bson.RawValue{}, err
+		}
+		if it.Error != nil {
+			return bson.RawValue{}, it.Error.Err()
+		}
+		if it.Response == nil {
+			return bson.RawValue{}, nil
+		}
+		return *it.Response, nil
+	}
+
+	it := &Interaction{Collection: c.name, Op: op, Request: req}
+	res, opErr := fn()
+	if opErr != nil {
+		it.Error = encodeError(opErr)
+		c.cassette.append(it)
+		return bson.RawValue{}, opErr
+	}
+
+	if res != nil {
+		doc, err := bson.Marshal(bson.D{{Key: "v", Value: res}})
+		if err != nil {
+			return bson.RawValue{}, err
+		}
+		v := bson.Raw(doc).Lookup("v")
+		it.Response = &v
+	}
+	c.cassette.append(it)
+
+	if it.Response == nil {
+		return bson.RawValue{}, nil
+	}
+	return *it.Response, nil
+}
+
+// decode 解析录制的响应，响应为空时忽略
+func decode(v bson.RawValue, result interface{}) error {
+	if v.Type == 0 || v.Type == bson.TypeNull {
+		return nil
+	}
+
+	return v.Unmarshal(result)
+}
+
+// withOptions 附加驱动配置到请求，配置为空时忽略
+func withOptions(request bson.D, o interface{}) bson.D {
+	if rv := reflect.ValueOf(o); !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return request
+	}
+
+	return append(request, bson.E{Key: "options", Value: o})
+}
+
+// withReadOptions 将读策略及读关注加入请求
+func withReadOptions(request bson.D, rp *readpref.ReadPref, rc *readconcern.ReadConcern) bson.D {
+	if rp != nil {
+		request = append(request, bson.E{Key: "readPreference", Value: rp.Mode().String()})
+	}
+	if rc != nil {
+		request = append(request, bson.E{Key: "readConcern", Value: rc.GetLevel()})
+	}
+
+	return request
+}
+
+func (c *Collection) Name() string {
+	return c.name
+}
+
+// Clone 克隆 collection，录制模式下同时克隆真实的 collection，读写参数不参与请求比较
+func (c *Collection) Clone(o ...*opts.CollectionOptions) xmgo.ICollection {
+	res := &Collection{name: c.name, cassette: c.cassette}
+	if c.inner != nil {
+		res.inner = c.inner.Clone(o...)
+	}
+
+	return res
+}
+
+func (c *Collection) Drop() error {
+	_, err := c.do("drop", bson.D{}, func() (interface{}, error) {
+		return nil, c.inner.Drop()
+	})
+
+	return err
+}
+
+// Watch 不支持录制 change stream
+func (c *Collection) Watch(pipeline interface{}, opts ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return c.WatchWithCtx(context.TODO(), pipeline, opts...)
+}
+
+// WatchWithCtx 不支持录制 change stream
+func (c *Collection) WatchWithCtx(_ context.Context, _ interface{}, _ ...*opts.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return nil, ErrNotSupported
+}
+
+func (c *Collection) Aggregate(pipeline interface{}, opts ...opts.AggregateOptions) xmgo.IAggregate {
+	return c.AggregateWithCtx(context.TODO(), pipeline, opts...)
+}
+
+func (c *Collection) AggregateWithCtx(ctx context.Context, pipeline interface{}, opts ...opts.AggregateOptions) xmgo.IAggregate {
+	return &Aggregate{ctx: ctx, collection: c, pipeline: pipeline, opts: opts}
+}
+
+func (c *Collection) Find(filter interface{}, opts ...opts.FindOptions) xmgo.IQuery {
+	return c.FindWithCtx(context.TODO(), filter, opts...)
+}
+
+func (c *Collection) FindWithCtx(ctx context.Context, filter interface{}, opts ...opts.FindOptions) xmgo.IQuery {
+	return &Query{ctx: ctx, collection: c, filter: filter, opts: opts}
+}
+
+func (c *Collection) InsertOne(doc interface{}, opts ...opts.InsertOneOptions) (*xmgo.InsertOneResult, error) {
+	return c.InsertOneWithCtx(context.TODO(), doc, opts...)
+}
+
+func (c *Collection) InsertOneWithCtx(ctx context.Context, doc interface{}, opts ...opts.InsertOneOptions) (*xmgo.InsertOneResult, error) {
+	request := bson.D{{Key: "document", Value: doc}}
+	if len(opts) > 0 {
+		request = withOptions(request, opts[0].InsertOneOptions)
+	}
+
+	v, err := c.do("insertOne", request, func() (interface{}, error) {
+		return c.inner.InsertOneWithCtx(ctx, doc, opts...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &xmgo.InsertOneResult{}
+	return result, decode(v, result)
+}
+
+func (c *Collection) InsertMany(docs interface{}, opts ...opts.InsertManyOptions) (*xmgo.InsertManyResult, error) {
+	return c.InsertManyWithCtx(context.TODO(), docs, opts...)
+}
+
+func (c *Collection) InsertManyWithCtx(ctx context.Context, docs interface{}, opts ...opts.InsertManyOptions) (*xmgo.InsertManyResult, error) {
+	request := bson.D{{Key: "documents", Value: docs}}
+	if len(opts) > 0 {
+		request = withOptions(request, opts[0].InsertManyOptions)
+	}
+
+	v, err := c.do("insertMany", request, func() (interface{}, error) {
+		return c.inner.InsertManyWithCtx(ctx, docs, opts...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &xmgo.InsertManyResult{}
+	return result, decode(v, result)
+}
+
+func (c *Collection) UpdateById(id interface{}, update interface{}, opts ...opts.UpdateOptions) error {
+	return c.UpdateByIdWithCtx(context.TODO(), id, update, opts...)
+}
+
+func (c *Collection) UpdateByIdWithCtx(ctx context.Context, id interface{}, update interface{}, opts ...opts.UpdateOptions) error {
+	return c.update("updateById", bson.D{{Key: "id", Value: id}}, update, opts, func() (interface{}, error) {
+		return nil, c.inner.UpdateByIdWithCtx(ctx, id, update, opts...)
+	})
+}
+
+func (c *Collection) UpdateOne(filter interface{}, update interface{}, opts ...opts.UpdateOptions) error {
+	return c.UpdateOneWithCtx(context.TODO(), filter, update, opts...)
+}
+
+func (c *Collection) UpdateOneWithCtx(ctx context.Context, filter interface{}, update interface{}, opts ...opts.UpdateOptions) error {
+	return c.update("updateOne", bson.D{{Key: "filter", Value: filter}}, update, opts, func() (interface{}, error) {
+		return nil, c.inner.UpdateOneWithCtx(ctx, filter, update, opts...)
+	})
+}
+
+func (c *Collection) UpdateAll(filter interface{}, update interface{}, opts ...opts.UpdateOptions) (*xmgo.UpdateResult, error) {
+	return c.UpdateAllWithCtx(context.TODO(), filter, update, opts...)
+}
+
+func (c *Collection) UpdateAllWithCtx(ctx context.Context, filter interface{}, update interface{}, opts ...opts.UpdateOptions) (*xmgo.UpdateResult, error) {
+	result := &xmgo.UpdateResult{}
+	err := c.update("updateAll", bson.D{{Key: "filter", Value: filter}}, update, opts, func() (interface{}, error) {
+		return c.inner.UpdateAllWithCtx(ctx, filter, update, opts...)
+	}, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (c *Collection) update(op string, request bson.D, update interface{}, o []opts.UpdateOptions, fn func() (interface{}, error), result ...interface{}) error {
+	request = append(request, bson.E{Key: "update", Value: update})
+	if len(o) > 0 {
+		request = withOptions(request, o[0].UpdateOptions)
+	}
+
+	v, err := c.do(op, request, fn)
+	if err != nil || len(result) == 0 {
+		return err
+	}
+
+	return decode(v, result[0])
+}
+
+func (c *Collection) Upsert(filter interface{}, replacement interface{}, opts ...opts.UpsertOptions) (*xmgo.UpdateResult, error) {
+	return c.UpsertWithCtx(context.TODO(), filter, replacement, opts...)
+}
+
+func (c *Collection) UpsertWithCtx(ctx context.Context, filter interface{}, replacement interface{}, opts ...opts.UpsertOptions) (*xmgo.UpdateResult, error) {
+	return c.upsert("upsert", bson.D{{Key: "filter", Value: filter}}, replacement, opts, func() (interface{}, error) {
+		return c.inner.UpsertWithCtx(ctx, filter, replacement, opts...)
+	})
+}
+
+func (c *Collection) UpsertById(id interface{}, replacement interface{}, opts ...opts.UpsertOptions) (*xmgo.UpdateResult, error) {
+	return c.UpsertByIdWithCtx(context.TODO(), id, replacement, opts...)
+}
+
+func (c *Collection) UpsertByIdWithCtx(ctx context.Context, id interface{}, replacement interface{}, opts ...opts.UpsertOptions) (*xmgo.UpdateResult, error) {
+	return c.upsert("upsertById", bson.D{{Key: "id", Value: id}}, replacement, opts, func() (interface{}, error) {
+		return c.inner.UpsertByIdWithCtx(ctx, id, replacement, opts...)
+	})
+}
+
+func (c *Collection) upsert(op string, request bson.D, replacement interface{}, o []opts.UpsertOptions, fn func() (interface{}, error)) (*xmgo.UpdateResult, error) {
+	request = append(request, bson.E{Key: "replacement", Value: replacement})
+	if len(o) > 0 {
+		request = withOptions(request, o[0].ReplaceOptions)
+	}
+
+	v, err := c.do(op, request, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &xmgo.UpdateResult{}
+	return result, decode(v, result)
+}
+
+func (c *Collection) ReplaceOne(filter interface{}, doc interface{}, opts ...opts.ReplaceOptions) error {
+	return c.ReplaceOneWithCtx(context.TODO(), filter, doc, opts...)
+}
+
+func (c *Collection) ReplaceOneWithCtx(ctx context.Context, filter interface{}, doc interface{}, opts ...opts.ReplaceOptions) error {
+	request := bson.D{{Key: "filter", Value: filter}, {Key: "replacement", Value: doc}}
+	if len(opts) > 0 {
+		request = withOptions(request, opts[0].ReplaceOptions)
+	}
+
+	_, err := c.do("replaceOne", request, func() (interface{}, error) {
+		return nil, c.inner.ReplaceOneWithCtx(ctx, filter, doc, opts...)
+	})
+
+	return err
+}
+
+func (c *Collection) Remove(filter interface{}, opts ...opts.RemoveOptions) error {
+	return c.RemoveWithCtx(context.TODO(), filter, opts...)
+}
+
+func (c *Collection) RemoveWithCtx(ctx context.Context, filter interface{}, opts ...opts.RemoveOptions) error {
+	request := bson.D{{Key: "filter", Value: filter}}
+	if len(opts) > 0 {
+		request = withOptions(request, opts[0].DeleteOptions)
+	}
+
+	_, err := c.do("remove", request, func() (interface{}, error) {
+		return nil, c.inner.RemoveWithCtx(ctx, filter, opts...)
+	})
+
+	return err
+}
+
+func (c *Collection) RemoveById(id interface{}, opts ...opts.RemoveOptions) error {
+	return c.RemoveByIdWithCtx(context.TODO(), id, opts...)
+}
+
+func (c *Collection) RemoveByIdWithCtx(ctx context.Context, id interface{}, opts ...opts.RemoveOptions) error {
+	request := bson.D{{Key: "id", Value: id}}
+	if len(opts) > 0 {
+		request = withOptions(request, opts[0].DeleteOptions)
+	}
+
+	_, err := c.do("removeById", request, func() (interface{}, error) {
+		return nil, c.inner.RemoveByIdWithCtx(ctx, id, opts...)
+	})
+
+	return err
+}
+
+func (c *Collection) Bulk() xmgo.IBulk {
+	return &Bulk{collection: c}
+}
+
+// exporter 支持导出的 collection，如 xmgo.Collection 及 memory.Collection
+type exporter interface {
+	Export(ctx context.Context, w io.Writer, filter interface{}, o ...opts.ExportOptions) (int64, error)
+}
+
+// Export 录制导出的内容，回放时原样写出
+func (c *Collection) Export(ctx context.Context, w io.Writer, filter interface{}, o ...opts.ExportOptions) (int64, error) {
+	var eo opts.ExportOptions
+	if len(o) > 0 {
+		eo = o[0]
+	}
+
+	request := bson.D{
+		{Key: "filter", Value: filter},
+		{Key: "format", Value: eo.Format},
+		{Key: "canonical", Value: eo.Canonical},
+		{Key: "sort", Value: eo.Sort},
+		{Key: "projection", Value: eo.Projection},
+		{Key: "limit", Value: eo.Limit},
+	}
+
+	v, err := c.do("export", request, func() (interface{}, error) {
+		ex, ok := c.inner.(exporter)
+		if !ok {
+			return nil, fmt.Errorf("replay: %T does not support export", c.inner)
+		}
+
+		var buf bytes.Buffer
+		n, err := ex.Export(ctx, &buf, filter, o...)
+		if err != nil {
+			return nil, err
+		}
+		return bson.D{{Key: "n", Value: n}, {Key: "data", Value: buf.String()}}, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var res struct {
+		N    int64  `bson:"n"`
+		Data string `bson:"data"`
+	}
+	if err = decode(v, &res); err != nil {
+		return 0, err
+	}
+	if _, err = io.WriteString(w, res.Data); err != nil {
+		return 0, err
+	}
+	if c.inner == nil && eo.Progress != nil && res.N > 0 {
+		eo.Progress(res.N)
+	}
+
+	return res.N, nil
+}
+
+// Import 导入 Extended JSON 格式的文档，写入操作通过 Bulk 录制
+func (c *Collection) Import(ctx context.Context, r io.Reader, o ...opts.ImportOptions) (*xmgo.ImportResult, error) {
+	return xmgo.ImportInto(ctx, c, r, o...)
+}
+
+// ImportCSV 导入 CSV 格式的文档，写入操作通过 Bulk 录制
+func (c *Collection) ImportCSV(ctx context.Context, r io.Reader, o ...opts.CSVImportOptions) (*xmgo.CSVImportResult, error) {
+	return xmgo.ImportCSVInto(ctx, c, r, o...)
+}
+
+func (c *Collection) DropIndex(indexes []string) error {
+	return c.DropIndexWithCtx(context.TODO(), indexes)
+}
+
+func (c *Collection) DropIndexWithCtx(ctx context.Context, indexes []string) error {
+	_, err := c.do("dropIndex", bson.D{{Key: "keys", Value: indexes}}, func() (interface{}, error) {
+		return nil, c.inner.DropIndexWithCtx(ctx, indexes)
+	})
+
+	return err
+}
+
+func (c *Collection) DropIndexByName(name string) error {
+	return c.DropIndexByNameWithCtx(context.TODO(), name)
+}
+
+func (c *Collection) DropIndexByNameWithCtx(ctx context.Context, name string) error {
+	_, err := c.do("dropIndexByName", bson.D{{Key: "name", Value: name}}, func() (interface{}, error) {
+		return nil, c.inner.DropIndexByNameWithCtx(ctx, name)
+	})
+
+	return err
+}
+
+func (c *Collection) DropAllIndex() error {
+	return c.DropAllIndexWithCtx(context.TODO())
+}
+
+func (c *Collection) DropAllIndexWithCtx(ctx context.Context) error {
+	_, err := c.do("dropAllIndex", bson.D{}, func() (interface{}, error) {
+		return nil, c.inner.DropAllIndexWithCtx(ctx)
+	})
+
+	return err
+}
+
+func (c *Collection) ListIndexes() ([]*xmgo.IndexSpecification, error) {
+	return c.ListIndexesWithCtx(context.TODO())
+}
+
+func (c *Collection) ListIndexesWithCtx(ctx context.Context) ([]*xmgo.IndexSpecification, error) {
+	v, err := c.do("listIndexes", bson.D{}, func() (interface{}, error) {
+		specs, err := c.inner.ListIndexesWithCtx(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// IndexSpecification 仅按服务器返回的字段名解码，需按相同字段名录制
+		res := bson.A{}
+		for _, s := range specs {
+			res = append(res, bson.D{
+				{Key: "name", Value: s.Name},
+				{Key: "ns", Value: s.Namespace},
+				{Key: "key", Value: s.KeysDocument},
+				{Key: "v", Value: s.Version},
+				{Key: "expireAfterSeconds", Value: s.ExpireAfterSeconds},
+				{Key: "sparse", Value: s.Sparse},
+				{Key: "unique", Value: s.Unique},
+			})
+		}
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*xmgo.IndexSpecification
+	return result, decode(v, &result)
+}
+
+func (c *Collection) CreateIndexes(indexes []opts.IndexOptions) error {
+	return c.CreateIndexesWithCtx(context.TODO(), indexes)
+}
+
+func (c *Collection) CreateIndexesWithCtx(ctx context.Context, indexes []opts.IndexOptions) error {
+	models := bson.A{}
+	for _, idx := range indexes {
+		models = append(models, withOptions(bson.D{{Key: "key", Value: idx.Key}}, idx.IndexOptions))
+	}
+
+	_, err := c.do("createIndexes", bson.D{{Key: "indexes", Value: models}}, func() (interface{}, error) {
+		return nil, c.inner.CreateIndexesWithCtx(ctx, indexes)
+	})
+
+	return err
+}
+
+func (c *Collection) EnsureIndexes(uniques []string, indexes []string) error {
+	return c.EnsureIndexesWithCtx(context.TODO(), uniques, indexes)
+}
+
+func (c *Collection) EnsureIndexesWithCtx(ctx context.Context, uniques []string, indexes []string) error {
+	request := bson.D{{Key: "uniques", Value: uniques}, {Key: "indexes", Value: indexes}}
+
+	_, err := c.do("ensureIndexes", request, func() (interface{}, error) {
+		return nil, c.inner.EnsureIndexesWithCtx(ctx, uniques, indexes)
+	})
+
+	return err
+}
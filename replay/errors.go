@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package replay
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"xtravisions.com/xmgo"
+)
+
+var (
+	// ErrUnexpectedOperation return if operation does not match the next recorded interaction
+	ErrUnexpectedOperation = errors.New("unexpected operation")
+	// ErrRequestMismatch return if request does not match the recorded request
+	ErrRequestMismatch = errors.New("request mismatch")
+	// ErrInteractionsRemaining return if recorded interactions are not all replayed
+	ErrInteractionsRemaining = errors.New("recorded interactions remaining")
+	// ErrNotSupported return if operation can not be recorded or replayed
+	ErrNotSupported = errors.New("not supported by replay")
+)
+
+// sentinels 回放时按消息还原的哨兵错误，保证 errors.Is 及 == 比较可用
+var sentinels = []error{
+	mongo.ErrNoDocuments,
+	mongo.ErrEmptySlice,
+	xmgo.ErrQueryNotSlicePointer,
+	xmgo.ErrQueryNotSliceType,
+	xmgo.ErrQueryResultTypeInconsistent,
+	xmgo.ErrQueryResultValCanNotChange,
+	xmgo.ErrNotValidSliceToInsert,
+	xmgo.ErrReplacementContainUpdateOperators,
+	xmgo.ErrCircuitOpen,
+	xmgo.ErrTransactionNotSupported,
+	xmgo.ErrFeatureNotSupported,
+	xmgo.ErrSessionMismatch,
+	xmgo.ErrNotInTransaction,
+	xmgo.ErrTransactionExists,
+	xmgo.ErrTransactionRollbackOnly,
+	xmgo.ErrTransactionAborted,
+	context.Canceled,
+	context.DeadlineExceeded,
+}
+
+// Error 录制的错误
+type Error struct {
+	Kind        string        `bson:"kind"`
+	Code        int32         `bson:"code,omitempty"`
+	Name        string        `bson:"name,omitempty"`
+	Message     string        `bson:"message"`
+	Labels      []string      `bson:"labels,omitempty"`
+	WriteErrors []*WriteError `bson:"writeErrors,omitempty"`
+	Op          *Op           `bson:"op,omitempty"`
+}
+
+// Op 录制错误的操作信息，对应 xmgo.OpError
+type Op struct {
+	Database   string `bson:"database"`
+	Collection string `bson:"collection"`
+	Name       string `bson:"name"`
+	Filter     string `bson:"filter,omitempty"`
+}
+
+// WriteError 录制的单个写错误
+type WriteError struct {
+	Index   int    `bson:"index"`
+	Code    int    `bson:"code"`
+	Message string `bson:"message"`
+}
+
+const (
+	kindSentinel  = "sentinel"
+	kindCommand   = "command"
+	kindWrite     = "write"
+	kindBulkWrite = "bulkWrite"
+	kindFeature   = "feature"
+	kindOther     = "error"
+)
+
+func encodeError(err error) *Error {
+	var oe *xmgo.OpError
+	if errors.As(err, &oe) {
+		res := encodeError(oe.Err)
+		res.Op = &Op{Database: oe.Database, Collection: oe.Collection, Name: oe.Op, Filter: oe.Filter}
+		return res
+	}
+
+	var fe *xmgo.FeatureError
+	if errors.As(err, &fe) {
+		return &Error{Kind: kindFeature, Name: string(fe.Feature), Message: fe.Reason}
+	}
+
+	for _, s := range sentinels {
+		if errors.Is(err, s) {
+			return &Error{Kind: kindSentinel, Message: s.Error()}
+		}
+	}
+
+	var (
+		ce  mongo.CommandError
+		we  mongo.WriteException
+		bwe mongo.BulkWriteException
+	)
+	switch {
+	case errors.As(err, &ce):
+		return &Error{Kind: kindCommand, Code: ce.Code, Name: ce.Name, Message: ce.Message, Labels: ce.Labels}
+	case errors.As(err, &we):
+		res := &Error{Kind: kindWrite, Message: err.Error(), Labels: we.Labels}
+		for _, e := range we.WriteErrors {
+			res.WriteErrors = append(res.WriteErrors, &WriteError{Index: e.Index, Code: e.Code, Message: e.Message})
+		}
+		return res
+	case errors.As(err, &bwe):
+		res := &Error{Kind: kindBulkWrite, Message: err.Error(), Labels: bwe.Labels}
+		for _, e := range bwe.WriteErrors {
+			res.WriteErrors = append(res.WriteErrors, &WriteError{Index: e.Index, Code: e.Code, Message: e.Message})
+		}
+		return res
+	default:
+		return &Error{Kind: kindOther, Message: err.Error()}
+	}
+}
+
+// Err 还原为与录制时类型一致的错误
+func (e *Error) Err() error {
+	err := e.err()
+	if e.Op == nil {
+		return err
+	}
+
+	return &xmgo.OpError{Database: e.Op.Database, Collection: e.Op.Collection, Op: e.Op.Name, Filter: e.Op.Filter, Err: err}
+}
+
+func (e *Error) err() error {
+	switch e.Kind {
+	case kindSentinel:
+		for _, s := range sentinels {
+			if s.Error() == e.Message {
+				return s
+			}
+		}
+	case kindFeature:
+		return &xmgo.FeatureError{Feature: xmgo.Feature(e.Name), Reason: e.Message}
+	case kindCommand:
+		return xmgo.WrapWriteError(mongo.CommandError{Code: e.Code, Name: e.Name, Message: e.Message, Labels: e.Labels}, nil, nil)
+	case kindWrite:
+		res := mongo.WriteException{Labels: e.Labels}
+		for _, we := range e.WriteErrors {
+			res.WriteErrors = append(res.WriteErrors, mongo.WriteError{Index: we.Index, Code: we.Code, Message: we.Message})
+		}
+		return xmgo.WrapWriteError(res, nil, nil)
+	case kindBulkWrite:
+		res := mongo.BulkWriteException{Labels: e.Labels}
+		for _, we := range e.WriteErrors {
+			res.WriteErrors = append(res.WriteErrors, mongo.BulkWriteError{
+				WriteError: mongo.WriteError{Index: we.Index, Code: we.Code, Message: we.Message},
+			})
+		}
+		return xmgo.WrapWriteError(res, nil, nil)
+	}
+
+	return errors.New(e.Message)
+}
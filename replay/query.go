@@ -0,0 +1,429 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package replay
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"xtravisions.com/xmgo"
+	opts "xtravisions.com/xmgo/options"
+)
+
+// Query 录制或回放的查询，实现 xmgo.IQuery
+type Query struct {
+	filter          interface{}
+	sort            []string
+	project         interface{}
+	hint            interface{}
+	limit           *int64
+	skip            *int64
+	batchSize       *int64
+	arrayFilters    *options.ArrayFilters
+	noCursorTimeout *bool
+	readPref        *readpref.ReadPref
+	readConcern     *readconcern.ReadConcern
+	collation       *options.Collation
+
+	ctx        context.Context
+	collection *Collection
+	opts       []opts.FindOptions
+}
+
+func (q *Query) Sort(fields ...string) xmgo.IQuery {
+	if len(fields) > 0 {
+		q.sort = fields
+	}
+	return q
+}
+
+func (q *Query) Select(projection interface{}) xmgo.IQuery {
+	q.project = projection
+	return q
+}
+
+func (q *Query) Skip(n int64) xmgo.IQuery {
+	q.skip = &n
+	return q
+}
+
+func (q *Query) BatchSize(n int64) xmgo.IQuery {
+	q.batchSize = &n
+	return q
+}
+
+func (q *Query) SetArrayFilters(filter *options.ArrayFilters) xmgo.IQuery {
+	q.arrayFilters = filter
+	return q
+}
+
+func (q *Query) NoCursorTimeout(n bool) xmgo.IQuery {
+	q.noCursorTimeout = &n
+	return q
+}
+
+func (q *Query) Limit(n int64) xmgo.IQuery {
+	q.limit = &n
+	return q
+}
+
+func (q *Query) Hint(hint interface{}) xmgo.IQuery {
+	q.hint = hint
+	return q
+}
+
+func (q *Query) ReadPreference(rp *readpref.ReadPref) xmgo.IQuery {
+	q.readPref = rp
+	return q
+}
+
+func (q *Query) ReadConcern(rc *readconcern.ReadConcern) xmgo.IQuery {
+	q.readConcern = rc
+	return q
+}
+
+func (q *Query) Collation(collation *options.Collation) xmgo.IQuery {
+	q.collation = collation
+	return q
+}
+
+// request 查询请求，仅包含已设置的条件
+func (q *Query) request() bson.D {
+	request := bson.D{{Key: "filter", Value: q.filter}}
+	if q.sort != nil {
+		request = append(request, bson.E{Key: "sort", Value: q.sort})
+	}
+	if q.project != nil {
+		request = append(request, bson.E{Key: "projection", Value: q.project})
+	}
+	if q.hint != nil {
+		request = append(request, bson.E{Key: "hint", Value: q.hint})
+	}
+	if q.skip != nil {
+		request = append(request, bson.E{Key: "skip", Value: *q.skip})
+	}
+	if q.limit != nil {
+		request = append(request, bson.E{Key: "limit", Value: *q.limit})
+	}
+	if q.arrayFilters != nil {
+		request = append(request, bson.E{Key: "arrayFilters", Value: q.arrayFilters.Filters})
+	}
+	if q.collation != nil {
+		request = append(request, bson.E{Key: "collation", Value: q.collation})
+	}
+
+	return withReadOptions(request, q.readPref, q.readConcern)
+}
+
+// inner 在真实 collection 上构建相同的查询
+func (q *Query) inner() xmgo.IQuery {
+	inner := q.collection.inner.FindWithCtx(q.ctx, q.filter, q.opts...)
+	if q.sort != nil {
+		inner = inner.Sort(q.sort...)
+	}
+	if q.project != nil {
+		inner = inner.Select(q.project)
+	}
+	if q.hint != nil {
+		inner = inner.Hint(q.hint)
+	}
+	if q.skip != nil {
+		inner = inner.Skip(*q.skip)
+	}
+	if q.limit != nil {
+		inner = inner.Limit(*q.limit)
+	}
+	if q.batchSize != nil {
+		inner = inner.BatchSize(*q.batchSize)
+	}
+	if q.arrayFilters != nil {
+		inner = inner.SetArrayFilters(q.arrayFilters)
+	}
+	if q.noCursorTimeout != nil {
+		inner = inner.NoCursorTimeout(*q.noCursorTimeout)
+	}
+	if q.readPref != nil {
+		inner = inner.ReadPreference(q.readPref)
+	}
+	if q.readConcern != nil {
+		inner = inner.ReadConcern(q.readConcern)
+	}
+	if q.collation != nil {
+		inner = inner.Collation(q.collation)
+	}
+
+	return inner
+}
+
+func (q *Query) One(result interface{}) error {
+	v, err := q.collection.do("find.one", q.request(), func() (interface{}, error) {
+		var doc bson.Raw
+		err := q.inner().One(&doc)
+		return doc, err
+	})
+	if err != nil {
+		return err
+	}
+
+	return decode(v, result)
+}
+
+func (q *Query) All(result interface{}) error {
+	v, err := q.collection.do("find.all", q.request(), func() (interface{}, error) {
+		docs := []bson.Raw{}
+		err := q.inner().All(&docs)
+		return docs, err
+	})
+	if err != nil {
+		return err
+	}
+
+	return decode(v, result)
+}
+
+func (q *Query) Count() (n int64, err error) {
+	v, err := q.collection.do("find.count", q.request(), func() (interface{}, error) {
+		return q.inner().Count()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, decode(v, &n)
+}
+
+func (q *Query) EstimatedCount() (n int64, err error) {
+	v, err := q.collection.do("find.estimatedCount", bson.D{}, func() (interface{}, error) {
+		return q.inner().EstimatedCount()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, decode(v, &n)
+}
+
+func (q *Query) Exists() (b bool, err error) {
+	var n int64 = 0
+	if n, err = q.Count(); err == nil {
+		if n > 0 {
+			b = true
+		}
+	}
+
+	return
+}
+
+func (q *Query) Distinct(key string, result interface{}) error {
+	request := append(q.request(), bson.E{Key: "key", Value: key})
+
+	v, err := q.collection.do("find.distinct", request, func() (interface{}, error) {
+		values := bson.A{}
+		return values, q.inner().Distinct(key, &values)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = decode(v, result); err != nil {
+		return xmgo.ErrQueryResultTypeInconsistent
+	}
+
+	return nil
+}
+
+// Cursor 录制时一次性读取全部文档
+func (q *Query) Cursor() xmgo.ICursor {
+	v, err := q.collection.do("find.cursor", q.request(), func() (interface{}, error) {
+		docs := []bson.Raw{}
+		cur := q.inner().Cursor()
+		defer func() {
+			_ = cur.Close()
+		}()
+		err := cur.All(&docs)
+		return docs, err
+	})
+
+	return newCursor(v, err)
+}
+
+func (q *Query) Apply(change xmgo.Change, result interface{}) error {
+	request := append(q.request(), bson.E{Key: "change", Value: bson.D{
+		{Key: "update", Value: change.Update},
+		{Key: "replace", Value: change.Replace},
+		{Key: "remove", Value: change.Remove},
+		{Key: "upsert", Value: change.Upsert},
+		{Key: "returnNew", Value: change.ReturnNew},
+	}})
+
+	v, err := q.collection.do("find.apply", request, func() (interface{}, error) {
+		var doc bson.Raw
+		if err := q.inner().Apply(change, &doc); err != nil || doc == nil {
+			return nil, err
+		}
+		return doc, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return decode(v, result)
+}
+
+// Aggregate 录制或回放的聚合，实现 xmgo.IAggregate
+type Aggregate struct {
+	ctx        context.Context
+	collection *Collection
+	pipeline   interface{}
+	opts       []opts.AggregateOptions
+
+	readPref    *readpref.ReadPref
+	readConcern *readconcern.ReadConcern
+	collation   *options.Collation
+}
+
+func (a *Aggregate) ReadPreference(rp *readpref.ReadPref) xmgo.IAggregate {
+	a.readPref = rp
+	return a
+}
+
+func (a *Aggregate) ReadConcern(rc *readconcern.ReadConcern) xmgo.IAggregate {
+	a.readConcern = rc
+	return a
+}
+
+func (a *Aggregate) Collation(collation *options.Collation) xmgo.IAggregate {
+	a.collation = collation
+	return a
+}
+
+func (a *Aggregate) request() bson.D {
+	request := bson.D{{Key: "pipeline", Value: a.pipeline}}
+	if len(a.opts) > 0 {
+		request = withOptions(request, a.opts[0].AggregateOptions)
+	}
+	if a.collation != nil {
+		request = append(request, bson.E{Key: "collation", Value: a.collation})
+	}
+
+	return withReadOptions(request, a.readPref, a.readConcern)
+}
+
+func (a *Aggregate) inner() xmgo.IAggregate {
+	inner := a.collection.inner.AggregateWithCtx(a.ctx, a.pipeline, a.opts...)
+	if a.readPref != nil {
+		inner = inner.ReadPreference(a.readPref)
+	}
+	if a.readConcern != nil {
+		inner = inner.ReadConcern(a.readConcern)
+	}
+	if a.collation != nil {
+		inner = inner.Collation(a.collation)
+	}
+
+	return inner
+}
+
+func (a *Aggregate) All(results interface{}) error {
+	v, err := a.collection.do("aggregate.all", a.request(), func() (interface{}, error) {
+		docs := []bson.Raw{}
+		err := a.inner().All(&docs)
+		return docs, err
+	})
+	if err != nil {
+		return err
+	}
+
+	return decode(v, results)
+}
+
+func (a *Aggregate) One(result interface{}) error {
+	v, err := a.collection.do("aggregate.one", a.request(), func() (interface{}, error) {
+		var doc bson.Raw
+		err := a.inner().One(&doc)
+		return doc, err
+	})
+	if err != nil {
+		return err
+	}
+
+	return decode(v, result)
+}
+
+// Iter 录制时一次性读取全部文档
+func (a *Aggregate) Iter() xmgo.ICursor {
+	v, err := a.collection.do("aggregate.iter", a.request(), func() (interface{}, error) {
+		docs := []bson.Raw{}
+		cur := a.inner().Iter()
+		defer func() {
+			_ = cur.Close()
+		}()
+		err := cur.All(&docs)
+		return docs, err
+	})
+
+	return newCursor(v, err)
+}
+
+// Cursor 录制文档的游标，实现 xmgo.ICursor
+type Cursor struct {
+	docs []bson.RawValue
+	err  error
+}
+
+func newCursor(v bson.RawValue, err error) *Cursor {
+	c := &Cursor{err: err}
+	if err == nil && v.Type == bson.TypeArray {
+		c.docs, c.err = v.Array().Values()
+	}
+
+	return c
+}
+
+func (c *Cursor) Next(result interface{}) bool {
+	if c.err != nil || len(c.docs) == 0 {
+		return false
+	}
+
+	doc := c.docs[0]
+	c.docs = c.docs[1:]
+	if c.err = doc.Unmarshal(result); c.err != nil {
+		return false
+	}
+
+	return true
+}
+
+func (c *Cursor) All(results interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	docs := bson.A{}
+	for _, doc := range c.docs {
+		docs = append(docs, doc)
+	}
+	c.docs = nil
+
+	t, data, err := bson.MarshalValue(docs)
+	if err != nil {
+		return err
+	}
+
+	return bson.RawValue{Type: t, Value: data}.Unmarshal(results)
+}
+
+func (c *Cursor) Close() error {
+	c.docs = nil
+	return c.err
+}
+
+func (c *Cursor) Err() error {
+	return c.err
+}
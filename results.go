@@ -22,3 +22,17 @@ type UpdateResult struct {
 type DeleteResult struct {
 	DeletedCount int64
 }
+
+type ImportResult struct {
+	ReadCount     int64
+	InsertedCount int64
+	MatchedCount  int64
+	ModifiedCount int64
+	UpsertedCount int64
+}
+
+type CSVImportResult struct {
+	ReadCount     int64
+	InsertedCount int64
+	Errors        []*CSVRowError
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ResumeTokenStore change stream resume token 存储，用于重启后从上次的位置继续监听
+//
+//	保存的内容由 ChangeStream 生成，如 invalidate 事件的 resume token 会包装为 {startAfter: token}，存储需原样保存
+type ResumeTokenStore interface {
+	// Load 获取保存的 resume token，不存在时返回 nil
+	Load(ctx context.Context, key string) (bson.Raw, error)
+	// Save 保存 resume token
+	Save(ctx context.Context, key string, token bson.Raw) error
+}
+
+// MemoryTokenStore 内存 resume token 存储，仅用于测试或同一进程内重新打开 change stream
+type MemoryTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]bson.Raw
+}
+
+// NewMemoryTokenStore 创建内存 resume token 存储
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[string]bson.Raw)}
+}
+
+func (s *MemoryTokenStore) Load(_ context.Context, key string) (bson.Raw, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.tokens[key], nil
+}
+
+func (s *MemoryTokenStore) Save(_ context.Context, key string, token bson.Raw) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[key] = append(bson.Raw(nil), token...)
+	return nil
+}
+
+// CollectionTokenStore 使用 collection 保存 resume token，文档 _id 为存储的键
+type CollectionTokenStore struct {
+	coll ICollection
+}
+
+// NewCollectionTokenStore 创建 collection resume token 存储
+//
+//	@param coll 保存 resume token 的 collection，不应为被监听的 collection
+func NewCollectionTokenStore(coll ICollection) *CollectionTokenStore {
+	return &CollectionTokenStore{coll: coll}
+}
+
+type resumeToken struct {
+	Key       string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+func (s *CollectionTokenStore) Load(ctx context.Context, key string) (bson.Raw, error) {
+	var doc resumeToken
+	err := s.coll.FindWithCtx(ctx, M{"_id": key}).One(&doc)
+	if errors.Is(err, ErrNoSuchDocuments) {
+		return nil, nil
+	}
+
+	return doc.Token, err
+}
+
+func (s *CollectionTokenStore) Save(ctx context.Context, key string, token bson.Raw) error {
+	_, err := s.coll.UpsertByIdWithCtx(ctx, key, resumeToken{Key: key, Token: token, UpdatedAt: time.Now()})
+	return err
+}
+
+// FileTokenStore 使用本地文件保存 resume token，每个键一个文件
+type FileTokenStore struct {
+	dir string
+}
+
+// NewFileTokenStore 创建文件 resume token 存储
+//
+//	@param dir 保存 resume token 的目录，不存在时自动创建
+func NewFileTokenStore(dir string) *FileTokenStore {
+	return &FileTokenStore{dir: dir}
+}
+
+func (s *FileTokenStore) path(key string) string {
+	return filepath.Join(s.dir, url.PathEscape(key)+".token")
+}
+
+func (s *FileTokenStore) Load(_ context.Context, key string) (bson.Raw, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token := bson.Raw(data)
+	return token, token.Validate()
+}
+
+// Save 先写入临时文件再重命名，避免写入中断导致文件损坏
+func (s *FileTokenStore) Save(_ context.Context, key string, token bson.Raw) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".token-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err = tmp.Write(token); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(key))
+}
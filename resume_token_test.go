@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"xtravisions.com/xmgo"
+	"xtravisions.com/xmgo/memory"
+)
+
+// testTokenStore 校验 ResumeTokenStore 的基本约定：未保存时返回 nil，保存后返回最近一次的值，各键相互独立
+func testTokenStore(t *testing.T, store xmgo.ResumeTokenStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	if token, err := store.Load(ctx, "orders/consumer"); err != nil || token != nil {
+		t.Fatalf("Load() on empty store = %v, %v, want nil, nil", token, err)
+	}
+
+	for _, data := range []string{"8263A1", "8263A2"} {
+		want, _ := bson.Marshal(bson.M{"_data": data})
+		if err := store.Save(ctx, "orders/consumer", want); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if token, err := store.Load(ctx, "orders/consumer"); err != nil || !bytes.Equal(token, want) {
+			t.Fatalf("Load() = %v, %v, want %v", token, err, bson.Raw(want))
+		}
+	}
+
+	if token, err := store.Load(ctx, "orders/other"); err != nil || token != nil {
+		t.Errorf("Load() another key = %v, %v, want nil, nil", token, err)
+	}
+}
+
+func TestMemoryTokenStore(t *testing.T) {
+	store := xmgo.NewMemoryTokenStore()
+	testTokenStore(t, store)
+
+	// 保存的是副本，调用方修改原值不影响存储
+	token, _ := bson.Marshal(bson.M{"_data": "8263A3"})
+	_ = store.Save(context.Background(), "copy", token)
+	token[len(token)-2] = 'X'
+	if saved, _ := store.Load(context.Background(), "copy"); bytes.Equal(saved, token) {
+		t.Error("MemoryTokenStore kept a reference to the caller's token")
+	}
+}
+
+func TestCollectionTokenStore(t *testing.T) {
+	testTokenStore(t, xmgo.NewCollectionTokenStore(memory.NewClient().Database("test").Collection("tokens")))
+}
+
+func TestFileTokenStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tokens")
+	testTokenStore(t, xmgo.NewFileTokenStore(dir))
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.token"), []byte{1, 2, 3}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := xmgo.NewFileTokenStore(dir).Load(context.Background(), "broken"); err == nil {
+		t.Error("Load() corrupted token error = nil, want error")
+	}
+}
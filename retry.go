@@ -0,0 +1,324 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// ErrorClass 可重试的错误类别，可按位组合
+type ErrorClass uint8
+
+const (
+	// RetryNetwork 网络错误
+	RetryNetwork ErrorClass = 1 << iota
+	// RetryTimeout 服务端或网络超时，调用方上下文超时或取消时不重试
+	RetryTimeout
+	// RetryNotPrimary 非主节点、主节点切换中或无可用节点
+	RetryNotPrimary
+	// RetryTransient 带有 RetryableWriteError、TransientTransactionError 标签或可重试错误码的服务端错误
+	RetryTransient
+
+	// RetryDefault 默认重试的错误类别
+	RetryDefault = RetryNetwork | RetryNotPrimary | RetryTransient
+)
+
+// 重试策略默认值
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 5 * time.Second
+	defaultMultiplier     = 2
+)
+
+// RetryPolicy 瞬时错误重试策略，重试间隔按指数退避并附加随机抖动
+//
+//	幂等操作（查询、聚合、按 _id 且仅包含 $set 等绝对赋值操作符的写操作等）遇到 RetryOn 中的错误时重试，
+//	按条件更新或删除多个文档的操作不视为幂等；
+//	非幂等写操作默认仅在服务端确认未执行（非主节点拒绝、无可用节点）时重试，设置 RetryNonIdempotent 后按幂等操作处理
+//	事务中的操作不按此策略重试，由 WithTransaction 重试整个事务
+//	通过 Config.Retry 设置默认策略，通过 WithRetryPolicy 为单次操作覆盖
+type RetryPolicy struct {
+	// 最大执行次数，包含首次执行
+	//	小于等于 1 时不重试
+	MaxAttempts int `json:"maxAttempts"`
+	// 首次重试前的等待时间
+	//	默认为 100 毫秒
+	InitialBackoffMS int64 `json:"initialBackoffMS"`
+	// 重试等待时间上限
+	//	默认为 5 秒
+	MaxBackoffMS int64 `json:"maxBackoffMS"`
+	// 每次重试等待时间的增长倍数
+	//	小于 1 时使用默认值 2
+	Multiplier float64 `json:"multiplier"`
+	// 等待时间的随机抖动比例，取值 0 ~ 1
+	//	如 0.2 表示实际等待时间在计算值的 80% ~ 100% 之间
+	Jitter float64 `json:"jitter"`
+	// 重试的错误类别
+	//	默认为 RetryDefault
+	RetryOn ErrorClass `json:"retryOn"`
+	// 是否重试非幂等写操作
+	//	开启后网络错误等无法确认是否已执行的情况也会重试，可能导致写操作重复执行
+	RetryNonIdempotent bool `json:"retryNonIdempotent"`
+}
+
+// DefaultRetryPolicy 获取默认重试策略
+//
+//	最多执行 3 次，重试间隔自 100 毫秒起按 2 倍增长，抖动比例 0.2
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:      3,
+		InitialBackoffMS: int64(defaultInitialBackoff / time.Millisecond),
+		MaxBackoffMS:     int64(defaultMaxBackoff / time.Millisecond),
+		Multiplier:       defaultMultiplier,
+		Jitter:           0.2,
+		RetryOn:          RetryDefault,
+	}
+}
+
+type retryPolicyKey struct{}
+
+// WithRetryPolicy 为使用该上下文的操作覆盖重试策略
+//
+//	@param ctx 上下文
+//	@param policy 重试策略，为 nil 时不重试
+func WithRetryPolicy(ctx context.Context, policy *RetryPolicy) context.Context {
+	if policy == nil {
+		policy = &RetryPolicy{}
+	}
+
+	return context.WithValue(ctx, retryPolicyKey{}, policy)
+}
+
+// Retryable 判断错误在该策略下是否可重试
+//
+//	@param err 错误
+//	@param idempotent 操作是否幂等
+func (p *RetryPolicy) Retryable(err error, idempotent bool) bool {
+	if p == nil || err == nil {
+		return false
+	}
+
+	class := p.RetryOn
+	if class == 0 {
+		class = RetryDefault
+	}
+
+	if !idempotent && !p.RetryNonIdempotent {
+		return class&RetryNotPrimary != 0 && notExecuted(err)
+	}
+
+	switch {
+	case class&RetryNetwork != 0 && IsNetwork(err):
+		return true
+	case class&RetryTimeout != 0 && mongo.IsTimeout(err):
+		return true
+	case class&RetryNotPrimary != 0 && (IsNotPrimary(err) || notExecuted(err)):
+		return true
+	case class&RetryTransient != 0 && IsRetryable(err):
+		return true
+	}
+
+	return false
+}
+
+// Backoff 获取第 attempt 次重试前的等待时间，attempt 从 1 开始
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	initial := time.Duration(p.InitialBackoffMS) * time.Millisecond
+	if initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	max := time.Duration(p.MaxBackoffMS) * time.Millisecond
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = defaultMultiplier
+	}
+
+	d := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if d > float64(max) {
+		d = float64(max)
+	}
+	if jitter := math.Min(math.Max(p.Jitter, 0), 1); jitter > 0 {
+		d -= d * jitter * rand.Float64()
+	}
+
+	return time.Duration(d)
+}
+
+// do 按重试策略执行 fn，上下文中通过 WithRetryPolicy 设置的策略优先
+//
+//	@param ctx 上下文，取消或超时后不再重试
+//	@param idempotent 操作是否幂等
+//	@param fn 待执行的操作
+func (p *RetryPolicy) do(ctx context.Context, idempotent bool, fn func() error) error {
+	if policy, ok := ctx.Value(retryPolicyKey{}).(*RetryPolicy); ok {
+		p = policy
+	}
+
+	err := fn()
+	if p == nil {
+		return err
+	}
+
+	for attempt := 1; attempt < p.MaxAttempts && p.Retryable(err, idempotent); attempt++ {
+		if ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(p.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		err = fn()
+	}
+
+	return err
+}
+
+// notExecuted 判断错误是否表示操作确定未被服务端执行，此时重试非幂等操作也是安全的
+func notExecuted(err error) bool {
+	var sse topology.ServerSelectionError
+	if errors.As(err, &sse) {
+		return true
+	}
+
+	var se mongo.ServerError
+	if !errors.As(err, &se) {
+		return false
+	}
+
+	return se.HasErrorCode(codeNotWritablePrimary) || se.HasErrorCode(codeNotPrimaryNoSecondaryOk) ||
+		se.HasErrorCode(codeNotPrimaryOrSecondary) || se.HasErrorMessage("not master")
+}
+
+// idempotentOps 重复执行结果不变的更新操作符
+var idempotentOps = map[string]bool{
+	"$set":         true,
+	"$unset":       true,
+	"$setOnInsert": true,
+	"$min":         true,
+	"$max":         true,
+	"$addToSet":    true,
+	"$pull":        true,
+	"$pullAll":     true,
+}
+
+// idempotentUpdate 判断更新文档是否幂等，替换文档及仅包含 idempotentOps 操作符的更新文档为幂等
+func idempotentUpdate(update interface{}) bool {
+	doc, ok := toD(update)
+	if !ok {
+		return false
+	}
+
+	for _, e := range doc {
+		if len(e.Key) > 0 && e.Key[0] == '$' && !idempotentOps[e.Key] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// idFilter 判断查询条件是否仅按 _id 精确匹配
+func idFilter(filter interface{}) bool {
+	doc, ok := toD(filter)
+	if !ok || len(doc) != 1 || doc[0].Key != "_id" {
+		return false
+	}
+
+	if d, ok := doc[0].Value.(bson.D); ok {
+		for _, e := range d {
+			if len(e.Key) > 0 && e.Key[0] == '$' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// idempotentPipeline 判断聚合管道是否幂等，包含 $merge 阶段时为非幂等
+func idempotentPipeline(pipeline interface{}) bool {
+	merge, err := hasStage(pipeline, "$merge")
+	return err == nil && !merge
+}
+
+// hasStage 判断聚合管道是否包含指定阶段
+func hasStage(pipeline interface{}, name string) (bool, error) {
+	data, err := bson.Marshal(bson.M{"pipeline": pipeline})
+	if err != nil {
+		return false, err
+	}
+
+	stages, err := bson.Raw(data).LookupErr("pipeline")
+	if err != nil {
+		return false, err
+	}
+	arr, ok := stages.ArrayOK()
+	if !ok {
+		return false, fmt.Errorf("pipeline must be an array, got %s", stages.Type)
+	}
+	values, err := arr.Values()
+	if err != nil {
+		return false, err
+	}
+	for _, stage := range values {
+		if doc, ok := stage.DocumentOK(); ok {
+			if _, err = doc.LookupErr(name); err == nil {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// idempotentModel 判断批量写操作是否幂等
+//
+//	DeleteMany 及 UpdateMany 重试时匹配的文档集合可能已变化，如两次执行之间新写入的匹配文档，不视为幂等
+func idempotentModel(model mongo.WriteModel) bool {
+	switch m := model.(type) {
+	case *mongo.DeleteOneModel:
+		return idFilter(m.Filter)
+	case *mongo.ReplaceOneModel:
+		return idFilter(m.Filter)
+	case *mongo.UpdateOneModel:
+		return idFilter(m.Filter) && idempotentUpdate(m.Update)
+	}
+
+	return false
+}
+
+func toD(v interface{}) (bson.D, bool) {
+	if d, ok := v.(bson.D); ok {
+		return d, true
+	}
+
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	var doc bson.D
+	if err = bson.Unmarshal(data, &doc); err != nil {
+		return nil, false
+	}
+
+	return doc, true
+}
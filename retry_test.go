@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+var errNetwork = mongo.CommandError{Code: 6, Labels: []string{"NetworkError"}}
+
+func TestRetryable(t *testing.T) {
+	def := DefaultRetryPolicy()
+	notPrimary := mongo.CommandError{Code: codeNotWritablePrimary}
+	steppedDown := mongo.CommandError{Code: codePrimarySteppedDown}
+	timeout := mongo.CommandError{Code: 50, Labels: []string{"ExceededTimeLimitError"}}
+	selection := topology.ServerSelectionError{Wrapped: errors.New("no primary")}
+
+	cases := []struct {
+		policy     *RetryPolicy
+		err        error
+		idempotent bool
+		want       bool
+	}{
+		{def, nil, true, false},
+		{nil, errNetwork, true, false},
+		{def, errors.New("boom"), true, false},
+		{def, errNetwork, true, true},
+		{def, errNetwork, false, false},
+		{&RetryPolicy{RetryNonIdempotent: true}, errNetwork, false, true},
+		{def, notPrimary, false, true},
+		{def, selection, false, true},
+		{def, steppedDown, true, true},
+		{def, steppedDown, false, false},
+		{def, mongo.CommandError{Code: 112, Labels: []string{"RetryableWriteError"}}, true, true},
+		{&RetryPolicy{RetryOn: RetryNetwork}, mongo.CommandError{Code: 112, Labels: []string{"RetryableWriteError"}}, true, false},
+		{def, timeout, true, false},
+		{&RetryPolicy{RetryOn: RetryTimeout}, timeout, true, true},
+		{def, mongo.CommandError{Code: codeDuplicateKey}, true, false},
+		{def, NewOpError("db", "users", "find", nil, errNetwork), true, true},
+	}
+
+	for i, c := range cases {
+		if got := c.policy.Retryable(c.err, c.idempotent); got != c.want {
+			t.Errorf("case %d: Retryable(%v, %v) = %v, want %v", i, c.err, c.idempotent, got, c.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if d := (&RetryPolicy{}).Backoff(1); d != defaultInitialBackoff {
+		t.Errorf("default Backoff(1) = %v, want %v", d, defaultInitialBackoff)
+	}
+
+	p := &RetryPolicy{InitialBackoffMS: 10, MaxBackoffMS: 50, Multiplier: 3}
+	for attempt, want := range map[int]time.Duration{1: 10 * time.Millisecond, 2: 30 * time.Millisecond, 3: 50 * time.Millisecond, 8: 50 * time.Millisecond} {
+		if d := p.Backoff(attempt); d != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempt, d, want)
+		}
+	}
+
+	p = &RetryPolicy{InitialBackoffMS: 100, Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		if d := p.Backoff(1); d < 80*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("Backoff with jitter = %v, want within [80ms, 100ms]", d)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 3, InitialBackoffMS: 1, MaxBackoffMS: 1}
+
+	// failing 返回前 n 次调用失败的操作及调用计数
+	failing := func(n int) (func() error, *int) {
+		calls := 0
+		return func() error {
+			calls++
+			if calls <= n {
+				return errNetwork
+			}
+			return nil
+		}, &calls
+	}
+
+	t.Run("recovers", func(t *testing.T) {
+		fn, calls := failing(2)
+		if err := p.do(context.Background(), true, fn); err != nil || *calls != 3 {
+			t.Errorf("do() = %v after %d calls, want nil after 3", err, *calls)
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		fn, calls := failing(5)
+		if err := p.do(context.Background(), true, fn); err == nil || *calls != 3 {
+			t.Errorf("do() = %v after %d calls, want error after 3", err, *calls)
+		}
+	})
+
+	t.Run("non-idempotent", func(t *testing.T) {
+		fn, calls := failing(1)
+		if err := p.do(context.Background(), false, fn); err == nil || *calls != 1 {
+			t.Errorf("do() = %v after %d calls, want error after 1", err, *calls)
+		}
+	})
+
+	t.Run("disabled by context", func(t *testing.T) {
+		fn, calls := failing(1)
+		if err := p.do(WithRetryPolicy(context.Background(), nil), true, fn); err == nil || *calls != 1 {
+			t.Errorf("do() = %v after %d calls, want error after 1", err, *calls)
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		fn, calls := failing(1)
+		if err := p.do(ctx, true, fn); err == nil || *calls != 1 {
+			t.Errorf("do() = %v after %d calls, want error after 1", err, *calls)
+		}
+	})
+}
+
+func TestIdempotentModel(t *testing.T) {
+	set := bson.M{"$set": bson.M{"a": 1}}
+	byID := bson.M{"_id": 1}
+	byField := bson.M{"name": "a"}
+
+	idempotent := []mongo.WriteModel{
+		mongo.NewDeleteOneModel().SetFilter(byID),
+		mongo.NewReplaceOneModel().SetFilter(byID).SetReplacement(bson.M{"a": 1}),
+		mongo.NewUpdateOneModel().SetFilter(byID).SetUpdate(set),
+	}
+	for _, m := range idempotent {
+		if !idempotentModel(m) {
+			t.Errorf("idempotentModel(%T %+v) = false, want true", m, m)
+		}
+	}
+
+	nonIdempotent := []mongo.WriteModel{
+		mongo.NewInsertOneModel().SetDocument(bson.M{"a": 1}),
+		mongo.NewDeleteOneModel().SetFilter(byField),
+		mongo.NewUpdateOneModel().SetFilter(byID).SetUpdate(bson.M{"$inc": bson.M{"a": 1}}),
+		mongo.NewUpdateOneModel().SetFilter(bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: 1}}}}).SetUpdate(set),
+		// 多文档写操作重试时匹配的文档集合可能已变化
+		mongo.NewDeleteManyModel().SetFilter(byID),
+		mongo.NewUpdateManyModel().SetFilter(byField).SetUpdate(set),
+		mongo.NewUpdateManyModel().SetFilter(byID).SetUpdate(set),
+	}
+	for _, m := range nonIdempotent {
+		if idempotentModel(m) {
+			t.Errorf("idempotentModel(%T %+v) = true, want false", m, m)
+		}
+	}
+}
+
+func TestIdempotentPipeline(t *testing.T) {
+	if !idempotentPipeline(A{M{"$match": M{"a": 1}}, M{"$out": "b"}}) {
+		t.Error("idempotentPipeline($out) = false, want true")
+	}
+	if idempotentPipeline(A{M{"$match": M{"a": 1}}, M{"$merge": M{"into": "b"}}}) {
+		t.Error("idempotentPipeline($merge) = true, want false")
+	}
+	if idempotentPipeline(1) {
+		t.Error("idempotentPipeline(non-array) = true, want false")
+	}
+}
@@ -6,7 +6,10 @@ package xmgo
 
 import (
 	"context"
+	"errors"
 
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/x/mongo/driver"
@@ -14,22 +17,196 @@ import (
 	opts "xtravisions.com/xmgo/options"
 )
 
+// TransactionState 会话的事务状态
+type TransactionState int
+
+const (
+	// TransactionNone 未开启事务
+	TransactionNone TransactionState = iota
+	// TransactionInProgress 事务进行中
+	TransactionInProgress
+	// TransactionCommitted 事务已提交
+	TransactionCommitted
+	// TransactionAborted 事务已中止
+	TransactionAborted
+)
+
+func (s TransactionState) String() string {
+	switch s {
+	case TransactionInProgress:
+		return "in progress"
+	case TransactionCommitted:
+		return "committed"
+	case TransactionAborted:
+		return "aborted"
+	}
+
+	return "none"
+}
+
+// Session mongodb 会话，用于事务及因果一致性读写
+//
+//	与驱动的 mongo.Session 一致，Session 不是并发安全的，不能在多个 goroutine 中同时使用；
+//	需并发执行的操作应各自使用独立的会话
 type Session struct {
-	session mongo.Session
+	session   mongo.Session
+	client    *Client
+	state     TransactionState
+	callbacks *TransactionCallbacks
 }
 
-func (s *Session) StartTransaction(ctx context.Context, cb func(sessCtx context.Context) (interface{}, error), opts ...*opts.TransactionOptions) (interface{}, error) {
-	transactionOpts := options.Transaction()
-	if len(opts) > 0 && opts[0].TransactionOptions != nil {
-		transactionOpts = opts[0].TransactionOptions
+type sessionKey struct{}
+
+// SessionFromContext 获取 DoTransaction、StartTransaction 回调或 Begin 返回的上下文所属的会话
+//
+//	用于在回调中通过 Session.Database、Session.Collection 获取绑定会话的句柄；
+//	TransactionBestEffort 模式在单节点服务器上不开启事务，也没有会话，此时返回 nil，调用方需判断：
+//
+//	coll := client.Database("app").Collection("users")
+//	if s := xmgo.SessionFromContext(ctx); s != nil {
+//		coll = s.Collection("app", "users")
+//	}
+//
+//	@param ctx 回调上下文
+func SessionFromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+	return s
+}
+
+// Database 获取绑定会话的数据库，其全部操作（包括不带上下文的方法）均在会话中执行
+//
+//	不触发 OnOpen 钩子；传入属于其他会话的上下文时返回 ErrSessionMismatch
+//	@param name 数据库名称
+//	@param o 数据库参数
+func (s *Session) Database(name string, o ...*opts.DatabaseOptions) *Database {
+	opt := options.Database()
+	if len(o) > 0 && o[0].DatabaseOptions != nil {
+		opt = o[0].DatabaseOptions
 	}
-	result, err := s.session.WithTransaction(ctx, wrapperCustomCb(cb), transactionOpts)
+
+	return &Database{
+		database: s.client.client.Database(name, opt),
+		registry: s.client.registry,
+		exec:     s.client.exec.withSession(s.session),
+	}
+}
+
+// Collection 获取绑定会话的 collection，参见 Session.Database
+//
+//	@param database 数据库名称
+//	@param collection collection 名称
+func (s *Session) Collection(database, collection string) *Collection {
+	return s.Database(database).Collection(collection)
+}
+
+// StartTransaction 在事务中执行回调，遇到瞬时错误时重试回调，提交结果未知时重试提交
+//
+//	@param ctx 上下文
+//	@param cb 事务回调
+//	@param opts 事务参数
+func (s *Session) StartTransaction(ctx context.Context, cb func(sessCtx context.Context) (interface{}, error), opts ...*opts.TransactionOptions) (interface{}, error) {
+	result, err := s.session.WithTransaction(ctx, wrapperCustomCb(s, cb), transactionOptions(opts...))
+	s.finish(err)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
+// Begin 开启事务，返回的上下文用于事务内的操作，需调用 Commit 或 Abort 结束事务
+//
+//	与 StartTransaction 不同，遇到瞬时错误时不自动重试，可跨函数传递返回的上下文
+//	@param ctx 上下文
+//	@param opts 事务参数
+func (s *Session) Begin(ctx context.Context, opts ...*opts.TransactionOptions) (context.Context, error) {
+	if err := s.session.StartTransaction(transactionOptions(opts...)); err != nil {
+		return ctx, err
+	}
+	s.state = TransactionInProgress
+
+	ctx, s.callbacks = WithTransactionCallbacks(context.WithValue(ctx, sessionKey{}, s))
+	return mongo.NewSessionContext(ctx, s.session), nil
+}
+
+// Commit 提交 Begin 开启的事务
+//
+//	加入事务的内层回调失败时中止事务并返回 ErrTransactionRollbackOnly；
+//	返回错误包含 UnknownTransactionCommitResult 标签时事务仍为 TransactionInProgress，可再次调用 Commit
+//	@param ctx 上下文
+func (s *Session) Commit(ctx context.Context) error {
+	if err := s.callbacks.Check(nil); err != nil {
+		_ = s.session.AbortTransaction(ctx)
+		s.finish(err)
+		return err
+	}
+
+	err := s.session.CommitTransaction(ctx)
+
+	var se mongo.ServerError
+	if errors.As(err, &se) && se.HasErrorLabel(driver.UnknownTransactionCommitResult) {
+		return err
+	}
+
+	s.finish(err)
+	return err
+}
+
+// Abort 中止 Begin 开启的事务，执行 OnRollback 注册的回调，回调参数为 ErrTransactionAborted
+//
+//	@param ctx 上下文
+func (s *Session) Abort(ctx context.Context) error {
+	err := s.session.AbortTransaction(ctx)
+	s.finish(ErrTransactionAborted)
+
+	return err
+}
+
+// State 获取当前会话最近一次事务的状态
+func (s *Session) State() TransactionState {
+	return s.state
+}
+
+// ClusterTime 获取会话观察到的集群时间
+func (s *Session) ClusterTime() bson.Raw {
+	return s.session.ClusterTime()
+}
+
+// OperationTime 获取会话最近一次操作的时间
+func (s *Session) OperationTime() *primitive.Timestamp {
+	return s.session.OperationTime()
+}
+
+// AdvanceClusterTime 推进会话的集群时间
+//
+//	@param clusterTime 其他会话的 ClusterTime
+func (s *Session) AdvanceClusterTime(clusterTime bson.Raw) error {
+	return s.session.AdvanceClusterTime(clusterTime)
+}
+
+// AdvanceOperationTime 推进会话的操作时间，之后的因果一致读可读到该时间之前的写入
+//
+//	@param operationTime 其他会话的 OperationTime
+func (s *Session) AdvanceOperationTime(operationTime *primitive.Timestamp) error {
+	return s.session.AdvanceOperationTime(operationTime)
+}
+
+// CausallyAfter 按其他会话推进集群时间及操作时间，使跨会话的读取能观察到 other 的写入
+//
+//	需会话开启因果一致性（默认开启），参见 opts.SessionOptions
+//	@param other 已执行写入的会话
+func (s *Session) CausallyAfter(other *Session) error {
+	if clusterTime := other.ClusterTime(); clusterTime != nil {
+		if err := s.AdvanceClusterTime(clusterTime); err != nil {
+			return err
+		}
+	}
+	if operationTime := other.OperationTime(); operationTime != nil {
+		return s.AdvanceOperationTime(operationTime)
+	}
+
+	return nil
+}
+
 func (s *Session) EndSession(ctx context.Context) {
 	s.session.EndSession(ctx)
 }
@@ -38,9 +215,37 @@ func (s *Session) AbortTransaction(ctx context.Context) error {
 	return s.session.AbortTransaction(ctx)
 }
 
-func wrapperCustomCb(cb func(ctx context.Context) (interface{}, error)) func(sessCtx mongo.SessionContext) (interface{}, error) {
+// finish 更新事务状态并执行提交或回滚回调
+func (s *Session) finish(err error) {
+	if err == nil {
+		s.state = TransactionCommitted
+	} else {
+		s.state = TransactionAborted
+	}
+
+	callbacks := s.callbacks
+	s.callbacks = nil
+	callbacks.Finish(err)
+}
+
+func transactionOptions(opts ...*opts.TransactionOptions) *options.TransactionOptions {
+	if len(opts) > 0 && opts[0] != nil && opts[0].TransactionOptions != nil {
+		return opts[0].TransactionOptions
+	}
+
+	return options.Transaction()
+}
+
+// wrapperCustomCb 包装事务回调，每次执行时创建新的回调作用域，失败尝试注册的回调被丢弃
+func wrapperCustomCb(s *Session, cb func(ctx context.Context) (interface{}, error)) func(sessCtx mongo.SessionContext) (interface{}, error) {
 	return func(sessCtx mongo.SessionContext) (interface{}, error) {
-		result, err := cb(sessCtx)
+		s.state = TransactionInProgress
+
+		var ctx context.Context
+		ctx, s.callbacks = WithTransactionCallbacks(context.WithValue(sessCtx, sessionKey{}, s))
+
+		result, err := cb(mongo.NewSessionContext(ctx, s.session))
+		err = s.callbacks.Check(err)
 		if err == ErrTransactionRetry {
 			return nil, mongo.CommandError{Labels: []string{driver.TransientTransactionError}}
 		}
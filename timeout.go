@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts 各类操作的默认超时设置，仅在上下文未设置截止时间时生效
+//
+//	设置为 0 意味该类操作不使用默认超时
+type Timeouts struct {
+	// 查询操作超时，包括 One、All、Count、Distinct 及 Cursor 的遍历
+	ReadMS int64 `json:"readMS"`
+	// 写操作超时，包括插入、更新、删除、Apply 及 Bulk
+	WriteMS int64 `json:"writeMS"`
+	// 聚合操作超时，包括 Iter 的遍历
+	AggregateMS int64 `json:"aggregateMS"`
+	// 索引操作超时，包括创建、删除及获取索引
+	IndexMS int64 `json:"indexMS"`
+	// 事务超时，包括回调执行及提交
+	TransactionMS int64 `json:"transactionMS"`
+}
+
+// opClass 操作类别
+type opClass int
+
+const (
+	opRead opClass = iota
+	opWrite
+	opAggregate
+	opIndex
+	opTransaction
+)
+
+type timeoutKey struct{}
+
+// WithOperationTimeout 为使用该上下文的操作覆盖默认超时
+//
+//	覆盖后即使上下文已有截止时间也会附加该超时，以较早者为准
+//	@param ctx 上下文
+//	@param timeout 超时时间，小于等于 0 时不使用默认超时
+func WithOperationTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, timeout)
+}
+
+// duration 获取操作类别对应的超时时间
+func (t *Timeouts) duration(class opClass) time.Duration {
+	if t == nil {
+		return 0
+	}
+
+	var ms int64
+	switch class {
+	case opRead:
+		ms = t.ReadMS
+	case opWrite:
+		ms = t.WriteMS
+	case opAggregate:
+		ms = t.AggregateMS
+	case opIndex:
+		ms = t.IndexMS
+	case opTransaction:
+		ms = t.TransactionMS
+	}
+
+	return time.Duration(ms) * time.Millisecond
+}
+
+// timeout 为操作上下文附加超时，上下文通过 WithOperationTimeout 设置的超时优先，
+// 否则在上下文未设置截止时间时使用操作类别的默认超时
+//
+//	返回的 cancel 需在操作完成后调用
+func (e *executor) timeout(ctx context.Context, class opClass) (context.Context, context.CancelFunc) {
+	d, ok := ctx.Value(timeoutKey{}).(time.Duration)
+	if !ok {
+		if _, has := ctx.Deadline(); has || e == nil {
+			return ctx, func() {}
+		}
+		d = e.timeouts.duration(class)
+	}
+
+	if d <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, d)
+}
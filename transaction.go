@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	opts "xtravisions.com/xmgo/options"
+)
+
+type transactionKey struct{}
+
+// TransactionCallbacks 单次事务回调执行期间注册的提交及回滚回调
+//
+//	事务回调因瞬时错误重试时，每次执行使用新的 TransactionCallbacks，失败尝试注册的回调被丢弃
+type TransactionCallbacks struct {
+	commit   []func()
+	rollback []func(err error)
+	// 加入事务的内层回调返回的首个错误，外层事务只能回滚
+	rollbackOnly error
+	// TransactionBestEffort 模式下未开启事务，仅提供回调作用域
+	bestEffort bool
+}
+
+// WithTransactionCallbacks 创建事务回调作用域，供 IClient 实现在每次执行事务回调前调用
+//
+//	事务结束后需调用 Finish 执行回调
+//	@param ctx 事务回调上下文
+func WithTransactionCallbacks(ctx context.Context) (context.Context, *TransactionCallbacks) {
+	t := &TransactionCallbacks{}
+	return context.WithValue(ctx, transactionKey{}, t), t
+}
+
+// withBestEffortCallbacks 创建未开启事务的回调作用域，InTransaction 不视为处于事务中
+func withBestEffortCallbacks(ctx context.Context) (context.Context, *TransactionCallbacks) {
+	ctx, t := WithTransactionCallbacks(ctx)
+	t.bestEffort = true
+	return ctx, t
+}
+
+// Check 事务回调返回后、提交前调用，内层回调失败而外层回调未返回错误时返回 ErrTransactionRollbackOnly
+//
+//	@param err 事务回调返回的错误
+func (t *TransactionCallbacks) Check(err error) error {
+	if err != nil || t == nil || t.rollbackOnly == nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: %v", ErrTransactionRollbackOnly, t.rollbackOnly)
+}
+
+// Finish 事务结束后执行回调，err 为 nil 时按注册顺序执行提交回调，否则执行回滚回调
+//
+//	重复调用无效
+//	@param err 事务结果
+func (t *TransactionCallbacks) Finish(err error) {
+	if t == nil {
+		return
+	}
+
+	commit, rollback := t.commit, t.rollback
+	t.commit, t.rollback = nil, nil
+
+	if err == nil {
+		for _, fn := range commit {
+			fn()
+		}
+		return
+	}
+
+	for _, fn := range rollback {
+		fn(err)
+	}
+}
+
+// PropagateTransaction 按事务传播方式处理已存在的事务，供 IClient 实现在开启事务前调用
+//
+//	handled 为 true 时已加入外层事务或以无事务方式执行回调，调用方直接返回 result 及 err；
+//	否则调用方需开启新事务
+//	@param ctx 上下文
+//	@param callback 事务回调
+//	@param o 事务参数
+func PropagateTransaction(ctx context.Context, callback func(sessCtx context.Context) (interface{}, error), o ...*opts.TransactionOptions) (handled bool, result interface{}, err error) {
+	propagation := opts.PropagationRequired
+	if len(o) > 0 && o[0] != nil {
+		propagation = o[0].Propagation
+	}
+
+	outer, _ := ctx.Value(transactionKey{}).(*TransactionCallbacks)
+
+	switch propagation {
+	case opts.PropagationNever:
+		if InTransaction(ctx) {
+			return true, nil, ErrTransactionExists
+		}
+		result, err = callback(ctx)
+		return true, result, err
+	case opts.PropagationRequiresNew:
+		return false, nil, nil
+	}
+
+	if outer == nil {
+		return false, nil, nil
+	}
+
+	result, err = callback(ctx)
+	if err != nil && outer.rollbackOnly == nil {
+		outer.rollbackOnly = err
+	}
+
+	return true, result, err
+}
+
+// InTransaction 判断上下文是否处于事务中
+//
+//	上下文绑定会话时按会话的事务状态判断，否则按是否处于 IClient 实现（如内存实现）的事务回调中判断；
+//	TransactionBestEffort 模式未开启事务，返回 false
+//	@param ctx 上下文
+func InTransaction(ctx context.Context) bool {
+	if s := mongo.SessionFromContext(ctx); s != nil {
+		xs, ok := s.(mongo.XSession)
+		return ok && xs.ClientSession().TransactionRunning()
+	}
+
+	t, ok := ctx.Value(transactionKey{}).(*TransactionCallbacks)
+	return ok && !t.bestEffort
+}
+
+// OnCommit 注册事务提交后执行的回调，如发布事件、清除缓存
+//
+//	ctx 不在事务回调中时返回 ErrNotInTransaction
+//	@param ctx 事务回调上下文
+//	@param fn 回调
+func OnCommit(ctx context.Context, fn func()) error {
+	t, ok := ctx.Value(transactionKey{}).(*TransactionCallbacks)
+	if !ok {
+		return ErrNotInTransaction
+	}
+
+	t.commit = append(t.commit, fn)
+	return nil
+}
+
+// OnRollback 注册事务回滚或提交失败后执行的回调
+//
+//	ctx 不在事务回调中时返回 ErrNotInTransaction
+//	@param ctx 事务回调上下文
+//	@param fn 回调，参数为事务失败原因
+func OnRollback(ctx context.Context, fn func(err error)) error {
+	t, ok := ctx.Value(transactionKey{}).(*TransactionCallbacks)
+	if !ok {
+		return ErrNotInTransaction
+	}
+
+	t.rollback = append(t.rollback, fn)
+	return nil
+}
@@ -7,6 +7,7 @@ package xmgo
 import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // alias mongo drive bson primitives
@@ -22,6 +23,8 @@ type (
 	E = bson.E
 	// ObjectId is an alias of primitive.ObjectID
 	ObjectId = primitive.ObjectID
+	// IndexSpecification is an alias of mongo.IndexSpecification
+	IndexSpecification = mongo.IndexSpecification
 )
 
 // NewObjectId 生成 ObjectID
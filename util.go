@@ -5,11 +5,18 @@
 package xmgo
 
 import (
-	"math"
-	"strconv"
+	"fmt"
 	"strings"
 )
 
+// 索引类型
+const (
+	IndexText     = "text"
+	Index2D       = "2d"
+	Index2DSphere = "2dsphere"
+	IndexHashed   = "hashed"
+)
+
 func splitSortField(field string) (key string, sort int32) {
 	sort = 1
 	key = field
@@ -28,24 +35,44 @@ func splitSortField(field string) (key string, sort int32) {
 	return key, sort
 }
 
-func compareVersions(v1 string, v2 string) (int, error) {
-	n1 := strings.Split(v1, ".")
-	n2 := strings.Split(v2, ".")
+// splitIndexField 解析索引字段定义
+//
+//	`title` / `+title` 升序，`-title` 降序
+//	`$text:title` 全文索引，`#userId` 哈希索引，`@location` 2dsphere 索引
+//	`$2d:location`、`$2dsphere:location`、`$hashed:userId` 显式指定索引类型
+//	`$**` / `attrs.$**` 通配符索引
+func splitIndexField(field string) (key string, value interface{}) {
+	if len(field) == 0 {
+		return field, int32(1)
+	}
 
-	for i := 0; i < int(math.Min(float64(len(n1)), float64(len(n2)))); i++ {
-		i1, err := strconv.Atoi(n1[i])
-		if err != nil {
-			return 0, err
+	switch field[0] {
+	case '#':
+		return strings.TrimPrefix(field, "#"), IndexHashed
+	case '@':
+		return strings.TrimPrefix(field, "@"), Index2DSphere
+	case '$':
+		if i := strings.Index(field, ":"); i > 1 {
+			return field[i+1:], field[1:i]
 		}
-		i2, err := strconv.Atoi(n2[i])
-		if err != nil {
-			return 0, err
-		}
-		difference := i1 - i2
-		if difference != 0 {
-			return difference, nil
+	}
+
+	return splitSortField(field)
+}
+
+// indexName 按 mongodb 默认规则生成索引名
+func indexName(fields []string) string {
+	var res string
+	for _, e := range fields {
+		key, value := splitIndexField(e)
+		n := key + "_" + fmt.Sprint(value)
+
+		if len(res) == 0 {
+			res = n
+		} else {
+			res += "_" + n
 		}
 	}
 
-	return 0, nil
+	return res
 }
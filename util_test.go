@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import "testing"
+
+func TestSplitIndexField(t *testing.T) {
+	for field, want := range map[string]struct {
+		key   string
+		value interface{}
+	}{
+		"":                   {"", int32(1)},
+		"title":              {"title", int32(1)},
+		"+title":             {"title", int32(1)},
+		"-title":             {"title", int32(-1)},
+		"#userId":            {"userId", IndexHashed},
+		"@location":          {"location", Index2DSphere},
+		"$text:title":        {"title", IndexText},
+		"$2d:location":       {"location", Index2D},
+		"$2dsphere:location": {"location", Index2DSphere},
+		"$hashed:userId":     {"userId", IndexHashed},
+		"$**":                {"$**", int32(1)},
+		"attrs.$**":          {"attrs.$**", int32(1)},
+		"$:title":            {"$:title", int32(1)},
+	} {
+		key, value := splitIndexField(field)
+		if key != want.key || value != want.value {
+			t.Errorf("splitIndexField(%q) = %q, %#v, want %q, %#v", field, key, value, want.key, want.value)
+		}
+	}
+}
+
+func TestIndexName(t *testing.T) {
+	if name := indexName([]string{"name", "-age"}); name != "name_1_age_-1" {
+		t.Errorf("indexName() = %q, want name_1_age_-1", name)
+	}
+	if name := indexName([]string{"$text:title", "#userId", "@location"}); name != "title_text_userId_hashed_location_2dsphere" {
+		t.Errorf("indexName() = %q, want title_text_userId_hashed_location_2dsphere", name)
+	}
+}
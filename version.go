@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version 服务器版本
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	// 预发布标识，如 6.0.3-rc1 中的 rc1
+	PreRelease string
+}
+
+// ParseVersion 解析服务器版本
+//
+//	支持 `6.0.3`、`4.4`、`6.0.3-rc1`、`7.1.0-alpha-123-gabcdef`、`v5.0.1` 及带构建信息的 `5.0.1+build` 等格式
+//	@param s 版本字符串
+func ParseVersion(s string) (v Version, err error) {
+	str := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(str, '+'); i >= 0 {
+		str = str[:i]
+	}
+	if i := strings.IndexByte(str, '-'); i >= 0 {
+		str, v.PreRelease = str[:i], str[i+1:]
+	}
+
+	parts := strings.Split(str, ".")
+	if len(parts) > 3 || parts[0] == "" {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", s)
+		}
+		*nums[i] = n
+	}
+
+	return v, nil
+}
+
+// MustParseVersion 解析服务器版本，失败时 panic
+func MustParseVersion(s string) Version {
+	v, err := ParseVersion(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.PreRelease != "" {
+		s += "-" + v.PreRelease
+	}
+
+	return s
+}
+
+// Compare 比较版本，v 小于、等于、大于 o 时分别返回 -1、0、1
+//
+//	预发布版本小于对应的正式版本，预发布标识按语义化版本规则逐段比较
+func (v Version) Compare(o Version) int {
+	if c := compareInt(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+
+	switch {
+	case v.PreRelease == o.PreRelease:
+		return 0
+	case v.PreRelease == "":
+		return 1
+	case o.PreRelease == "":
+		return -1
+	}
+
+	return comparePreRelease(v.PreRelease, o.PreRelease)
+}
+
+// AtLeast 判断版本是否不低于 major.minor 的正式版本
+func (v Version) AtLeast(major, minor int) bool {
+	return v.Compare(Version{Major: major, Minor: minor}) >= 0
+}
+
+func comparePreRelease(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+
+		var c int
+		switch {
+		case errA == nil && errB == nil:
+			c = compareInt(na, nb)
+		case errA == nil:
+			c = -1
+		case errB == nil:
+			c = 1
+		default:
+			c = compareIdentifier(pa[i], pb[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	return compareInt(len(pa), len(pb))
+}
+
+// compareIdentifier 比较预发布标识，前缀相同时按尾部数字大小比较，如 rc2 小于 rc10
+func compareIdentifier(a, b string) int {
+	ta, tb := strings.TrimRight(a, "0123456789"), strings.TrimRight(b, "0123456789")
+	if ta == tb && ta != a && tb != b {
+		na, errA := strconv.Atoi(a[len(ta):])
+		nb, errB := strconv.Atoi(b[len(tb):])
+		if errA == nil && errB == nil {
+			return compareInt(na, nb)
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
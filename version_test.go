@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgo
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	for in, want := range map[string]Version{
+		"6.0.3":                   {Major: 6, Minor: 0, Patch: 3},
+		"4.4":                     {Major: 4, Minor: 4},
+		"5":                       {Major: 5},
+		" v5.0.1 ":                {Major: 5, Minor: 0, Patch: 1},
+		"6.0.3-rc1":               {Major: 6, Minor: 0, Patch: 3, PreRelease: "rc1"},
+		"7.1.0-alpha-123-gabcdef": {Major: 7, Minor: 1, PreRelease: "alpha-123-gabcdef"},
+		"5.0.1+build":             {Major: 5, Minor: 0, Patch: 1},
+	} {
+		if got, err := ParseVersion(in); err != nil || got != want {
+			t.Errorf("ParseVersion(%q) = %+v, %v, want %+v", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "6.0.3.1", "6.x", "6.-1", ".1", "v"} {
+		if v, err := ParseVersion(in); err == nil {
+			t.Errorf("ParseVersion(%q) = %+v, want error", in, v)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	// 按从低到高排列，相邻的同一行版本相等
+	ordered := [][]string{
+		{"4.0.20"},
+		{"4.2.0-1"},
+		{"4.2.0-alpha"},
+		{"4.2.0-alpha.1"},
+		{"4.2.0-alpha.2"},
+		{"4.2.0-alpha.10"},
+		{"4.2.0-beta"},
+		{"4.2.0-rc2"},
+		{"4.2.0-rc10"},
+		{"4.2", "4.2.0", "v4.2.0+build"},
+		{"4.2.9"},
+		{"4.2.10"},
+		{"6.0.0"},
+	}
+
+	for i, group := range ordered {
+		for j, other := range ordered {
+			for _, a := range group {
+				for _, b := range other {
+					want := compareInt(i, j)
+					if got := MustParseVersion(a).Compare(MustParseVersion(b)); got != want {
+						t.Errorf("%s.Compare(%s) = %d, want %d", a, b, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	v := MustParseVersion("4.2.0")
+	if !v.AtLeast(4, 2) || !v.AtLeast(3, 6) || v.AtLeast(4, 4) {
+		t.Errorf("AtLeast on %s returned unexpected results", v)
+	}
+	if MustParseVersion("4.2.0-rc1").AtLeast(4, 2) {
+		t.Error("4.2.0-rc1.AtLeast(4, 2) = true, want false")
+	}
+	if s := MustParseVersion("v6.0.3-rc1+build").String(); s != "6.0.3-rc1" {
+		t.Errorf("String() = %q, want 6.0.3-rc1", s)
+	}
+}
@@ -0,0 +1,271 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgotest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"xtravisions.com/xmgo"
+)
+
+// DefaultIgnore 默认忽略的易变字段，与 xmgo.DefaultField 一致
+var DefaultIgnore = []string{"createdAt", "updatedAt"}
+
+// AssertOptions 断言配置
+type AssertOptions struct {
+	// 比较时忽略的字段，支持 a.b 形式，为 nil 时使用 DefaultIgnore
+	Ignore []string
+	// 是否按顺序比较，默认忽略文档顺序
+	Ordered bool
+	// 仅比较满足条件的文档，默认比较全部文档
+	Filter interface{}
+	// 读取文档时的排序，默认按 _id 升序
+	Sort []string
+}
+
+// AssertDocuments 断言 collection 中的文档与期望一致，不一致时标记测试失败
+//
+//	@param t 当前测试
+//	@param coll collection
+//	@param expected 期望的文档数组，元素可为 bson.D、bson.M 或结构体
+//	@param o 断言配置
+func AssertDocuments(t testing.TB, coll xmgo.ICollection, expected interface{}, o ...AssertOptions) bool {
+	t.Helper()
+
+	var ao AssertOptions
+	if len(o) > 0 {
+		ao = o[0]
+	}
+	if ao.Ignore == nil {
+		ao.Ignore = DefaultIgnore
+	}
+	if ao.Filter == nil {
+		ao.Filter = bson.D{}
+	}
+	if len(ao.Sort) == 0 {
+		ao.Sort = []string{"_id"}
+	}
+
+	want, err := normalize(expected, ao.Ignore)
+	if err != nil {
+		t.Errorf("xmgotest: expected documents of %s: %v", coll.Name(), err)
+		return false
+	}
+
+	var docs []bson.D
+	if err = coll.Find(ao.Filter).Sort(ao.Sort...).All(&docs); err != nil {
+		t.Errorf("xmgotest: read documents of %s: %v", coll.Name(), err)
+		return false
+	}
+	got, err := normalize(docs, ao.Ignore)
+	if err != nil {
+		t.Errorf("xmgotest: actual documents of %s: %v", coll.Name(), err)
+		return false
+	}
+
+	var diff []string
+	if ao.Ordered {
+		diff = diffOrdered(want, got)
+	} else {
+		diff = diffUnordered(want, got)
+	}
+	if len(diff) > 0 {
+		t.Errorf("xmgotest: documents of %s mismatch (-want +got):\n%s", coll.Name(), strings.Join(diff, "\n"))
+		return false
+	}
+
+	return true
+}
+
+// AssertFixtures 断言数据库内容与数据文件一致，文件格式参见 ParseFixtures
+//
+//	@param t 当前测试
+//	@param db 数据库
+//	@param path 期望数据文件路径
+//	@param o 断言配置
+func AssertFixtures(t testing.TB, db xmgo.IDatabase, path string, o ...AssertOptions) bool {
+	t.Helper()
+
+	fixtures, err := ReadFixtures(path)
+	if err != nil {
+		t.Errorf("xmgotest: %v", err)
+		return false
+	}
+
+	ok := true
+	for _, f := range fixtures {
+		ok = AssertDocuments(t, db.Collection(f.Collection), f.Documents, o...) && ok
+	}
+
+	return ok
+}
+
+// normalize 转换文档为 bson.D 并删除忽略的字段
+func normalize(docs interface{}, ignore []string) ([]bson.D, error) {
+	rv := reflect.ValueOf(docs)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("documents must be a slice, got %T", docs)
+	}
+
+	res := make([]bson.D, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		data, err := bson.Marshal(rv.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+
+		var doc bson.D
+		if err = bson.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		for _, path := range ignore {
+			doc = without(doc, strings.Split(path, "."))
+		}
+		res = append(res, doc)
+	}
+
+	return res, nil
+}
+
+func without(doc bson.D, path []string) bson.D {
+	res := make(bson.D, 0, len(doc))
+	for _, e := range doc {
+		if e.Key != path[0] {
+			res = append(res, e)
+			continue
+		}
+		if len(path) > 1 {
+			e.Value = withoutValue(e.Value, path[1:])
+			res = append(res, e)
+		}
+	}
+
+	return res
+}
+
+func withoutValue(v interface{}, path []string) interface{} {
+	switch vv := v.(type) {
+	case bson.D:
+		return without(vv, path)
+	case bson.A:
+		res := make(bson.A, len(vv))
+		for i, e := range vv {
+			res[i] = withoutValue(e, path)
+		}
+		return res
+	}
+
+	return v
+}
+
+func diffOrdered(want, got []bson.D) []string {
+	var diff []string
+	for i := 0; i < len(want) || i < len(got); i++ {
+		switch {
+		case i >= len(got):
+			diff = append(diff, fmt.Sprintf("  [%d] - %s", i, extJSON(want[i])))
+		case i >= len(want):
+			diff = append(diff, fmt.Sprintf("  [%d] + %s", i, extJSON(got[i])))
+		case !equal(want[i], got[i]):
+			diff = append(diff, fmt.Sprintf("  [%d] - %s", i, extJSON(want[i])), fmt.Sprintf("  [%d] + %s", i, extJSON(got[i])))
+		}
+	}
+
+	return diff
+}
+
+func diffUnordered(want, got []bson.D) []string {
+	used := make([]bool, len(got))
+
+	var diff []string
+	for _, w := range want {
+		found := false
+		for j, g := range got {
+			if !used[j] && equal(w, g) {
+				used[j], found = true, true
+				break
+			}
+		}
+		if !found {
+			diff = append(diff, "  - "+extJSON(w))
+		}
+	}
+	for j, g := range got {
+		if !used[j] {
+			diff = append(diff, "  + "+extJSON(g))
+		}
+	}
+
+	return diff
+}
+
+// equal 比较两个值，文档字段忽略顺序，数值按大小比较
+func equal(a, b interface{}) bool {
+	switch av := a.(type) {
+	case bson.D:
+		bv, ok := b.(bson.D)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for _, e := range av {
+			found := false
+			for _, f := range bv {
+				if e.Key == f.Key {
+					found = equal(e.Value, f.Value)
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	case bson.A:
+		bv, ok := b.(bson.A)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !equal(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if af, ok := number(a); ok {
+		bf, ok := number(b)
+		return ok && af == bf
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+func extJSON(doc bson.D) string {
+	data, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return fmt.Sprint(doc)
+	}
+
+	return string(data)
+}
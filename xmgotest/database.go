@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+// Package xmgotest 集成测试辅助工具
+//
+//	为每个测试创建独立的临时数据库，加载 YAML/JSON 格式的数据，断言 collection 内容，并在测试结束时删除数据库
+package xmgotest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"xtravisions.com/xmgo"
+)
+
+// maxNameLen mongodb 数据库名称的最大长度
+const maxNameLen = 63
+
+// NewDatabase 为当前测试创建名称唯一的临时数据库，测试结束时自动删除
+//
+//	数据库名称由前缀、测试名称及随机后缀组成
+//	@param t 当前测试
+//	@param client mongodb 连接，可为 memory.Client
+//	@param prefix 名称前缀，默认为 xmgotest
+func NewDatabase(t testing.TB, client xmgo.IClient, prefix ...string) xmgo.IDatabase {
+	t.Helper()
+
+	p := "xmgotest"
+	if len(prefix) > 0 && prefix[0] != "" {
+		p = prefix[0]
+	}
+
+	db := client.Database(databaseName(p, t.Name()))
+	t.Cleanup(func() {
+		if err := db.Drop(); err != nil {
+			t.Logf("xmgotest: drop database %s: %v", db.Name(), err)
+		}
+	})
+
+	return db
+}
+
+func databaseName(prefix, test string) string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\. "$*<>:|?`, r) || r > 127 {
+			return '_'
+		}
+		return r
+	}, test)
+
+	// 保留前缀及随机后缀，截断测试名称
+	if n := maxNameLen - len(prefix) - 2 - len(suffix)*2; len(name) > n {
+		name = name[:n]
+	}
+
+	return prefix + "_" + name + "_" + hex.EncodeToString(suffix)
+}
+
+// Reset 删除数据库中的 collection，用于同一测试内多次加载数据
+//
+//	@param t 当前测试
+//	@param db 数据库
+//	@param collections 待删除的 collection，为空时删除全部
+func Reset(t testing.TB, db xmgo.IDatabase, collections ...string) {
+	t.Helper()
+
+	if len(collections) == 0 {
+		names, err := db.CollectionNames()
+		if err != nil {
+			t.Fatalf("xmgotest: list collections of %s: %v", db.Name(), err)
+		}
+		collections = names
+	}
+
+	for _, name := range collections {
+		if err := db.Collection(name).Drop(); err != nil {
+			t.Fatalf("xmgotest: drop collection %s: %v", name, err)
+		}
+	}
+}
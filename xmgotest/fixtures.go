@@ -0,0 +1,315 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgotest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/yaml.v3"
+
+	"xtravisions.com/xmgo"
+)
+
+// Fixture 单个 collection 的数据
+type Fixture struct {
+	Collection string
+	Documents  []bson.D
+}
+
+// Fixtures 按文件中顺序排列的数据
+type Fixtures []Fixture
+
+var (
+	objectIdPattern = regexp.MustCompile(`^ObjectId\(\s*"([0-9a-fA-F]{24})"\s*\)$`)
+	datePattern     = regexp.MustCompile(`^ISODate\(\s*"([^"]+)"\s*\)$`)
+)
+
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ParseFixtures 解析 YAML 或 JSON 格式的数据
+//
+//	顶层为 collection 名称到文档数组的映射，支持以下简写：
+//	`!oid 5f1b...` 或 `ObjectId("5f1b...")` 表示 ObjectId，`!oid` 不带值时生成新的 ObjectId
+//	`!date 2022-01-02T15:04:05Z` 或 `ISODate("2022-01-02T15:04:05Z")` 表示日期
+//	以 . 开头的顶层键不作为 collection，可用于定义锚点模板，如 `.base: &base`
+//	同时支持 Extended JSON 形式，如 {"$oid": "5f1b..."}、{"$date": "2022-01-02T15:04:05Z"}
+//	@param data 数据内容
+func ParseFixtures(data []byte) (Fixtures, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if root.Kind == 0 {
+		return nil, nil
+	}
+
+	node := resolve(&root)
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: fixtures must be a mapping of collection to documents", node.Line)
+	}
+
+	var res Fixtures
+	for i := 0; i < len(node.Content); i += 2 {
+		name, docs := node.Content[i].Value, resolve(node.Content[i+1])
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if docs.Kind != yaml.SequenceNode && docs.ShortTag() != "!!null" {
+			return nil, fmt.Errorf("line %d: documents of %s must be a sequence", docs.Line, name)
+		}
+
+		fixture := Fixture{Collection: name}
+		for _, n := range docs.Content {
+			v, err := value(n)
+			if err != nil {
+				return nil, err
+			}
+			doc, ok := v.(bson.D)
+			if !ok {
+				return nil, fmt.Errorf("line %d: document of %s must be a mapping", n.Line, name)
+			}
+			fixture.Documents = append(fixture.Documents, doc)
+		}
+		res = append(res, fixture)
+	}
+
+	return res, nil
+}
+
+// ReadFixtures 读取并合并多个数据文件
+//
+//	@param paths 文件路径
+func ReadFixtures(paths ...string) (Fixtures, error) {
+	var res Fixtures
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		fixtures, err := ParseFixtures(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		res = append(res, fixtures...)
+	}
+
+	return res, nil
+}
+
+// Load 写入数据到数据库
+//
+//	@param db 数据库
+func (f Fixtures) Load(ctx context.Context, db xmgo.IDatabase) error {
+	for _, fixture := range f {
+		if len(fixture.Documents) == 0 {
+			continue
+		}
+
+		if _, err := db.Collection(fixture.Collection).InsertManyWithCtx(ctx, fixture.Documents); err != nil {
+			return fmt.Errorf("load %s: %w", fixture.Collection, err)
+		}
+	}
+
+	return nil
+}
+
+// LoadFixtures 读取数据文件并写入数据库，失败时终止测试
+//
+//	@param t 当前测试
+//	@param db 数据库
+//	@param paths 文件路径
+func LoadFixtures(t testing.TB, db xmgo.IDatabase, paths ...string) Fixtures {
+	t.Helper()
+
+	fixtures, err := ReadFixtures(paths...)
+	if err != nil {
+		t.Fatalf("xmgotest: %v", err)
+	}
+	if err = fixtures.Load(context.Background(), db); err != nil {
+		t.Fatalf("xmgotest: %v", err)
+	}
+
+	return fixtures
+}
+
+func resolve(n *yaml.Node) *yaml.Node {
+	for n.Kind == yaml.DocumentNode || n.Kind == yaml.AliasNode {
+		if n.Kind == yaml.AliasNode {
+			n = n.Alias
+		} else if len(n.Content) > 0 {
+			n = n.Content[0]
+		} else {
+			break
+		}
+	}
+
+	return n
+}
+
+// value 转换 yaml 节点为 bson 值，映射转换为 bson.D 以保留字段顺序
+func value(n *yaml.Node) (interface{}, error) {
+	n = resolve(n)
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		return mapping(n)
+	case yaml.SequenceNode:
+		arr := bson.A{}
+		for _, c := range n.Content {
+			v, err := value(c)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case yaml.ScalarNode:
+		v, err := scalar(n)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("line %d: unexpected yaml node", n.Line)
+}
+
+func mapping(n *yaml.Node) (interface{}, error) {
+	if len(n.Content) > 0 && strings.HasPrefix(n.Content[0].Value, "$") {
+		return extendedJSON(n)
+	}
+
+	doc := bson.D{}
+	for i := 0; i < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+
+		// 合并锚点 `<<: *base`，已存在的字段优先
+		if k.ShortTag() == "!!merge" {
+			base, err := value(v)
+			if err != nil {
+				return nil, err
+			}
+			merged, ok := base.(bson.D)
+			if !ok {
+				return nil, fmt.Errorf("line %d: merge value must be a mapping", k.Line)
+			}
+			for _, e := range merged {
+				if !hasKey(n, e.Key) {
+					doc = append(doc, e)
+				}
+			}
+			continue
+		}
+
+		val, err := value(v)
+		if err != nil {
+			return nil, err
+		}
+		doc = append(doc, bson.E{Key: k.Value, Value: val})
+	}
+
+	return doc, nil
+}
+
+func hasKey(n *yaml.Node, key string) bool {
+	for i := 0; i < len(n.Content); i += 2 {
+		if n.Content[i].ShortTag() != "!!merge" && n.Content[i].Value == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// extendedJSON 按 Extended JSON 解析 $ 开头的映射，如 {"$oid": "..."}
+func extendedJSON(n *yaml.Node) (interface{}, error) {
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"v": v})
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", n.Line, err)
+	}
+
+	var doc bson.D
+	if err = bson.UnmarshalExtJSON(data, false, &doc); err != nil {
+		return nil, fmt.Errorf("line %d: %w", n.Line, err)
+	}
+
+	return doc[0].Value, nil
+}
+
+func scalar(n *yaml.Node) (interface{}, error) {
+	switch n.ShortTag() {
+	case "!oid":
+		if n.Value == "" {
+			return primitive.NewObjectID(), nil
+		}
+		return primitive.ObjectIDFromHex(n.Value)
+	case "!date", "!!timestamp":
+		return parseDate(n.Value)
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		err := n.Decode(&b)
+		return b, err
+	case "!!int":
+		var i int64
+		if err := n.Decode(&i); err != nil {
+			return nil, err
+		}
+		if i >= math.MinInt32 && i <= math.MaxInt32 {
+			return int32(i), nil
+		}
+		return i, nil
+	case "!!float":
+		var f float64
+		err := n.Decode(&f)
+		return f, err
+	case "!!binary":
+		var b []byte
+		err := n.Decode(&b)
+		return b, err
+	case "!!str":
+		if m := objectIdPattern.FindStringSubmatch(n.Value); m != nil {
+			return primitive.ObjectIDFromHex(m[1])
+		}
+		if m := datePattern.FindStringSubmatch(n.Value); m != nil {
+			return parseDate(m[1])
+		}
+		return n.Value, nil
+	}
+
+	return nil, fmt.Errorf("unsupported tag %s", n.Tag)
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
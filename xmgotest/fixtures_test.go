@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2022. All rights reserved by XtraVisions.
+ */
+
+package xmgotest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const usersYAML = `
+.base: &base
+  role: member
+  active: true
+
+users:
+  - <<: *base
+    _id: !oid 5f1b2c3d4e5f6a7b8c9d0e1f
+    name: alice
+    role: admin
+    age: 30
+    big: 4294967296
+    score: 1.5
+    email: null
+    created: !date 2022-01-02T15:04:05Z
+  - _id: ObjectId("5f1b2c3d4e5f6a7b8c9d0e20")
+    created: ISODate("2022-01-02 15:04:05")
+    address: {city: Shanghai, zip: "200000"}
+    tags: [a, b]
+  - _id: !oid
+orders: []
+`
+
+func TestParseFixtures(t *testing.T) {
+	fixtures, err := ParseFixtures([]byte(usersYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) != 2 || fixtures[0].Collection != "users" || fixtures[1].Collection != "orders" {
+		t.Fatalf("ParseFixtures() = %+v, want users and orders", fixtures)
+	}
+	if len(fixtures[1].Documents) != 0 {
+		t.Errorf("orders = %v, want no documents", fixtures[1].Documents)
+	}
+
+	users := fixtures[0].Documents
+	if len(users) != 3 {
+		t.Fatalf("len(users) = %d, want 3", len(users))
+	}
+
+	id, _ := primitive.ObjectIDFromHex("5f1b2c3d4e5f6a7b8c9d0e1f")
+	created := time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)
+	want := bson.D{
+		{Key: "active", Value: true},
+		{Key: "_id", Value: id},
+		{Key: "name", Value: "alice"},
+		{Key: "role", Value: "admin"},
+		{Key: "age", Value: int32(30)},
+		{Key: "big", Value: int64(4294967296)},
+		{Key: "score", Value: 1.5},
+		{Key: "email", Value: nil},
+		{Key: "created", Value: created},
+	}
+	if !reflect.DeepEqual(users[0], want) {
+		t.Errorf("users[0] =\n  %v\nwant\n  %v", users[0], want)
+	}
+
+	second := users[1].Map()
+	if second["created"] != created {
+		t.Errorf("ISODate() = %v, want %v", second["created"], created)
+	}
+	if addr := second["address"]; !reflect.DeepEqual(addr, bson.D{{Key: "city", Value: "Shanghai"}, {Key: "zip", Value: "200000"}}) {
+		t.Errorf("address = %v, want fields in file order", addr)
+	}
+	if tags := second["tags"]; !reflect.DeepEqual(tags, bson.A{"a", "b"}) {
+		t.Errorf("tags = %v", tags)
+	}
+
+	if generated, ok := users[2][0].Value.(primitive.ObjectID); !ok || generated.IsZero() {
+		t.Errorf("!oid without value = %v, want a new ObjectId", users[2][0].Value)
+	}
+}
+
+func TestParseFixturesExtendedJSON(t *testing.T) {
+	fixtures, err := ParseFixtures([]byte(`{"users": [{"_id": {"$oid": "5f1b2c3d4e5f6a7b8c9d0e1f"}, "n": {"$numberLong": "7"}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := fixtures[0].Documents[0]
+	if _, ok := doc[0].Value.(primitive.ObjectID); !ok || doc[1].Value != int64(7) {
+		t.Errorf("document = %#v, want ObjectId and int64", doc)
+	}
+}
+
+func TestParseFixturesErrors(t *testing.T) {
+	for data, msg := range map[string]string{
+		"- a: 1":                         "must be a mapping",
+		"users: {a: 1}":                  "must be a sequence",
+		"users: [1]":                     "must be a mapping",
+		"users: [{_id: !oid xyz}]":       "not a valid ObjectID",
+		"users: [{at: !date yesterday}]": "invalid date",
+		"users: [{a: !foo bar}]":         "unsupported tag",
+	} {
+		if _, err := ParseFixtures([]byte(data)); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("ParseFixtures(%q) error = %v, want containing %q", data, err, msg)
+		}
+	}
+}